@@ -0,0 +1,299 @@
+package ut
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// LoggedCall is a call made to a mock, as noted in the tracker's log
+type LoggedCall struct {
+	// Index is the position of the call in the log, starting at 0
+	Index   int
+	Method  string
+	Args    []interface{}
+	Returns []interface{}
+	// Goroutine is the ID of the goroutine that made the call, if the
+	// tracker was asked to SetTrackGoroutines(), and otherwise 0
+	Goroutine uint64
+}
+
+// Log returns a copy of the log, so the test can examine it while calls are
+// still being made.
+func (cr *callRecords) Log() []LoggedCall {
+	cr.Lock()
+	defer cr.Unlock()
+	log := make([]LoggedCall, len(cr.log))
+	copy(log, cr.log)
+	return log
+}
+
+func (cr *callRecords) AssertAllCallsArg(name string, argIndex int, expected interface{}) {
+	cr.t.Helper()
+	n := 0
+	for _, c := range cr.Log() {
+		if c.Method != name {
+			continue
+		}
+		n++
+		if argIndex < 0 || argIndex >= len(c.Args) {
+			cr.t.Errorf("Call %d to %s has %d parameters, so no parameter %d", n, name, len(c.Args), argIndex)
+			continue
+		}
+		actual := c.Args[argIndex]
+		if f, ok := expected.(func(actual interface{})); ok {
+			f(actual)
+			continue
+		}
+		if !paramMatches(actual, expected) {
+			cr.t.Errorf("Call %d to %s parameter %d unexpected. Expected %s, got %s (%T)", n, name, argIndex, describeParam(expected), formatValue(actual), actual)
+		}
+	}
+}
+
+// describeParam describes an expected parameter for failure messages
+func describeParam(ep interface{}) string {
+	if m, ok := ep.(Matcher); ok {
+		return m.String()
+	}
+	return fmt.Sprintf("%s (%T)", formatValue(ep), ep)
+}
+
+func (cr *callRecords) SetCallLogFile(path string) CallTracker {
+	cr.callLogPath = path
+	cr.t.Cleanup(func() {
+		cr.Lock()
+		defer cr.Unlock()
+		if cr.callLog != nil {
+			if err := cr.callLog.Close(); err != nil {
+				cr.t.Errorf("Failed to close call log %s. %v", cr.callLogPath, err)
+			}
+			cr.callLog = nil
+		}
+	})
+	return cr
+}
+
+// callLogLine is a call as written to the call log file. Parameters and
+// returns are formatted as for failure messages, as they may not be
+// representable as JSON.
+type callLogLine struct {
+	Test    string   `json:"test"`
+	Index   int      `json:"index"`
+	Method  string   `json:"method"`
+	Args    []string `json:"args"`
+	Returns []string `json:"returns"`
+}
+
+// writeCallLog writes the logged call to the call log file, opening the file
+// if this is the first call. Each line is written in a single write, so lines
+// from trackers sharing the file aren't interleaved. The tracker must be
+// locked.
+func (cr *callRecords) writeCallLog(index int) {
+	if cr.callLog == nil {
+		f, err := os.OpenFile(cr.callLogPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+		if err != nil {
+			cr.t.Errorf("Failed to open call log. %v", err)
+			cr.callLogPath = ""
+			return
+		}
+		cr.callLog = f
+	}
+
+	c := cr.log[index]
+	line := callLogLine{
+		Test:    cr.t.Name(),
+		Index:   c.Index,
+		Method:  c.Method,
+		Args:    formatValues(c.Args),
+		Returns: formatValues(c.Returns),
+	}
+	data, err := json.Marshal(line)
+	if err == nil {
+		_, err = cr.callLog.Write(append(data, '\n'))
+	}
+	if err != nil {
+		cr.t.Errorf("Failed to write call log %s. %v", cr.callLogPath, err)
+		cr.callLogPath = ""
+	}
+}
+
+func formatValues(vals []interface{}) []string {
+	formatted := make([]string, len(vals))
+	for i, v := range vals {
+		formatted[i] = formatValue(v)
+	}
+	return formatted
+}
+
+func (cr *callRecords) AssertSequence(names ...string) {
+	cr.t.Helper()
+	if actual := cr.methodSequence(); !sameNames(names, actual) {
+		cr.t.Errorf("Call sequence not as expected\n%s", diffNames(names, actual))
+	}
+}
+
+func (cr *callRecords) AssertSequenceDiff(t testing.TB, expected []string) {
+	t.Helper()
+	if actual := cr.methodSequence(); !sameNames(expected, actual) {
+		t.Errorf("Call sequence not as expected\n%s", unifiedDiffNames(expected, actual))
+	}
+}
+
+// methodSequence returns the names of the methods called so far, in order
+func (cr *callRecords) methodSequence() []string {
+	log := cr.Log()
+	names := make([]string, len(log))
+	for i, c := range log {
+		names[i] = c.Method
+	}
+	return names
+}
+
+func sameNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// diffLine is a line of a diff. kind is ' ' for a name in both, '-' for an
+// expected name that's missing and '+' for an actual name not expected
+type diffLine struct {
+	kind byte
+	name string
+}
+
+// diffNames builds a line diff between the expected and actual names
+func diffNames(expected, actual []string) string {
+	w := &bytes.Buffer{}
+	for _, l := range diffLines(expected, actual) {
+		fmt.Fprintf(w, "%c %s\n", l.kind, l.name)
+	}
+	return w.String()
+}
+
+// diffLines diffs the expected and actual names, from their longest common
+// subsequence
+func diffLines(expected, actual []string) []diffLine {
+	// lcs[i][j] is the length of the longest common subsequence of
+	// expected[i:] and actual[j:]
+	lcs := make([][]int, len(expected)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(actual)+1)
+	}
+	for i := len(expected) - 1; i >= 0; i-- {
+		for j := len(actual) - 1; j >= 0; j-- {
+			if expected[i] == actual[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(expected) || j < len(actual) {
+		switch {
+		case i < len(expected) && j < len(actual) && expected[i] == actual[j]:
+			lines = append(lines, diffLine{' ', expected[i]})
+			i++
+			j++
+		case j < len(actual) && (i == len(expected) || lcs[i][j+1] >= lcs[i+1][j]):
+			lines = append(lines, diffLine{'+', actual[j]})
+			j++
+		default:
+			lines = append(lines, diffLine{'-', expected[i]})
+			i++
+		}
+	}
+	return lines
+}
+
+// diffContext is the number of unchanged lines shown around each change in a
+// unified diff
+const diffContext = 3
+
+// unifiedDiffNames builds a unified diff between the expected and actual
+// names, as diff -u would for files with a name on each line
+func unifiedDiffNames(expected, actual []string) string {
+	lines := diffLines(expected, actual)
+	w := &bytes.Buffer{}
+	w.WriteString("--- expected\n+++ actual\n")
+
+	// eLine and aLine count the expected and actual lines before lines[i]
+	eLine, aLine := 0, 0
+	for i := 0; i < len(lines); {
+		if lines[i].kind == ' ' {
+			eLine++
+			aLine++
+			i++
+			continue
+		}
+
+		// A hunk starts with context before the change, and runs on until
+		// there's more than twice the context between changes
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for k := i; k < len(lines) && k <= end+2*diffContext; k++ {
+			if lines[k].kind != ' ' {
+				end = k
+			}
+		}
+		end += diffContext + 1
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		eStart, aStart := eLine-(i-start), aLine-(i-start)
+		var eCount, aCount int
+		for _, l := range lines[start:end] {
+			if l.kind != '+' {
+				eCount++
+			}
+			if l.kind != '-' {
+				aCount++
+			}
+		}
+		fmt.Fprintf(w, "@@ -%s +%s @@\n", hunkRange(eStart, eCount), hunkRange(aStart, aCount))
+		for _, l := range lines[start:end] {
+			fmt.Fprintf(w, "%c%s\n", l.kind, l.name)
+		}
+
+		for _, l := range lines[i:end] {
+			if l.kind != '+' {
+				eLine++
+			}
+			if l.kind != '-' {
+				aLine++
+			}
+		}
+		i = end
+	}
+	return w.String()
+}
+
+// hunkRange formats the start line and count of a hunk. Lines are numbered
+// from 1, and an empty range gives the line before it.
+func hunkRange(before, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", before+1)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
@@ -0,0 +1,304 @@
+package ut
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestLog(t *testing.T) {
+	m := &MockGetter{NewCallRecords(t)}
+	m.RecordCall("Read", 7, nil)
+	m.AddCall("Get", "a").SetReturns("apple")
+	m.AddCall("Get", "b").SetReturns("banana")
+
+	if l := m.Log(); len(l) != 0 {
+		t.Fatalf("Expected an empty log, have %v", l)
+	}
+
+	m.Get("a")
+	m.TrackCall("Read", []byte("x"))
+	m.Get("b")
+	m.AssertDone()
+
+	exp := []LoggedCall{
+		{Index: 0, Method: "Get", Args: []interface{}{"a"}, Returns: []interface{}{"apple"}},
+		{Index: 1, Method: "Read", Args: []interface{}{[]byte("x")}, Returns: []interface{}{7, nil}},
+		{Index: 2, Method: "Get", Args: []interface{}{"b"}, Returns: []interface{}{"banana"}},
+	}
+	if l := m.Log(); !reflect.DeepEqual(l, exp) {
+		t.Fatalf("Log not as expected. Have %#v", l)
+	}
+}
+
+func TestLogLenient(t *testing.T) {
+	m := &MockGetter{NewCallRecords(t)}
+	m.Lenient()
+	m.AddCall("Get", "a").SetReturns("apple")
+
+	m.Get("z")
+	m.Get("a")
+
+	exp := []LoggedCall{
+		{Index: 0, Method: "Get", Args: []interface{}{"z"}},
+		{Index: 1, Method: "Get", Args: []interface{}{"a"}, Returns: []interface{}{"apple"}},
+	}
+	if l := m.Log(); !reflect.DeepEqual(l, exp) {
+		t.Fatalf("Log not as expected. Have %#v", l)
+	}
+}
+
+func TestLogConcurrent(t *testing.T) {
+	m := &MockGetter{NewCallRecords(t)}
+	m.RecordCall("Get", "x")
+
+	const goroutines, calls = 10, 100
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < calls; j++ {
+				m.Get("a")
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < calls; j++ {
+				m.Log()
+				m.LastReturns("Get")
+			}
+		}()
+	}
+	wg.Wait()
+
+	l := m.Log()
+	if len(l) != goroutines*calls {
+		t.Fatalf("Expected %d calls logged, have %d", goroutines*calls, len(l))
+	}
+	for i, c := range l {
+		if c.Index != i {
+			t.Fatalf("Call %d has index %d", i, c.Index)
+		}
+	}
+}
+
+// MockTenantStore has methods that take a tenant ID first
+type MockTenantStore struct {
+	CallTracker
+}
+
+func (m *MockTenantStore) Get(tenant, key string) {
+	m.TrackCall("Get", tenant, key)
+}
+
+func (m *MockTenantStore) Put(tenant, key, val string) {
+	m.TrackCall("Put", tenant, key, val)
+}
+
+func TestAssertAllCallsArg(t *testing.T) {
+	tests := []struct {
+		tenants  []string
+		argIndex int
+		expected interface{}
+		errors   []string
+	}{
+		{
+			tenants:  []string{"t1", "t1", "t1"},
+			expected: "t1",
+		},
+		{
+			tenants:  []string{"t1", "t1", "t1"},
+			expected: MatchRegexp("^t[0-9]$"),
+		},
+		{
+			tenants:  []string{"t1", "t2", "t1"},
+			expected: "t1",
+			errors:   []string{`Call 2 to Get parameter 0 unexpected. Expected "t1" (string), got "t2" (string)`},
+		},
+		{
+			tenants:  []string{"t1", "x2", "x3"},
+			expected: MatchRegexp("^t[0-9]$"),
+			errors: []string{
+				`Call 2 to Get parameter 0 unexpected. Expected MatchRegexp("^t[0-9]$"), got "x2" (string)`,
+				`Call 3 to Get parameter 0 unexpected. Expected MatchRegexp("^t[0-9]$"), got "x3" (string)`,
+			},
+		},
+		{
+			tenants:  []string{"t1"},
+			argIndex: 2,
+			expected: "t1",
+			errors:   []string{"Call 1 to Get has 2 parameters, so no parameter 2"},
+		},
+	}
+
+	for i, test := range tests {
+		e := &errorRecorder{TB: t}
+		m := &MockTenantStore{NewCallRecords(e)}
+		m.RecordCall("Get")
+		m.RecordCall("Put")
+		for _, tenant := range test.tenants {
+			m.Get(tenant, "key")
+			// Calls to other methods are ignored
+			m.Put("other", "key", "val")
+		}
+
+		m.AssertAllCallsArg("Get", test.argIndex, test.expected)
+		if !reflect.DeepEqual(e.errors, test.errors) {
+			t.Errorf("Test %d, errors not as expected. Have %q", i, e.errors)
+		}
+	}
+}
+
+func TestAssertAllCallsArgFunc(t *testing.T) {
+	m := &MockTenantStore{NewCallRecords(t)}
+	m.RecordCall("Get")
+	m.Get("t1", "a")
+	m.Get("t1", "b")
+
+	var keys []string
+	m.AssertAllCallsArg("Get", 1, func(actual interface{}) {
+		keys = append(keys, actual.(string))
+	})
+	if !reflect.DeepEqual(keys, []string{"a", "b"}) {
+		t.Fatalf("Keys not as expected. Have %v", keys)
+	}
+}
+
+func TestCallLogFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ut")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir. %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "calls.jsonl")
+
+	t.Run("calls", func(t *testing.T) {
+		m := &MockGetter{NewCallRecords(t)}
+		m.SetCallLogFile(path)
+		m.AddCall("Get", "a").SetReturns("apple")
+		m.AddCall("Get", "b").SetReturns("banana")
+
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("The file should not be created until there's a call")
+		}
+		m.Get("a")
+		m.Get("b")
+		m.AssertDone()
+	})
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read call log. %v", err)
+	}
+	exp := `{"test":"TestCallLogFile/calls","index":0,"method":"Get","args":["\"a\""],"returns":["\"apple\""]}
+{"test":"TestCallLogFile/calls","index":1,"method":"Get","args":["\"b\""],"returns":["\"banana\""]}
+`
+	if string(data) != exp {
+		t.Fatalf("Call log not as expected. Have %s", data)
+	}
+}
+
+func TestAssertSequence(t *testing.T) {
+	tests := []struct {
+		calls    []string
+		expected []string
+		errors   []string
+	}{
+		{},
+		{
+			calls:    []string{"Get", "Put", "Get"},
+			expected: []string{"Get", "Put", "Get"},
+		},
+		{
+			calls:    []string{"Get", "Put", "Put", "Get"},
+			expected: []string{"Get", "Put", "Get"},
+			errors:   []string{"Call sequence not as expected\n  Get\n  Put\n+ Put\n  Get\n"},
+		},
+		{
+			calls:    []string{"Get"},
+			expected: []string{"Get", "Put"},
+			errors:   []string{"Call sequence not as expected\n  Get\n- Put\n"},
+		},
+		{
+			calls:    []string{"Put", "Get"},
+			expected: []string{"Get", "Put"},
+			errors:   []string{"Call sequence not as expected\n+ Put\n  Get\n- Put\n"},
+		},
+		{
+			calls:  []string{"Get"},
+			errors: []string{"Call sequence not as expected\n+ Get\n"},
+		},
+	}
+
+	for i, test := range tests {
+		e := &errorRecorder{TB: t}
+		m := &MockTenantStore{NewCallRecords(e)}
+		m.RecordCall("Get")
+		m.RecordCall("Put")
+		for _, call := range test.calls {
+			if call == "Get" {
+				m.Get("t1", "key")
+			} else {
+				m.Put("t1", "key", "val")
+			}
+		}
+
+		m.AssertSequence(test.expected...)
+		if !reflect.DeepEqual(e.errors, test.errors) {
+			t.Errorf("Test %d, errors not as expected. Have %q", i, e.errors)
+		}
+	}
+}
+
+func TestAssertSequenceDiff(t *testing.T) {
+	tests := []struct {
+		calls    []string
+		expected []string
+		errors   []string
+	}{
+		{
+			calls:    []string{"Get", "Put", "Get"},
+			expected: []string{"Get", "Put", "Get"},
+		},
+		{
+			calls:    []string{"Get", "Put", "Put", "Get"},
+			expected: []string{"Get", "Put", "Get"},
+			errors:   []string{"Call sequence not as expected\n--- expected\n+++ actual\n@@ -1,3 +1,4 @@\n Get\n Put\n+Put\n Get\n"},
+		},
+		{
+			calls:  []string{"Get"},
+			errors: []string{"Call sequence not as expected\n--- expected\n+++ actual\n@@ -0,0 +1 @@\n+Get\n"},
+		},
+		{
+			// Only the calls around each change are shown
+			calls:    []string{"Get", "Get", "Get", "Get", "Get", "Put", "Get", "Get", "Get", "Get", "Get", "Get", "Get", "Get", "Put"},
+			expected: []string{"Get", "Get", "Get", "Get", "Get", "Get", "Get", "Get", "Get", "Get", "Get", "Get", "Get", "Put", "Put"},
+			errors: []string{"Call sequence not as expected\n--- expected\n+++ actual\n" +
+				"@@ -3,6 +3,7 @@\n Get\n Get\n Get\n+Put\n Get\n Get\n Get\n" +
+				"@@ -12,4 +13,3 @@\n Get\n Get\n Put\n-Put\n"},
+		},
+	}
+
+	for i, test := range tests {
+		e := &errorRecorder{TB: t}
+		m := &MockTenantStore{NewCallRecords(t)}
+		m.RecordCall("Get")
+		m.RecordCall("Put")
+		for _, call := range test.calls {
+			if call == "Get" {
+				m.Get("t1", "key")
+			} else {
+				m.Put("t1", "key", "val")
+			}
+		}
+
+		m.AssertSequenceDiff(e, test.expected)
+		if !reflect.DeepEqual(e.errors, test.errors) {
+			t.Errorf("Test %d, errors not as expected. Have %q", i, e.errors)
+		}
+	}
+}
@@ -5,10 +5,14 @@ package ut
 import (
 	"bytes"
 	"fmt"
+	"os"
 	"reflect"
 	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 // CallTracker is an interface to help build mocks.
@@ -46,14 +50,67 @@ type CallTracker interface {
 	// values for the call.
 	SetReturns(returns ...interface{}) CallTracker
 
+	// ReturnsError() can be called immediately after AddCall() in place of
+	// SetReturns(). The call returns err in the method's error result, and
+	// zero values for its other results. The tracker needs to know where each
+	// method returns its error, which mocks generated by genmock tell it via
+	// SetErrorResults().
+	ReturnsError(err error) CallTracker
+
+	// BlocksUntilCancelled() can be called immediately after AddCall() in
+	// place of SetReturns(). When the call is made it blocks until the
+	// context.Context passed to it is cancelled, then returns the context's
+	// error in the method's error result, as for ReturnsError(). Use it to
+	// test that code gives up on calls when it should. The test must cancel
+	// the context, or the call blocks forever. Like ReturnsError(), it needs
+	// the method's ErrorResult from SetErrorResults(), which the
+	// constructors genmock generates set, and otherwise stops the test with
+	// Fatalf.
+	BlocksUntilCancelled() CallTracker
+
+	// SetErrorResults() tells the tracker where each mock method returns its
+	// error, for ReturnsError(). The map is keyed by method name.
+	SetErrorResults(results map[string]ErrorResult) CallTracker
+
+	// Before() is called immediately after AddCall() to indicate the call
+	// must be made before any call added with After() for the same
+	// SequencePoint.
+	Before(p *SequencePoint) CallTracker
+
+	// After() is called immediately after AddCall() to indicate the call must
+	// be made after all the calls added with Before() for the same
+	// SequencePoint.
+	After(p *SequencePoint) CallTracker
+
 	// TrackCall() is called within mocks to track a call to the Mock. It
 	// returns the return values registered via SetReturns()
 	TrackCall(name string, params ...interface{}) []interface{}
 
+	// MustTrackCall() is like TrackCall(), but stops the test with FailNow()
+	// if the call doesn't match the expected call, rather than letting it
+	// carry on. Mocks generated with genmock -eager use it.
+	MustTrackCall(name string, params ...interface{}) []interface{}
+
+	// T returns the test the tracker reports failures to. Mocks generated
+	// with genmock -eager call T().Helper() so failures are reported at the
+	// line that called the mock.
+	T() testing.TB
+
 	// AssertDone() should be called at the end of a test to confirm all
 	// the expected calls have been made
 	AssertDone()
 
+	// AssertDoneWith() is like AssertDone(), but reports missed calls to t
+	// rather than the tracker's own test, and says whether all the expected
+	// calls were made. This helps when the tracker outlives a subtest.
+	AssertDoneWith(t testing.TB) bool
+
+	// ResetMethod() forgets the expected calls to the named method, whether
+	// made or not, along with any recording of the method and its calls in
+	// the log. Expectations for other methods are left alone, so a long test
+	// can set up the method afresh for each phase.
+	ResetMethod(name string) CallTracker
+
 	// RecordCall() is called to indicate calls to the named mock method should
 	// be recorded rather than asserted.  The parameters to any call to the
 	// named method will be recorded and may be retrieved via GetRecordedParams.
@@ -66,30 +123,211 @@ type CallTracker interface {
 	// GetRecordedParams returns the sets of parameters passed to a call captured
 	// via RecordCall
 	GetRecordedParams(name string) ([][]interface{}, bool)
+
+	// SetDefaultFunc() sets a function to call when a call to the named mock
+	// method doesn't match an expected call. The function is passed the call's
+	// parameters and its results are returned from TrackCall, so a mock can
+	// forward to a real implementation except where the test adds an
+	// expectation. The function is called with the tracker locked, so must not
+	// call back into the mock.
+	SetDefaultFunc(name string, fn func(params ...interface{}) []interface{}) CallTracker
+
+	// LogCall logs a call to the named mock method and its parameters via the
+	// test's Logf. Mocks generated with genmock -log-calls call it for every
+	// method call.
+	LogCall(name string, params ...interface{})
+
+	// Unordered() indicates the expected calls may be made in any order. Each
+	// call is matched against the first outstanding expected call with the same
+	// name and parameters, and gets that call's return values. Function
+	// parameters match any value and are called once the call is matched.
+	Unordered() CallTracker
+
+	// RecordLatency records how long a call to the named mock method took.
+	// Mocks generated with genmock -time-calls call it for every method call.
+	RecordLatency(name string, d time.Duration)
+
+	// Stats returns the count, total, minimum and maximum of the latencies
+	// recorded for the named method.
+	Stats(name string) CallStats
+
+	// Lenient() indicates calls that don't match an expected call are
+	// tolerated rather than failing the test. They return no values, unless
+	// set with SetUnexpectedReturns(), and are noted so they can be checked
+	// later with UnexpectedCalls() or AssertNoUnexpected().
+	Lenient() CallTracker
+
+	// SetUnexpectedReturns() sets the values returned by calls to the named
+	// method that a Lenient() tracker tolerates because they don't match an
+	// expected call. Without it these calls return no values, so the mock
+	// returns zero values.
+	SetUnexpectedReturns(name string, returns ...interface{}) CallTracker
+
+	// SetSkipOnUnexpected(true) makes a call that doesn't match an expected
+	// call skip the test rather than fail it. This is handy while building up
+	// the expectations for a test a call at a time. The skip message says
+	// which call was unexpected.
+	SetSkipOnUnexpected(skip bool) CallTracker
+
+	// UnexpectedCalls describes the calls a Lenient() tracker received that
+	// didn't match an expected call.
+	UnexpectedCalls() []string
+
+	// AssertConsumedInOrder() is like AssertDone(), but also checks the call
+	// log shows the expected calls were made in the order they were added.
+	// This lets an Unordered() tracker check ordering once the test is done,
+	// rather than failing on the first call made out of order.
+	AssertConsumedInOrder()
+
+	// TotalCalls returns the number of calls tracked across all methods,
+	// including calls that are recorded rather than asserted.
+	TotalCalls() int
+
+	// SetMaxCalls() sets a budget for the calls tracked across all methods.
+	// Each call beyond the budget fails the test with Errorf and returns no
+	// values, as an unexpected call does, which catches runaway loops and
+	// accidental retries. As mocks are often called from the code under
+	// test's own goroutines the test isn't stopped, unless the call was made
+	// with MustTrackCall on the test's goroutine. A budget of 0, the default,
+	// means no limit.
+	SetMaxCalls(n int) CallTracker
+
+	// LastReturns returns the values returned by the most recent call to the
+	// named method, or nil if there hasn't been one.
+	LastReturns(name string) []interface{}
+
+	// Log returns every call tracked so far, in the order the calls were made.
+	Log() []LoggedCall
+
+	// SetCallLogFile() writes each call to the file at path as a line of JSON,
+	// giving the test's name, the method and its parameters and returns. The
+	// file is appended to, so trackers in many tests can share it, and is
+	// closed when the test finishes. This helps debug tests that only fail
+	// in CI.
+	SetCallLogFile(path string) CallTracker
+
+	// AssertAllCallsArg checks that every call made so far to the named method
+	// passed expected as the parameter at argIndex. expected may be a Matcher,
+	// or a func(actual interface{}) that does its own checking.
+	AssertAllCallsArg(name string, argIndex int, expected interface{})
+
+	// AssertSequence checks the methods called so far, in order, are exactly
+	// the named methods. On a mismatch the failure shows a diff, with calls
+	// that were expected but not made marked - and calls made but not
+	// expected marked +.
+	AssertSequence(names ...string)
+
+	// AssertSequenceDiff is like AssertSequence, but reports a mismatch to t
+	// as a unified diff of the expected and actual method names, like diff -u
+	// gives. This is easier to follow for long sequences, as only the
+	// changes and a few calls around them are shown.
+	AssertSequenceDiff(t testing.TB, expected []string)
+
+	// Summary describes how many of the expected calls have been made, and
+	// lists those that are outstanding.
+	Summary() string
+
+	// SetTrackGoroutines(true) notes the ID of the goroutine that makes each
+	// call, so tests can check calls are made from the goroutines they
+	// expect. Finding the ID is slow, so it's off by default.
+	SetTrackGoroutines(track bool) CallTracker
+
+	// CallGoroutines returns the IDs of the goroutines that made the calls to
+	// the named method, in the order the calls were made. Only calls made
+	// while goroutines are tracked are included. Compare them with
+	// GoroutineID().
+	CallGoroutines(name string) []uint64
 }
 
 type callRecord struct {
 	name    string
 	params  []interface{}
 	returns []interface{}
+	// made is set once the expected call has been made
+	made bool
+	// madeAt orders the call against calls made on other trackers
+	madeAt uint64
+	// logged is the index in the log of the call that was checked against
+	// this expected call, once it has been made
+	logged int
+	// blockUntilCancelled makes the call wait for its context to be cancelled
+	blockUntilCancelled bool
 }
 
-func (e *callRecord) assert(t testing.TB, name string, params ...interface{}) {
+// matches indicates whether a call could be this expected call. Function
+// parameters match anything as they do their own checking, and CaptureAll
+// matches anything but should only capture the parameters of the call it is
+// asserted against.
+func (e *callRecord) matches(name string, params []interface{}) bool {
+	if name != e.name || len(params) != len(e.params) {
+		return false
+	}
+	for i, ap := range params {
+		switch ep := e.params[i].(type) {
+		case func(actual interface{}), *captureMatcher:
+			continue
+		default:
+			if !paramMatches(ap, ep) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// paramMatches indicates whether an actual parameter matches the expected
+// parameter, which may be a Matcher
+func paramMatches(ap, ep interface{}) bool {
+	if ap == nil && ep == nil {
+		return true
+	}
+	if m, ok := ep.(Matcher); ok {
+		return m.Match(ap)
+	}
+	return equal(ap, ep)
+}
+
+// equal is reflect.DeepEqual with a quick path for the basic types most
+// parameters have, which avoids reflection for mocks called in tight loops
+func equal(a, b interface{}) bool {
+	switch b := b.(type) {
+	case string:
+		a, ok := a.(string)
+		return ok && a == b
+	case int:
+		a, ok := a.(int)
+		return ok && a == b
+	case int64:
+		a, ok := a.(int64)
+		return ok && a == b
+	case bool:
+		a, ok := a.(bool)
+		return ok && a == b
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// assert checks the call matches the expected call, and returns false if it
+// doesn't
+func (e *callRecord) assert(t testing.TB, name string, params ...interface{}) bool {
 	if name != e.name {
+		t.Helper()
 		t.Logf("Expected call to %s%s", e.name, paramsToString(e.params))
 		t.Logf(" got call to %s%s", name, paramsToString(params))
 		showStack(t)
 		t.Fail()
-		return
+		return false
 	}
 	if len(params) != len(e.params) {
+		t.Helper()
 		t.Logf("Call to (%s) unexpected parameters", name)
 		t.Logf(" expected %s", paramsToString(e.params))
 		t.Logf("      got %s", paramsToString(params))
 		showStack(t)
 		t.FailNow()
-		return
+		return false
 	}
+	ok := true
 	for i, ap := range params {
 		ep := e.params[i]
 
@@ -100,21 +338,35 @@ func (e *callRecord) assert(t testing.TB, name string, params ...interface{}) {
 		switch ep := ep.(type) {
 		case func(actual interface{}):
 			ep(ap)
+		case Matcher:
+			if !ep.Match(ap) {
+				t.Helper()
+				t.Logf("Call to %s parameter %d unexpected", name, i)
+				t.Logf("  expected %s", ep)
+				t.Logf("       got %s (%T)", formatValue(ap), ap)
+				showStack(t)
+				t.Fail()
+				ok = false
+			}
 		default:
-			if !reflect.DeepEqual(ap, ep) {
+			if !equal(ap, ep) {
+				t.Helper()
 				t.Logf("Call to %s parameter %d unexpected", name, i)
-				t.Logf("  expected %#v (%T)", ep, ep)
-				t.Logf("       got %#v (%T)", ap, ap)
+				t.Logf("  expected %s (%T)", formatValue(ep), ep)
+				t.Logf("       got %s (%T)", formatValue(ap), ap)
 				showStack(t)
 				t.Fail()
+				ok = false
 			}
 		}
 	}
+	return ok
 }
 
 func showStack(t testing.TB) {
+	t.Helper()
 	pc := make([]uintptr, 10)
-	n := runtime.Callers(4, pc)
+	n := runtime.Callers(5, pc)
 	for i := 0; i < n; i++ {
 		f := runtime.FuncForPC(pc[i])
 		file, line := f.FileLine(pc[i])
@@ -127,7 +379,11 @@ func paramsToString(params []interface{}) string {
 	w.WriteString("(")
 	l := len(params)
 	for i, p := range params {
-		fmt.Fprintf(w, "%#v", p)
+		if m, ok := p.(Matcher); ok {
+			w.WriteString(m.String())
+		} else {
+			w.WriteString(formatValue(p))
+		}
 		if i < l-1 {
 			w.WriteString(", ")
 		}
@@ -147,17 +403,74 @@ type recording struct {
 
 type callRecords struct {
 	sync.Mutex
-	t       testing.TB
-	calls   []callRecord
-	records map[string]*recording
-	current int
+	t         testing.TB
+	calls     []callRecord
+	records   map[string]*recording
+	current   int
+	unordered bool
+	// log lists every call tracked, in the order they were made
+	log []LoggedCall
+	// maxCalls is the most calls that may be tracked, if not 0
+	maxCalls int
+	// trackGoroutines notes the goroutine making each call in the log
+	trackGoroutines bool
+	// callLogPath is the file calls are written to, and callLog the file
+	// once it is opened
+	callLogPath string
+	callLog     *os.File
+	// sequenced points to the indices of expected calls held by
+	// SequencePoints, and inFlight to the log indices of calls waiting to be
+	// cancelled. ResetMethod moves calls, so fixes these up
+	sequenced []*int
+	inFlight  []*int
+	// defaults are called for calls that don't match an expected call
+	defaults map[string]func(params ...interface{}) []interface{}
+	lenient  bool
+	// skipOnUnexpected skips the test at the first unexpected call
+	skipOnUnexpected bool
+	// unexpectedReturns are returned from calls tolerated in lenient mode
+	unexpectedReturns map[string][]interface{}
+	// unexpected lists calls tolerated in lenient mode
+	unexpected []callRecord
+	stats      map[string]*CallStats
+	// errorResults describes where methods return their errors
+	errorResults map[string]ErrorResult
+	// helpers notes which functions have marked themselves as test helpers
+	helpers uint32
+}
+
+// Marking a function as a test helper walks the stack, which is costly for
+// mocks called in tight loops. The mark lasts for the whole test, so each
+// function on the TrackCall path marks itself only the first time it's called.
+const (
+	helperTrackCall uint32 = 1 << iota
+	helperMustTrackCall
+	helperTrackCallInner
+)
+
+// helped indicates whether the function has already marked itself as a test
+// helper
+func (cr *callRecords) helped(fn uint32) bool {
+	return atomic.LoadUint32(&cr.helpers)&fn != 0
+}
+
+// setHelped notes that the function has marked itself as a test helper
+func (cr *callRecords) setHelped(fn uint32) {
+	for {
+		old := atomic.LoadUint32(&cr.helpers)
+		if atomic.CompareAndSwapUint32(&cr.helpers, old, old|fn) {
+			return
+		}
+	}
 }
 
 // NewCallRecords creates a new call tracker
 func NewCallRecords(t testing.TB) CallTracker {
 	return &callRecords{
-		t:       t,
-		records: make(map[string]*recording),
+		t:        t,
+		records:  make(map[string]*recording),
+		defaults: make(map[string]func(params ...interface{}) []interface{}),
+		stats:    make(map[string]*CallStats),
 	}
 }
 
@@ -180,39 +493,376 @@ func (cr *callRecords) SetReturns(returns ...interface{}) CallTracker {
 }
 
 func (cr *callRecords) TrackCall(name string, params ...interface{}) []interface{} {
+	if !cr.helped(helperTrackCall) {
+		cr.t.Helper()
+		cr.setHelped(helperTrackCall)
+	}
+	r, _ := cr.trackCall(name, params)
+	return r
+}
+
+func (cr *callRecords) MustTrackCall(name string, params ...interface{}) []interface{} {
+	if !cr.helped(helperMustTrackCall) {
+		cr.t.Helper()
+		cr.setHelped(helperMustTrackCall)
+	}
+	r, ok := cr.trackCall(name, params)
+	if !ok {
+		cr.t.FailNow()
+	}
+	return r
+}
+
+func (cr *callRecords) T() testing.TB {
+	return cr.t
+}
+
+// trackCall tracks a call, and returns false if it didn't match the expected
+// call
+func (cr *callRecords) trackCall(name string, params []interface{}) ([]interface{}, bool) {
+	if !cr.helped(helperTrackCallInner) {
+		cr.t.Helper()
+		cr.setHelped(helperTrackCallInner)
+	}
 	cr.Lock()
 	defer cr.Unlock()
+	if cr.maxCalls > 0 && len(cr.log) >= cr.maxCalls {
+		// Fatalf would be no use from another goroutine
+		cr.t.Errorf("Call %d to %s is more than the %d calls allowed", len(cr.log)+1, name, cr.maxCalls)
+		return nil, false
+	}
+	index := len(cr.log)
+	cr.log = append(cr.log, LoggedCall{Index: index, Method: name, Args: params})
+	if cr.trackGoroutines {
+		cr.log[index].Goroutine = GoroutineID()
+	}
+	if cr.callLogPath != "" {
+		// Written once we know what the call returns
+		defer func() {
+			if index >= 0 {
+				cr.writeCallLog(index)
+			}
+		}()
+	}
 	if record, ok := cr.records[name]; ok {
 		// Call is to be recorded, not asserted
 		record.params = append(record.params, params)
-		return record.returns
+		cr.log[index].Returns = record.returns
+		return record.returns, true
+	}
+	if fn, ok := cr.defaults[name]; ok && !cr.expecting(name, params) {
+		// No expectation for this call, so fall back to the default
+		returns := fn(params...)
+		cr.log[index].Returns = returns
+		return returns, true
+	}
+	if cr.lenient && !cr.expecting(name, params) {
+		cr.unexpected = append(cr.unexpected, callRecord{name: name, params: params})
+		returns := cr.unexpectedReturns[name]
+		cr.log[index].Returns = returns
+		return returns, true
+	}
+	if cr.skipOnUnexpected && !cr.expecting(name, params) {
+		cr.t.Skipf("Skipping test at unexpected call to %s%s", name, paramsToString(params))
+		return nil, false
 	}
 	// Call is to be asserted
-	if cr.current >= len(cr.calls) {
+	expectedCall := cr.nextCall(name, params)
+	if expectedCall == nil {
 		cr.t.Logf("Unexpected call to %s%s", name, paramsToString(params))
 		showStack(cr.t)
 		cr.t.FailNow()
+		return nil, false
 	}
 
-	expectedCall := cr.calls[cr.current]
-	expectedCall.assert(cr.t, name, params...)
+	ok := expectedCall.assert(cr.t, name, params...)
+	expectedCall.made = true
+	expectedCall.madeAt = tick()
+	expectedCall.logged = index
 	cr.current += 1
-	return expectedCall.returns
+	returns := expectedCall.returns
+	if expectedCall.blockUntilCancelled {
+		ctx := contextParam(params)
+		if ctx == nil {
+			cr.t.Errorf("BlocksUntilCancelled used for %s, but the call has no context.Context parameter", name)
+			return nil, false
+		}
+		// Let other calls through while we wait
+		held := index
+		cr.inFlight = append(cr.inFlight, &held)
+		cr.Unlock()
+		<-ctx.Done()
+		cr.Lock()
+		for i, p := range cr.inFlight {
+			if p == &held {
+				cr.inFlight = append(cr.inFlight[:i], cr.inFlight[i+1:]...)
+				break
+			}
+		}
+		index = held
+		returns = cr.cancelledReturns(name, ctx.Err())
+		if index < 0 {
+			// ResetMethod has removed the call from the log
+			return returns, ok
+		}
+	}
+	cr.log[index].Returns = returns
+	return returns, ok
+}
+
+func (cr *callRecords) LastReturns(name string) []interface{} {
+	cr.Lock()
+	defer cr.Unlock()
+	for i := len(cr.log) - 1; i >= 0; i-- {
+		if cr.log[i].Method == name {
+			return cr.log[i].Returns
+		}
+	}
+	return nil
+}
+
+// nextCall finds the expected call that a call should be checked against. This
+// is just the next call unless we're unordered, in which case we look for the
+// first outstanding call that matches.
+func (cr *callRecords) nextCall(name string, params []interface{}) *callRecord {
+	if !cr.unordered {
+		if cr.current >= len(cr.calls) {
+			return nil
+		}
+		return &cr.calls[cr.current]
+	}
+
+	for i := range cr.calls {
+		call := &cr.calls[i]
+		if !call.made && call.matches(name, params) {
+			return call
+		}
+	}
+	return nil
+}
+
+// expecting indicates whether the call matches an expected call that could be
+// made now.
+func (cr *callRecords) expecting(name string, params []interface{}) bool {
+	if !cr.unordered {
+		return cr.current < len(cr.calls) && cr.calls[cr.current].matches(name, params)
+	}
+
+	for i := range cr.calls {
+		if !cr.calls[i].made && cr.calls[i].matches(name, params) {
+			return true
+		}
+	}
+	return false
+}
+
+func (cr *callRecords) ResetMethod(name string) CallTracker {
+	cr.Lock()
+	defer cr.Unlock()
+
+	// Expected calls that are kept move up to fill the gaps, so we note
+	// where each one goes to fix up the indices we hold
+	newIndex := make([]int, len(cr.calls))
+	calls := cr.calls[:0]
+	cr.current = 0
+	for i, call := range cr.calls {
+		if call.name == name {
+			newIndex[i] = -1
+			continue
+		}
+		if call.made {
+			cr.current++
+		}
+		newIndex[i] = len(calls)
+		calls = append(calls, call)
+	}
+	cr.calls = calls
+	for _, index := range cr.sequenced {
+		if *index >= 0 {
+			*index = newIndex[*index]
+		}
+	}
+
+	newLogIndex := make([]int, len(cr.log))
+	log := cr.log[:0]
+	for i, c := range cr.log {
+		if c.Method == name {
+			newLogIndex[i] = -1
+			continue
+		}
+		newLogIndex[i] = len(log)
+		c.Index = len(log)
+		log = append(log, c)
+	}
+	cr.log = log
+	for i := range cr.calls {
+		if cr.calls[i].made {
+			cr.calls[i].logged = newLogIndex[cr.calls[i].logged]
+		}
+	}
+	for _, index := range cr.inFlight {
+		if *index >= 0 {
+			*index = newLogIndex[*index]
+		}
+	}
+
+	unexpected := cr.unexpected[:0]
+	for _, call := range cr.unexpected {
+		if call.name != name {
+			unexpected = append(unexpected, call)
+		}
+	}
+	cr.unexpected = unexpected
+
+	delete(cr.records, name)
+	return cr
+}
+
+func (cr *callRecords) SetDefaultFunc(name string, fn func(params ...interface{}) []interface{}) CallTracker {
+	cr.defaults[name] = fn
+	return cr
+}
+
+func (cr *callRecords) TotalCalls() int {
+	cr.Lock()
+	defer cr.Unlock()
+	return len(cr.log)
+}
+
+func (cr *callRecords) SetMaxCalls(n int) CallTracker {
+	cr.Lock()
+	defer cr.Unlock()
+	cr.maxCalls = n
+	return cr
+}
+
+func (cr *callRecords) Unordered() CallTracker {
+	cr.unordered = true
+	return cr
+}
+
+func (cr *callRecords) Lenient() CallTracker {
+	cr.lenient = true
+	return cr
+}
+
+func (cr *callRecords) SetUnexpectedReturns(name string, returns ...interface{}) CallTracker {
+	cr.Lock()
+	defer cr.Unlock()
+	if cr.unexpectedReturns == nil {
+		cr.unexpectedReturns = make(map[string][]interface{})
+	}
+	cr.unexpectedReturns[name] = returns
+	return cr
+}
+
+func (cr *callRecords) SetSkipOnUnexpected(skip bool) CallTracker {
+	cr.skipOnUnexpected = skip
+	return cr
+}
+
+func (cr *callRecords) UnexpectedCalls() []string {
+	cr.Lock()
+	defer cr.Unlock()
+	calls := make([]string, len(cr.unexpected))
+	for i, call := range cr.unexpected {
+		calls[i] = call.name + paramsToString(call.params)
+	}
+	return calls
+}
+
+// AssertNoUnexpected checks that none of the trackers received calls that
+// didn't match an expected call. Use it at the end of a test to tighten up
+// Lenient() trackers.
+func AssertNoUnexpected(t testing.TB, trackers ...CallTracker) {
+	for i, ct := range trackers {
+		if calls := ct.UnexpectedCalls(); len(calls) != 0 {
+			t.Errorf("Tracker %d received %d unexpected calls: %s", i, len(calls), strings.Join(calls, ", "))
+		}
+	}
 }
 
 func (cr *callRecords) AssertDone() {
+	cr.AssertDoneWith(cr.t)
+}
+
+func (cr *callRecords) AssertDoneWith(t testing.TB) bool {
 	if cr.current < len(cr.calls) {
 		// We don't call Fatalf or FailNow because that may mask other errors if this AssertDone
 		// is called from a defer
 		missed := &bytes.Buffer{}
-		for i, call := range cr.calls[cr.current:] {
-			if i != 0 {
+		for _, call := range cr.calls {
+			if call.made {
+				continue
+			}
+			if missed.Len() != 0 {
 				missed.WriteString(", ")
 			}
 			missed.WriteString(call.name)
 		}
 
-		cr.t.Errorf("Only %d of %d expected calls made. Missed calls to %s", cr.current, len(cr.calls), missed)
+		t.Errorf("Only %d of %d expected calls made. Missed calls to %s", cr.current, len(cr.calls), missed)
+		return false
+	}
+	return true
+}
+
+func (cr *callRecords) LogCall(name string, params ...interface{}) {
+	cr.t.Logf("Call to %s%s", name, paramsToString(params))
+}
+
+func (cr *callRecords) Summary() string {
+	cr.Lock()
+	defer cr.Unlock()
+
+	w := &bytes.Buffer{}
+	fmt.Fprintf(w, "%d of %d expected calls made", cr.current, len(cr.calls))
+	outstanding := 0
+	for _, call := range cr.calls {
+		if call.made {
+			continue
+		}
+		if outstanding == 0 {
+			w.WriteString(". Outstanding calls: ")
+		} else {
+			w.WriteString(", ")
+		}
+		w.WriteString(call.name)
+		w.WriteString(paramsToString(call.params))
+		outstanding++
+	}
+	return w.String()
+}
+
+func (cr *callRecords) AssertConsumedInOrder() {
+	cr.AssertDone()
+
+	cr.Lock()
+	defer cr.Unlock()
+	// Note which expected call each logged call was checked against, then
+	// walk the log to find the order they were made in
+	expected := make([]int, len(cr.log))
+	for i := range expected {
+		expected[i] = -1
+	}
+	for i, call := range cr.calls {
+		if call.made {
+			expected[call.logged] = i
+		}
+	}
+	i := 0
+	for _, index := range expected {
+		if index < 0 {
+			// Recorded, defaulted or tolerated call
+			continue
+		}
+		if index != i {
+			want := cr.calls[i]
+			actual := cr.calls[index]
+			cr.t.Errorf("Expected calls made out of order. Call %d should be %s%s, but was %s%s", i, want.name, paramsToString(want.params), actual.name, paramsToString(actual.params))
+			return
+		}
+		i++
 	}
 }
 
@@ -233,3 +883,28 @@ func NilOrError(val interface{}) error {
 	}
 	return val.(error)
 }
+
+// FillReturns makes sure r has at least n entries, padding it with nils if it
+// is short. Generated mocks use it so that a call primed with fewer return values
+// than the method has results yields zero values rather than an index panic. A
+// warning is logged when padding is needed.
+func FillReturns(ct CallTracker, name string, r []interface{}, n int) []interface{} {
+	if len(r) >= n {
+		return r
+	}
+	if l, ok := ct.(logger); ok {
+		l.logf("Call to %s has %d return values, expected %d. Using zero values for the rest", name, len(r), n)
+	}
+	filled := make([]interface{}, n)
+	copy(filled, r)
+	return filled
+}
+
+// logger is implemented by trackers that can report warnings to the test
+type logger interface {
+	logf(format string, args ...interface{})
+}
+
+func (cr *callRecords) logf(format string, args ...interface{}) {
+	cr.t.Logf(format, args...)
+}
@@ -1,7 +1,12 @@
 package ut
 
 import (
+	"bytes"
+	"fmt"
 	"io"
+	"math/big"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -11,7 +16,7 @@ type MockReader struct {
 }
 
 // NewMockReader is a convenience method for creating our mock
-func NewMockReader(t *testing.T) *MockReader {
+func NewMockReader(t testing.TB) *MockReader {
 	return &MockReader{NewCallRecords(t)}
 }
 
@@ -114,3 +119,806 @@ func TestRecord(t *testing.T) {
 		t.Fatal("grief!")
 	}
 }
+
+// MockLookup has a method using the comma-ok idiom
+type MockLookup struct {
+	CallTracker
+}
+
+func (m *MockLookup) Lookup(k string) (string, bool) {
+	r := m.TrackCall("Lookup", k)
+	r = FillReturns(m.CallTracker, "Lookup", r, 2)
+	var r_0 string
+	if r[0] != nil {
+		r_0 = r[0].(string)
+	}
+	var r_1 bool
+	if r[1] != nil {
+		r_1 = r[1].(bool)
+	}
+	return r_0, r_1
+}
+
+func TestFillReturns(t *testing.T) {
+	m := &MockLookup{NewCallRecords(t)}
+
+	m.AddCall("Lookup", "a").SetReturns("apple", true)
+	m.AddCall("Lookup", "b").SetReturns("banana")
+	m.AddCall("Lookup", "c")
+
+	tests := []struct {
+		k  string
+		v  string
+		ok bool
+	}{
+		{k: "a", v: "apple", ok: true},
+		{k: "b", v: "banana", ok: false},
+		{k: "c", v: "", ok: false},
+	}
+
+	for _, test := range tests {
+		v, ok := m.Lookup(test.k)
+		if v != test.v || ok != test.ok {
+			t.Fatalf("Lookup(%q) returned (%q, %t), expected (%q, %t)", test.k, v, ok, test.v, test.ok)
+		}
+	}
+	m.AssertDone()
+}
+
+// logRecorder is a testing.TB that keeps anything logged
+type logRecorder struct {
+	testing.TB
+	logs []string
+}
+
+func (l *logRecorder) Logf(format string, args ...interface{}) {
+	l.logs = append(l.logs, fmt.Sprintf(format, args...))
+}
+
+func TestLogCall(t *testing.T) {
+	l := &logRecorder{TB: t}
+	m := &MockReader{NewCallRecords(l)}
+	m.LogCall("Read", 37, "cheese")
+
+	if len(l.logs) != 1 || l.logs[0] != `Call to Read(37, "cheese")` {
+		t.Fatalf("Logs not as expected. %q", l.logs)
+	}
+}
+
+// MockGetter is a map-like mock
+type MockGetter struct {
+	CallTracker
+}
+
+func (m *MockGetter) Get(k string) string {
+	r := m.TrackCall("Get", k)
+	r = FillReturns(m.CallTracker, "Get", r, 1)
+	var r_0 string
+	if r[0] != nil {
+		r_0 = r[0].(string)
+	}
+	return r_0
+}
+
+func TestUnordered(t *testing.T) {
+	m := &MockGetter{NewCallRecords(t)}
+	m.Unordered()
+
+	m.AddCall("Get", "key1").SetReturns("v1")
+	m.AddCall("Get", "key2").SetReturns("v2")
+	m.AddCall("Get", "key1").SetReturns("v1 again")
+
+	tests := []struct {
+		k string
+		v string
+	}{
+		{k: "key2", v: "v2"},
+		{k: "key1", v: "v1"},
+		{k: "key1", v: "v1 again"},
+	}
+
+	for _, test := range tests {
+		if v := m.Get(test.k); v != test.v {
+			t.Fatalf("Get(%q) returned %q, expected %q", test.k, v, test.v)
+		}
+	}
+	m.AssertDone()
+}
+
+func TestUnorderedMissed(t *testing.T) {
+	l := &errorRecorder{TB: t}
+	m := &MockGetter{NewCallRecords(l)}
+	m.Unordered()
+
+	m.AddCall("Get", "key1").SetReturns("v1")
+	m.AddCall("Get", "key2").SetReturns("v2")
+
+	m.Get("key2")
+	m.AssertDone()
+
+	if len(l.errors) != 1 || l.errors[0] != "Only 1 of 2 expected calls made. Missed calls to Get" {
+		t.Fatalf("Errors not as expected. %q", l.errors)
+	}
+}
+
+// errorRecorder is a testing.TB that keeps any errors reported
+type errorRecorder struct {
+	testing.TB
+	errors []string
+}
+
+func (e *errorRecorder) Errorf(format string, args ...interface{}) {
+	e.errors = append(e.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertDoneWith(t *testing.T) {
+	own := &errorRecorder{TB: t}
+	m := &MockGetter{NewCallRecords(own)}
+	m.AddCall("Get", "a").SetReturns("apple")
+	m.AddCall("Get", "b").SetReturns("banana")
+	m.Get("a")
+
+	other := &errorRecorder{TB: t}
+	if m.AssertDoneWith(other) {
+		t.Fatalf("Expected AssertDoneWith to report missed calls")
+	}
+	if len(own.errors) != 0 {
+		t.Fatalf("Failure should not be reported to the tracker's test. Have %q", own.errors)
+	}
+	if exp := []string{"Only 1 of 2 expected calls made. Missed calls to Get"}; !reflect.DeepEqual(other.errors, exp) {
+		t.Fatalf("Failure not as expected. Have %q", other.errors)
+	}
+
+	m.Get("b")
+	if !m.AssertDoneWith(t) {
+		t.Fatalf("Expected all calls to be made")
+	}
+}
+
+type nilError struct{}
+
+func (*nilError) Error() string { return "nil error" }
+
+// MockOpener returns a pointer and an interface, laid out as genmock would
+type MockOpener struct {
+	CallTracker
+}
+
+func (m *MockOpener) Open() (*bytes.Buffer, error) {
+	r := m.TrackCall("Open")
+	r = FillReturns(m.CallTracker, "Open", r, 2)
+	var r_0 *bytes.Buffer
+	if r[0] != nil {
+		r_0 = r[0].(*bytes.Buffer)
+	}
+	var r_1 error
+	if r[1] != nil {
+		r_1 = r[1].(error)
+	}
+	return r_0, r_1
+}
+
+func TestTypedNilReturns(t *testing.T) {
+	m := &MockOpener{NewCallRecords(t)}
+
+	m.AddCall("Open").SetReturns(nil, nil)
+	m.AddCall("Open").SetReturns((*bytes.Buffer)(nil), (*nilError)(nil))
+
+	// Untyped nils give zero values
+	b, err := m.Open()
+	if b != nil || err != nil {
+		t.Fatalf("Expected nil returns, got %#v, %#v", b, err)
+	}
+
+	// A typed nil pointer is returned as a nil pointer, but a typed nil in an
+	// interface result is a non-nil interface
+	b, err = m.Open()
+	if b != nil {
+		t.Fatalf("Expected nil buffer, got %#v", b)
+	}
+	if err == nil {
+		t.Fatalf("Expected non-nil error holding a nil pointer")
+	}
+	if e, ok := err.(*nilError); !ok || e != nil {
+		t.Fatalf("Expected error to hold a nil *nilError, got %#v", err)
+	}
+	m.AssertDone()
+}
+
+func TestTotalCalls(t *testing.T) {
+	m := &MockGetter{NewCallRecords(t)}
+	m.RecordCall("Read", 1, nil)
+	m.AddCall("Get", "a").SetReturns("apple")
+	m.AddCall("Get", "b").SetReturns("banana")
+
+	if n := m.TotalCalls(); n != 0 {
+		t.Fatalf("Expected no calls, have %d", n)
+	}
+
+	m.Get("a")
+	m.TrackCall("Read", []byte("x"))
+	m.Get("b")
+
+	if n := m.TotalCalls(); n != 3 {
+		t.Fatalf("Expected 3 calls, have %d", n)
+	}
+	m.AssertDone()
+}
+
+func TestSetMaxCalls(t *testing.T) {
+	e := &errorRecorder{TB: t}
+	m := &MockGetter{NewCallRecords(e)}
+	m.SetMaxCalls(2).Lenient()
+	m.AddCall("Get", "a").SetReturns("apple")
+
+	m.Get("a")
+	m.Get("b")
+	if len(e.errors) != 0 {
+		t.Fatalf("Calls within the budget should be allowed. Have %q", e.errors)
+	}
+
+	if v := m.Get("c"); v != "" {
+		t.Fatalf("The call beyond the budget returned %q", v)
+	}
+	if exp := "Call 3 to Get is more than the 2 calls allowed"; len(e.errors) != 1 || e.errors[0] != exp {
+		t.Fatalf("Errors not as expected. Have %q, want %q", e.errors, exp)
+	}
+	if n := m.TotalCalls(); n != 2 {
+		t.Fatalf("The call beyond the budget shouldn't be tracked. Have %d calls", n)
+	}
+}
+
+func TestSetMaxCallsOtherGoroutine(t *testing.T) {
+	e := &errorRecorder{TB: t}
+	m := &MockGetter{NewCallRecords(e)}
+	m.SetMaxCalls(1).Lenient()
+
+	// The code under test calls the mock from its own goroutine, which must
+	// carry on past the call beyond the budget
+	done := make(chan string)
+	go func() {
+		m.Get("a")
+		done <- m.Get("b")
+	}()
+	if v := <-done; v != "" {
+		t.Fatalf("The call beyond the budget returned %q", v)
+	}
+	if exp := "Call 2 to Get is more than the 1 calls allowed"; len(e.errors) != 1 || e.errors[0] != exp {
+		t.Fatalf("Errors not as expected. Have %q, want %q", e.errors, exp)
+	}
+}
+
+// MockPiper returns several interfaces, laid out as genmock would
+type MockPiper struct {
+	CallTracker
+}
+
+func (m *MockPiper) Pipes() (io.Reader, io.Writer, io.Closer) {
+	r := m.TrackCall("Pipes")
+	r = FillReturns(m.CallTracker, "Pipes", r, 3)
+	var r_0 io.Reader
+	if r[0] != nil {
+		r_0 = r[0].(io.Reader)
+	}
+	var r_1 io.Writer
+	if r[1] != nil {
+		r_1 = r[1].(io.Writer)
+	}
+	var r_2 io.Closer
+	if r[2] != nil {
+		r_2 = r[2].(io.Closer)
+	}
+	return r_0, r_1, r_2
+}
+
+func TestInterfaceReturns(t *testing.T) {
+	m := &MockPiper{NewCallRecords(t)}
+
+	rd := strings.NewReader("cheese")
+	wr := &bytes.Buffer{}
+	cl := io.NopCloser(rd)
+	m.AddCall("Pipes").SetReturns(rd, wr, cl)
+
+	r, w, c := m.Pipes()
+	if r != rd || w != wr || c != cl {
+		t.Fatalf("Returns not as primed")
+	}
+	m.AssertDone()
+}
+
+func TestSummary(t *testing.T) {
+	m := &MockGetter{NewCallRecords(t)}
+	m.AddCall("Get", "a").SetReturns("apple")
+	m.AddCall("Get", "b").SetReturns("banana")
+	m.AddCall("Get", "c").SetReturns("cherry")
+
+	m.Get("a")
+
+	exp := `1 of 3 expected calls made. Outstanding calls: Get("b"), Get("c")`
+	if s := m.Summary(); s != exp {
+		t.Fatalf("Summary not as expected. Have %s", s)
+	}
+
+	m.Get("b")
+	m.Get("c")
+
+	exp = "3 of 3 expected calls made"
+	if s := m.Summary(); s != exp {
+		t.Fatalf("Summary not as expected. Have %s", s)
+	}
+	m.AssertDone()
+}
+
+func TestAssertConsumedInOrder(t *testing.T) {
+	tests := []struct {
+		keys   []string
+		errors []string
+	}{
+		{
+			keys: []string{"a", "b", "c"},
+		},
+		{
+			keys:   []string{"a", "c", "b"},
+			errors: []string{`Expected calls made out of order. Call 1 should be Get("b"), but was Get("c")`},
+		},
+		{
+			keys: []string{"a", "b"},
+			errors: []string{
+				"Only 2 of 3 expected calls made. Missed calls to Get",
+			},
+		},
+	}
+
+	for i, test := range tests {
+		l := &errorRecorder{TB: t}
+		m := &MockGetter{NewCallRecords(l)}
+		m.Unordered()
+		m.RecordCall("Read", 1, nil)
+		m.AddCall("Get", "a")
+		m.AddCall("Get", "b")
+		m.AddCall("Get", "c")
+
+		// Recorded calls in the log don't count
+		for _, k := range test.keys {
+			m.TrackCall("Read", []byte(k))
+			m.Get(k)
+		}
+		m.AssertConsumedInOrder()
+
+		if !reflect.DeepEqual(l.errors, test.errors) {
+			t.Errorf("Test %d, errors not as expected. Have %q", i, l.errors)
+		}
+	}
+}
+
+func TestLastReturns(t *testing.T) {
+	m := &MockGetter{NewCallRecords(t)}
+	m.RecordCall("Read", 7, nil)
+	m.AddCall("Get", "a").SetReturns("apple")
+	m.AddCall("Get", "b").SetReturns("banana")
+
+	if r := m.LastReturns("Get"); r != nil {
+		t.Fatalf("Expected no returns before any calls, have %v", r)
+	}
+
+	m.Get("a")
+	if r := m.LastReturns("Get"); !reflect.DeepEqual(r, []interface{}{"apple"}) {
+		t.Fatalf("LastReturns not as expected. Have %v", r)
+	}
+
+	m.Get("b")
+	if r := m.LastReturns("Get"); !reflect.DeepEqual(r, []interface{}{"banana"}) {
+		t.Fatalf("LastReturns not as expected. Have %v", r)
+	}
+
+	m.TrackCall("Read", []byte("x"))
+	if r := m.LastReturns("Read"); !reflect.DeepEqual(r, []interface{}{7, nil}) {
+		t.Fatalf("LastReturns not as expected. Have %v", r)
+	}
+	m.AssertDone()
+}
+
+func TestSetDefaultFunc(t *testing.T) {
+	impl := map[string]string{"a": "apple", "b": "banana"}
+	def := func(params ...interface{}) []interface{} {
+		return []interface{}{impl[params[0].(string)]}
+	}
+
+	tests := []struct {
+		unordered bool
+	}{
+		{unordered: false},
+		{unordered: true},
+	}
+
+	for i, test := range tests {
+		m := &MockGetter{NewCallRecords(t)}
+		if test.unordered {
+			m.Unordered()
+		}
+		m.SetDefaultFunc("Get", def)
+		m.AddCall("Get", "b").SetReturns("blueberry")
+
+		exp := []struct{ k, v string }{
+			{"a", "apple"},
+			{"b", "blueberry"},
+			{"b", "banana"},
+			{"c", ""},
+		}
+		for _, e := range exp {
+			if v := m.Get(e.k); v != e.v {
+				t.Errorf("Test %d, Get(%s) returned %q, expected %q", i, e.k, v, e.v)
+			}
+		}
+		m.AssertDone()
+
+		if n := m.TotalCalls(); n != 4 {
+			t.Errorf("Test %d, expected 4 calls, have %d", i, n)
+		}
+	}
+}
+
+// skipRecorder is a testing.TB that notes why the test was skipped
+type skipRecorder struct {
+	testing.TB
+	skip string
+}
+
+func (s *skipRecorder) Skipf(format string, args ...interface{}) {
+	s.skip = fmt.Sprintf(format, args...)
+}
+
+func TestSkipOnUnexpected(t *testing.T) {
+	s := &skipRecorder{TB: t}
+	m := &MockGetter{NewCallRecords(s)}
+	m.SetSkipOnUnexpected(true)
+	m.AddCall("Get", "a").SetReturns("apple")
+
+	if v := m.Get("a"); v != "apple" {
+		t.Fatalf("Expected call returned %q", v)
+	}
+	if s.skip != "" {
+		t.Fatalf("Expected call should not skip. Have %q", s.skip)
+	}
+
+	m.Get("b")
+	if s.skip != `Skipping test at unexpected call to Get("b")` {
+		t.Fatalf("Skip not as expected. Have %q", s.skip)
+	}
+}
+
+func TestSkipOnUnexpectedSkips(t *testing.T) {
+	var sub *testing.T
+	t.Run("sub", func(t *testing.T) {
+		sub = t
+		m := &MockGetter{NewCallRecords(t)}
+		m.SetSkipOnUnexpected(true)
+		m.AddCall("Get", "a").SetReturns("apple")
+		m.Get("b")
+		t.Fatalf("Should have skipped before here")
+	})
+	if !sub.Skipped() || sub.Failed() {
+		t.Fatalf("Expected the test to be skipped, not failed")
+	}
+}
+
+func TestResetMethod(t *testing.T) {
+	tests := []struct {
+		unordered bool
+	}{
+		{unordered: false},
+		{unordered: true},
+	}
+
+	for i, test := range tests {
+		m := &MockStore{NewCallRecords(t)}
+		if test.unordered {
+			m.Unordered()
+		}
+		m.AddCall("Create", "1", "fred")
+		m.AddCall("Update", "1", "barney")
+		m.AddCall("Create", "2", "wilma")
+		m.AddCall("Update", "2", "betty")
+
+		m.Create("1", "fred")
+		m.Update("1", "barney")
+
+		// The second phase updates differently
+		m.ResetMethod("Update")
+		m.AddCall("Update", "2", "pebbles")
+
+		m.Create("2", "wilma")
+		m.Update("2", "pebbles")
+		m.AssertConsumedInOrder()
+
+		if s := m.Summary(); s != "3 of 3 expected calls made" {
+			t.Errorf("Test %d, summary not as expected. Have %q", i, s)
+		}
+		var methods []string
+		for j, c := range m.Log() {
+			if c.Index != j {
+				t.Errorf("Test %d, call %d has index %d", i, j, c.Index)
+			}
+			methods = append(methods, c.Method)
+		}
+		if !reflect.DeepEqual(methods, []string{"Create", "Create", "Update"}) {
+			t.Errorf("Test %d, log not as expected. Have %v", i, methods)
+		}
+	}
+}
+
+func TestResetMethodRecorded(t *testing.T) {
+	m := &MockGetter{NewCallRecords(t)}
+	m.RecordCall("Read", 1, nil)
+	m.AddCall("Get", "a").SetReturns("apple")
+
+	m.TrackCall("Read", []byte("x"))
+	m.ResetMethod("Read")
+	if _, ok := m.GetRecordedParams("Read"); ok {
+		t.Fatalf("The recording should be forgotten")
+	}
+
+	if v := m.Get("a"); v != "apple" {
+		t.Fatalf("Get returned %q", v)
+	}
+	m.AssertDone()
+}
+
+func TestAssertNoUnexpected(t *testing.T) {
+	g := &MockGetter{NewCallRecords(t)}
+	g.Lenient()
+	g.AddCall("Get", "a").SetReturns("apple")
+
+	m := &MockReader{NewCallRecords(t)}
+	m.Lenient()
+	m.AddCall("Read", []byte("x")).SetReturns(1, nil)
+
+	if v := g.Get("z"); v != "" {
+		t.Fatalf("Unexpected call returned %q", v)
+	}
+	if v := g.Get("a"); v != "apple" {
+		t.Fatalf("Expected call returned %q", v)
+	}
+	m.Read([]byte("x"))
+	g.AssertDone()
+	m.AssertDone()
+
+	e := &errorRecorder{TB: t}
+	AssertNoUnexpected(e, m, g)
+	if len(e.errors) != 1 || e.errors[0] != `Tracker 1 received 1 unexpected calls: Get("z")` {
+		t.Fatalf("Errors not as expected. %q", e.errors)
+	}
+
+	e = &errorRecorder{TB: t}
+	AssertNoUnexpected(e, m)
+	if len(e.errors) != 0 {
+		t.Fatalf("Expected no errors, have %q", e.errors)
+	}
+}
+
+func TestSetUnexpectedReturns(t *testing.T) {
+	m := &MockGetter{NewCallRecords(t)}
+	m.Lenient()
+	m.SetUnexpectedReturns("Get", "unknown")
+	m.AddCall("Get", "a").SetReturns("apple")
+
+	if v := m.Get("z"); v != "unknown" {
+		t.Fatalf("Unexpected call returned %q", v)
+	}
+	if v := m.Get("a"); v != "apple" {
+		t.Fatalf("Expected call returned %q", v)
+	}
+	if v := m.Get("y"); v != "unknown" {
+		t.Fatalf("Unexpected call returned %q", v)
+	}
+	m.AssertDone()
+
+	if r := m.LastReturns("Get"); len(r) != 1 || r[0] != "unknown" {
+		t.Fatalf("LastReturns not as expected. Have %v", r)
+	}
+	if calls := m.UnexpectedCalls(); len(calls) != 2 {
+		t.Fatalf("Expected 2 unexpected calls, have %q", calls)
+	}
+
+	// Other methods still return no values
+	if r := m.TrackCall("Put", "z"); r != nil {
+		t.Fatalf("Unexpected Put returned %v", r)
+	}
+}
+
+// MockBank returns pointers to big.Int, laid out as genmock would
+type MockBank struct {
+	CallTracker
+}
+
+func (m *MockBank) Balance(account string) *big.Int {
+	r := m.TrackCall("Balance", account)
+	r = FillReturns(m.CallTracker, "Balance", r, 1)
+	var r_0 *big.Int
+	if r[0] != nil {
+		r_0 = r[0].(*big.Int)
+	}
+	return r_0
+}
+
+func TestPointerReturns(t *testing.T) {
+	m := &MockBank{NewCallRecords(t)}
+	m.AddCall("Balance", "fred").SetReturns(big.NewInt(5))
+	m.AddCall("Balance", "barney")
+
+	if b := m.Balance("fred"); b == nil || b.Cmp(big.NewInt(5)) != 0 {
+		t.Fatalf("Balance returned %v", b)
+	}
+	if b := m.Balance("barney"); b != nil {
+		t.Fatalf("Balance with no returns set returned %v", b)
+	}
+	m.AssertDone()
+}
+
+// MockWatcher returns channels, laid out as genmock would
+type MockWatcher struct {
+	CallTracker
+}
+
+func (m *MockWatcher) Watch(key string) chan string {
+	r := m.TrackCall("Watch", key)
+	r = FillReturns(m.CallTracker, "Watch", r, 1)
+	var r_0 chan string
+	if r[0] != nil {
+		r_0 = r[0].(chan string)
+	}
+	return r_0
+}
+
+func (m *MockWatcher) Events() <-chan string {
+	r := m.TrackCall("Events")
+	r = FillReturns(m.CallTracker, "Events", r, 1)
+	var r_0 <-chan string
+	if r[0] != nil {
+		r_0 = r[0].(<-chan string)
+	}
+	return r_0
+}
+
+func TestChannelReturns(t *testing.T) {
+	m := &MockWatcher{NewCallRecords(t)}
+
+	watch := make(chan string)
+	events := make(chan string, 1)
+	m.AddCall("Watch", "a").SetReturns(watch)
+	// A receive-only result has to be primed with a receive-only channel
+	m.AddCall("Events").SetReturns((<-chan string)(events))
+
+	c := m.Watch("a")
+	done := make(chan string)
+	go func() {
+		done <- <-c
+	}()
+
+	// The test drives the code under test by writing to the channel
+	watch <- "changed"
+	if v := <-done; v != "changed" {
+		t.Fatalf("Read %q from the watch channel", v)
+	}
+
+	events <- "event"
+	if v := <-m.Events(); v != "event" {
+		t.Fatalf("Read %q from the events channel", v)
+	}
+	m.AssertDone()
+}
+
+// fatalRecorder is a testing.TB that notes failures without stopping the test
+type fatalRecorder struct {
+	testing.TB
+	failed, failedNow bool
+}
+
+func (f *fatalRecorder) Fail() {
+	f.failed = true
+}
+
+func (f *fatalRecorder) FailNow() {
+	f.failedNow = true
+}
+
+func (f *fatalRecorder) Logf(format string, args ...interface{}) {}
+
+func TestMustTrackCall(t *testing.T) {
+	tests := []struct {
+		must      bool
+		param     string
+		failed    bool
+		failedNow bool
+	}{
+		{must: true, param: "a"},
+		{must: true, param: "b", failed: true, failedNow: true},
+		{must: false, param: "b", failed: true},
+	}
+
+	for i, test := range tests {
+		f := &fatalRecorder{TB: t}
+		ct := NewCallRecords(f)
+		if ct.T() != f {
+			t.Fatalf("Test %d, T() should return the test", i)
+		}
+		ct.AddCall("Get", "a").SetReturns("apple")
+
+		if test.must {
+			ct.MustTrackCall("Get", test.param)
+		} else {
+			ct.TrackCall("Get", test.param)
+		}
+		if f.failed != test.failed || f.failedNow != test.failedNow {
+			t.Errorf("Test %d, failed %t, failedNow %t", i, f.failed, f.failedNow)
+		}
+	}
+}
+
+// MockCounter has a method that takes a few basic values, as is common for
+// methods called in a tight loop
+type MockCounter struct {
+	CallTracker
+}
+
+func (m *MockCounter) Add(key string, n int) bool {
+	r := m.TrackCall("Add", key, n)
+	r = FillReturns(m.CallTracker, "Add", r, 1)
+	var r_0 bool
+	if r[0] != nil {
+		r_0 = r[0].(bool)
+	}
+	return r_0
+}
+
+func TestTrackCallAllocs(t *testing.T) {
+	const calls = 1000000
+	m := NewCallRecords(t)
+	// AllocsPerRun makes an extra call to warm up
+	for i := 0; i < calls+1; i++ {
+		m.AddCall("Add", "key", 1).SetReturns(true)
+	}
+
+	// The params slice escapes as TrackCall is called via an interface, but
+	// the tracker itself shouldn't allocate
+	allocs := testing.AllocsPerRun(calls, func() {
+		m.TrackCall("Add", "key", 1)
+	})
+	if allocs > 1 {
+		t.Fatalf("TrackCall made %v allocations per call, expected at most 1", allocs)
+	}
+	m.AssertDone()
+}
+
+func BenchmarkTrackCall(b *testing.B) {
+	m := &MockCounter{NewCallRecords(b)}
+	for i := 0; i < b.N; i++ {
+		m.AddCall("Add", "key", 1).SetReturns(true)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Add("key", 1)
+	}
+}
+
+func BenchmarkTrackCallRecorded(b *testing.B) {
+	m := &MockCounter{NewCallRecords(b)}
+	m.RecordCall("Add", true)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Add("key", 1)
+	}
+}
+
+func BenchmarkTrackCallDefault(b *testing.B) {
+	m := &MockCounter{NewCallRecords(b)}
+	returns := []interface{}{true}
+	m.SetDefaultFunc("Add", func(params ...interface{}) []interface{} { return returns })
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Add("key", 1)
+	}
+}
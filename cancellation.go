@@ -0,0 +1,33 @@
+package ut
+
+import "context"
+
+func (cr *callRecords) BlocksUntilCancelled() CallTracker {
+	call := &cr.calls[len(cr.calls)-1]
+	if _, ok := cr.errorResults[call.name]; !ok {
+		cr.t.Fatalf("BlocksUntilCancelled used for %s, which doesn't return an error", call.name)
+		return cr
+	}
+	call.blockUntilCancelled = true
+	return cr
+}
+
+// contextParam returns the first of the call's parameters that is a
+// context.Context, or nil if there isn't one
+func contextParam(params []interface{}) context.Context {
+	for _, p := range params {
+		if ctx, ok := p.(context.Context); ok {
+			return ctx
+		}
+	}
+	return nil
+}
+
+// cancelledReturns builds the returns for a call to the named method that
+// was cancelled, with err in the method's error result
+func (cr *callRecords) cancelledReturns(name string, err error) []interface{} {
+	er := cr.errorResults[name]
+	returns := make([]interface{}, er.Results)
+	returns[er.Index] = err
+	return returns
+}
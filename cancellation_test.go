@@ -0,0 +1,160 @@
+package ut
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// MockWorker has methods taking a context, laid out as genmock would
+type MockWorker struct {
+	CallTracker
+}
+
+func NewMockWorker(t testing.TB) *MockWorker {
+	return &MockWorker{NewCallRecords(t).SetErrorResults(map[string]ErrorResult{
+		"LongOp": {Index: 1, Results: 2},
+		"Quick":  {Index: 0, Results: 1},
+		"Ping":   {Index: 0, Results: 1},
+	})}
+}
+
+func (m *MockWorker) LongOp(ctx context.Context, n int) (int, error) {
+	r := m.TrackCall("LongOp", ctx, n)
+	r = FillReturns(m.CallTracker, "LongOp", r, 2)
+	var r_0 int
+	if r[0] != nil {
+		r_0 = r[0].(int)
+	}
+	var r_1 error
+	if r[1] != nil {
+		r_1 = r[1].(error)
+	}
+	return r_0, r_1
+}
+
+func (m *MockWorker) Quick(ctx context.Context) error {
+	r := m.TrackCall("Quick", ctx)
+	r = FillReturns(m.CallTracker, "Quick", r, 1)
+	var r_0 error
+	if r[0] != nil {
+		r_0 = r[0].(error)
+	}
+	return r_0
+}
+
+func (m *MockWorker) Ping(host string) error {
+	r := m.TrackCall("Ping", host)
+	r = FillReturns(m.CallTracker, "Ping", r, 1)
+	var r_0 error
+	if r[0] != nil {
+		r_0 = r[0].(error)
+	}
+	return r_0
+}
+
+func TestBlocksUntilCancelled(t *testing.T) {
+	m := NewMockWorker(t)
+	m.Unordered()
+	m.AddCall("LongOp", func(interface{}) {}, 37).BlocksUntilCancelled()
+	m.AddCall("Quick", func(interface{}) {})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	type result struct {
+		n   int
+		err error
+	}
+	done := make(chan result)
+	go func() {
+		n, err := m.LongOp(ctx, 37)
+		done <- result{n, err}
+	}()
+
+	// Other calls aren't held up by the blocked call
+	for m.TotalCalls() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := m.Quick(ctx); err != nil {
+		t.Fatalf("Quick returned %v", err)
+	}
+	select {
+	case r := <-done:
+		t.Fatalf("LongOp returned %d, %v before the context was cancelled", r.n, r.err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	cancel()
+	if r := <-done; r.n != 0 || r.err != context.Canceled {
+		t.Fatalf("LongOp returned %d, %v", r.n, r.err)
+	}
+	m.AssertDone()
+
+	if r := m.LastReturns("LongOp"); len(r) != 2 || r[1] != context.Canceled {
+		t.Fatalf("LastReturns not as expected. Have %v", r)
+	}
+}
+
+func TestBlocksUntilCancelledResetMethod(t *testing.T) {
+	m := NewMockWorker(t)
+	m.Unordered()
+	m.AddCall("Quick", func(interface{}) {})
+	m.AddCall("LongOp", func(interface{}) {}, 37).BlocksUntilCancelled()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := m.Quick(ctx); err != nil {
+		t.Fatalf("Quick returned %v", err)
+	}
+	done := make(chan error)
+	go func() {
+		_, err := m.LongOp(ctx, 37)
+		done <- err
+	}()
+	for m.TotalCalls() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Resetting Quick moves the blocked call up the log
+	m.ResetMethod("Quick")
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("LongOp returned %v", err)
+	}
+
+	log := m.Log()
+	if len(log) != 1 || log[0].Method != "LongOp" || len(log[0].Returns) != 2 || log[0].Returns[1] != context.Canceled {
+		t.Fatalf("Log not as expected. Have %v", log)
+	}
+	m.AssertDone()
+}
+
+func TestBlocksUntilCancelledDeadline(t *testing.T) {
+	m := NewMockWorker(t)
+	m.AddCall("Quick", ContextWithDeadline()).BlocksUntilCancelled()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if err := m.Quick(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Quick returned %v", err)
+	}
+	m.AssertDone()
+}
+
+func TestBlocksUntilCancelledNoContext(t *testing.T) {
+	e := &errorRecorder{TB: t}
+	m := NewMockWorker(e)
+	m.AddCall("Ping", "host").BlocksUntilCancelled()
+
+	m.Ping("host")
+	if len(e.errors) != 1 || e.errors[0] != "BlocksUntilCancelled used for Ping, but the call has no context.Context parameter" {
+		t.Fatalf("Errors not as expected. %q", e.errors)
+	}
+}
+
+func TestBlocksUntilCancelledNoError(t *testing.T) {
+	f := &fatalfRecorder{TB: t}
+	m := NewMockParser(f)
+	m.AddCall("Reset").BlocksUntilCancelled()
+	if f.fatal != "BlocksUntilCancelled used for Reset, which doesn't return an error" {
+		t.Fatalf("Failure not as expected. Have %q", f.fatal)
+	}
+}
@@ -0,0 +1,31 @@
+package ut
+
+// ErrorResult describes where a mock method returns its error, so that
+// ReturnsError can prime it. Mocks generated by genmock describe each of their
+// methods that return an error.
+type ErrorResult struct {
+	// Index is the position of the error in the method's results
+	Index int
+	// Results is the number of results the method has
+	Results int
+}
+
+func (cr *callRecords) SetErrorResults(results map[string]ErrorResult) CallTracker {
+	cr.errorResults = results
+	return cr
+}
+
+func (cr *callRecords) ReturnsError(err error) CallTracker {
+	call := &cr.calls[len(cr.calls)-1]
+	er, ok := cr.errorResults[call.name]
+	if !ok {
+		cr.t.Fatalf("ReturnsError used for %s, which doesn't return an error", call.name)
+		return cr
+	}
+	returns := make([]interface{}, er.Results)
+	if err != nil {
+		returns[er.Index] = err
+	}
+	call.returns = returns
+	return cr
+}
@@ -0,0 +1,90 @@
+package ut
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// MockParser has error results in different positions, laid out as genmock
+// would
+type MockParser struct {
+	CallTracker
+}
+
+func NewMockParser(t testing.TB) *MockParser {
+	return &MockParser{NewCallRecords(t).SetErrorResults(map[string]ErrorResult{
+		"Parse": {Index: 1, Results: 2},
+		"Check": {Index: 0, Results: 2},
+	})}
+}
+
+func (m *MockParser) Parse(s string) (int, error) {
+	r := m.TrackCall("Parse", s)
+	r = FillReturns(m.CallTracker, "Parse", r, 2)
+	var r_0 int
+	if r[0] != nil {
+		r_0 = r[0].(int)
+	}
+	var r_1 error
+	if r[1] != nil {
+		r_1 = r[1].(error)
+	}
+	return r_0, r_1
+}
+
+func (m *MockParser) Check(s string) (error, bool) {
+	r := m.TrackCall("Check", s)
+	r = FillReturns(m.CallTracker, "Check", r, 2)
+	var r_0 error
+	if r[0] != nil {
+		r_0 = r[0].(error)
+	}
+	var r_1 bool
+	if r[1] != nil {
+		r_1 = r[1].(bool)
+	}
+	return r_0, r_1
+}
+
+func (m *MockParser) Reset() {
+	m.TrackCall("Reset")
+}
+
+func TestReturnsError(t *testing.T) {
+	m := NewMockParser(t)
+	bad := errors.New("bad")
+	m.AddCall("Parse", "x").ReturnsError(bad)
+	m.AddCall("Parse", "y").ReturnsError(nil)
+	m.AddCall("Check", "x").ReturnsError(bad)
+
+	if n, err := m.Parse("x"); n != 0 || err != bad {
+		t.Errorf("Parse returned %d, %v", n, err)
+	}
+	if n, err := m.Parse("y"); n != 0 || err != nil {
+		t.Errorf("Parse returned %d, %v", n, err)
+	}
+	if err, ok := m.Check("x"); err != bad || ok {
+		t.Errorf("Check returned %v, %t", err, ok)
+	}
+	m.AssertDone()
+}
+
+// fatalfRecorder is a testing.TB that records Fatalf rather than stopping the test
+type fatalfRecorder struct {
+	testing.TB
+	fatal string
+}
+
+func (f *fatalfRecorder) Fatalf(format string, args ...interface{}) {
+	f.fatal = fmt.Sprintf(format, args...)
+}
+
+func TestReturnsErrorNoError(t *testing.T) {
+	f := &fatalfRecorder{TB: t}
+	m := NewMockParser(f)
+	m.AddCall("Reset").ReturnsError(errors.New("bad"))
+	if f.fatal != "ReturnsError used for Reset, which doesn't return an error" {
+		t.Fatalf("Failure not as expected. Have %q", f.fatal)
+	}
+}
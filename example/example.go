@@ -1,7 +1,15 @@
 // +build ignore
 package example
 
-//go:generate genmock -package=github.com/philpearl/ut/example -interface=Fred -mock-package=example
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+)
+
+//go:generate genmock -package=github.com/philpearl/ut/example -interface=Fred -mock-package=example -declarative -matcher-helpers
+//go:generate genmock -package=github.com/philpearl/ut/example -interface=Conn -mock-package=example -io-backed
+//go:generate genmock -package=github.com/philpearl/ut/example -interface=Cache -mock-package=example
 
 type George struct {
 }
@@ -21,3 +29,37 @@ func DoSomething(f Fred) {
 		f.many("a", "b")
 	}
 }
+
+type Conn interface {
+	io.ReadWriter
+	Close() error
+}
+
+// Shout reads everything from the connection and writes it back in upper case
+func Shout(c Conn) error {
+	defer c.Close()
+	data, err := ioutil.ReadAll(c)
+	if err != nil {
+		return err
+	}
+	_, err = c.Write(bytes.ToUpper(data))
+	return err
+}
+
+// Cache is generic, so its mock is generic too
+type Cache[K comparable, V any] interface {
+	MGet(keys []K) (map[K]V, error)
+	MSet(items map[K]V) error
+}
+
+// Refresh reads the keys from the cache and writes them back with fn applied
+func Refresh[K comparable, V any](c Cache[K, V], keys []K, fn func(V) V) error {
+	items, err := c.MGet(keys)
+	if err != nil {
+		return err
+	}
+	for k, v := range items {
+		items[k] = fn(v)
+	}
+	return c.MSet(items)
+}
@@ -2,6 +2,8 @@ package example
 
 import (
 	"testing"
+
+	"github.com/philpearl/ut"
 )
 
 func TestDoSomething(t *testing.T) {
@@ -29,3 +31,83 @@ func TestDoSomethingElse(t *testing.T) {
 	// Check that all the calls are made
 	mf.AssertDone()
 }
+
+// Mocks take a testing.TB, so they can be used in benchmarks too
+func BenchmarkDoSomething(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		mf := NewMockFred(b)
+
+		mf.AddCall("sanit", "cheese")
+		mf.AddCall("doit", "lemons").SetReturns(3)
+
+		DoSomething(mf)
+
+		mf.AssertDone()
+	}
+}
+
+func TestDoSomethingMatchers(t *testing.T) {
+	mf := NewMockFred(t)
+
+	mf.Expectsanit(ut.MatchRegexp("^ch"))
+	mf.Expectdoit(ut.MatchRegexp("lemon")).doitReturns(5)
+	mf.Expectmany(ut.MatchRegexp("^a$"), ut.MatchRegexp("^b$"))
+
+	DoSomething(mf)
+
+	mf.AssertDone()
+}
+
+func TestDoSomethingDeclarative(t *testing.T) {
+	mf := NewMockFred(t)
+
+	mf.Expect([]MockFredCall{
+		{Method: "sanit", Args: []interface{}{"cheese"}},
+		{Method: "doit", Args: []interface{}{"lemons"}, Returns: []interface{}{5}},
+		{Method: "many", Args: []interface{}{"a", "b"}},
+	})
+
+	DoSomething(mf)
+
+	mf.AssertDone()
+}
+
+func TestMockWithoutConstructor(t *testing.T) {
+	defer func() {
+		if r := recover(); r != "MockFred used without NewMockFred" {
+			t.Fatalf("Panic not as expected. Have %v", r)
+		}
+	}()
+
+	mf := &MockFred{}
+	DoSomething(mf)
+}
+
+func TestShout(t *testing.T) {
+	m := NewMockConn(t).PrimeRead([]byte("hello"))
+	m.AddCall("Close").SetReturns(nil)
+
+	if err := Shout(m); err != nil {
+		t.Fatalf("Shout failed. %v", err)
+	}
+	if w := string(m.Written()); w != "HELLO" {
+		t.Fatalf("Expected HELLO to be written, have %q", w)
+	}
+
+	// Read and Write are recorded, so we can check how they were called
+	if writes, _ := m.GetRecordedParams("Write"); len(writes) != 1 {
+		t.Fatalf("Expected 1 write, have %d", len(writes))
+	}
+	m.AssertDone()
+}
+
+func TestRefresh(t *testing.T) {
+	m := NewMockCache[string, int](t)
+	m.AddCall("MGet", []string{"a", "b"}).SetReturns(map[string]int{"a": 1, "b": 2}, nil)
+	m.AddCall("MSet", map[string]int{"a": 2, "b": 3}).SetReturns(nil)
+
+	if err := Refresh[string, int](m, []string{"a", "b"}, func(v int) int { return v + 1 }); err != nil {
+		t.Fatalf("Refresh failed. %v", err)
+	}
+	m.AssertDone()
+}
@@ -0,0 +1,67 @@
+package example
+
+// THIS CODE IS AUTO-GENERATED BY genmock
+// github.com/philpearl/ut/genmock
+
+import (
+	"github.com/philpearl/ut"
+	"testing"
+)
+
+type MockCache[K comparable, V any] struct {
+	ut.CallTracker
+}
+
+func NewMockCache[K comparable, V any](t testing.TB) *MockCache[K, V] {
+	return &MockCache[K, V]{ut.NewCallRecords(t).SetErrorResults(map[string]ut.ErrorResult{"MGet": {Index: 1, Results: 2}, "MSet": {Index: 0, Results: 1}})}
+}
+
+func (m *MockCache[K, V]) AddCall(name string, params ...interface{}) ut.CallTracker {
+	m.CallTracker.AddCall(name, params...)
+	return m
+}
+
+func (m *MockCache[K, V]) SetReturns(params ...interface{}) ut.CallTracker {
+	m.CallTracker.SetReturns(params...)
+	return m
+}
+
+func (i *MockCache[K, V]) MGet(keys []K) (map[K]V, error) {
+	if i.CallTracker == nil {
+		panic("MockCache used without NewMockCache")
+	}
+	r := i.TrackCall("MGet", keys)
+	r = ut.FillReturns(i.CallTracker, "MGet", r, 2)
+	var r_0 map[K]V
+	if r[0] != nil {
+		r_0 = r[0].(map[K]V)
+	}
+	var r_1 error
+	if r[1] != nil {
+		r_1 = r[1].(error)
+	}
+	return r_0, r_1
+}
+
+func (m *MockCache[K, V]) MGetReturns(r0 map[K]V, r1 error) *MockCache[K, V] {
+	m.CallTracker.SetReturns(r0, r1)
+	return m
+}
+
+func (i *MockCache[K, V]) MSet(items map[K]V) error {
+	if i.CallTracker == nil {
+		panic("MockCache used without NewMockCache")
+	}
+	r := i.TrackCall("MSet", items)
+	r = ut.FillReturns(i.CallTracker, "MSet", r, 1)
+	var r_0 error
+	if r[0] != nil {
+		r_0 = r[0].(error)
+	}
+	return r_0
+}
+
+func (m *MockCache[K, V]) MSetReturns(r0 error) *MockCache[K, V] {
+	m.CallTracker.SetReturns(r0)
+	return m
+}
@@ -0,0 +1,88 @@
+package example
+
+// THIS CODE IS AUTO-GENERATED BY genmock
+// github.com/philpearl/ut/genmock
+
+import (
+	"bytes"
+	"github.com/philpearl/ut"
+	"sync"
+	"testing"
+)
+
+type MockConn struct {
+	ut.CallTracker
+	ioLock   sync.Mutex
+	readBuf  bytes.Buffer
+	writeBuf bytes.Buffer
+}
+
+func NewMockConn(t testing.TB) *MockConn {
+	m := &MockConn{CallTracker: ut.NewCallRecords(t).SetErrorResults(map[string]ut.ErrorResult{"Read": {Index: 1, Results: 2}, "Write": {Index: 1, Results: 2}, "Close": {Index: 0, Results: 1}})}
+	m.RecordCall("Read")
+	m.RecordCall("Write")
+	return m
+}
+
+func (m *MockConn) AddCall(name string, params ...interface{}) ut.CallTracker {
+	m.CallTracker.AddCall(name, params...)
+	return m
+}
+
+func (m *MockConn) SetReturns(params ...interface{}) ut.CallTracker {
+	m.CallTracker.SetReturns(params...)
+	return m
+}
+
+var _ Conn = (*MockConn)(nil)
+
+func (i *MockConn) Close() error {
+	if i.CallTracker == nil {
+		panic("MockConn used without NewMockConn")
+	}
+	r := i.TrackCall("Close")
+	r = ut.FillReturns(i.CallTracker, "Close", r, 1)
+	var r_0 error
+	if r[0] != nil {
+		r_0 = r[0].(error)
+	}
+	return r_0
+}
+
+func (m *MockConn) CloseReturns(r0 error) *MockConn {
+	m.CallTracker.SetReturns(r0)
+	return m
+}
+
+func (i *MockConn) Read(p []byte) (int, error) {
+	if i.CallTracker == nil {
+		panic("MockConn used without NewMockConn")
+	}
+	i.TrackCall("Read", p)
+	i.ioLock.Lock()
+	defer i.ioLock.Unlock()
+	return i.readBuf.Read(p)
+}
+
+func (m *MockConn) PrimeRead(data []byte) *MockConn {
+	m.ioLock.Lock()
+	defer m.ioLock.Unlock()
+	m.readBuf.Write(data)
+	return m
+}
+
+func (i *MockConn) Write(p []byte) (int, error) {
+	if i.CallTracker == nil {
+		panic("MockConn used without NewMockConn")
+	}
+	i.TrackCall("Write", p)
+	i.ioLock.Lock()
+	defer i.ioLock.Unlock()
+	return i.writeBuf.Write(p)
+}
+
+func (m *MockConn) Written() []byte {
+	m.ioLock.Lock()
+	defer m.ioLock.Unlock()
+	return append([]byte(nil), m.writeBuf.Bytes()...)
+}
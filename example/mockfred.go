@@ -12,8 +12,8 @@ type MockFred struct {
 	ut.CallTracker
 }
 
-func NewMockFred(t *testing.T) *MockFred {
-	return &MockFred{ut.NewCallRecords(t)}
+func NewMockFred(t testing.TB) *MockFred {
+	return &MockFred{ut.NewCallRecords(t).SetErrorResults(map[string]ut.ErrorResult{"donit": {Index: 1, Results: 2}, "adonit": {Index: 1, Results: 2}})}
 }
 
 func (m *MockFred) AddCall(name string, params ...interface{}) ut.CallTracker {
@@ -25,12 +25,61 @@ func (m *MockFred) SetReturns(params ...interface{}) ut.CallTracker {
 	m.CallTracker.SetReturns(params...)
 	return m
 }
-func (i *MockFred) sanit(blah string) { i.TrackCall("sanit", blah); return }
 
-func (i *MockFred) iit(fred interface{}) { i.TrackCall("iit", fred); return }
+var _ Fred = (*MockFred)(nil)
 
-func (i *MockFred) many(
-	things ...string) {
+type MockFredCall struct {
+	Method  string
+	Args    []interface{}
+	Returns []interface{}
+}
+
+func (m *MockFred) Expect(calls []MockFredCall) *MockFred {
+	for _, c := range calls {
+		m.CallTracker.AddCall(c.Method, c.Args...)
+		m.CallTracker.SetReturns(c.Returns...)
+	}
+	return m
+}
+
+func (i *MockFred) sanit(blah string) {
+	if i.CallTracker == nil {
+		panic("MockFred used without NewMockFred")
+	}
+	i.TrackCall("sanit", blah)
+	return
+}
+
+func (m *MockFred) Expectsanit(matchers ...ut.Matcher) *MockFred {
+	params := make([]interface{}, len(matchers))
+	for i, matcher := range matchers {
+		params[i] = matcher
+	}
+	m.CallTracker.AddCall("sanit", params...)
+	return m
+}
+
+func (i *MockFred) iit(fred interface{}) {
+	if i.CallTracker == nil {
+		panic("MockFred used without NewMockFred")
+	}
+	i.TrackCall("iit", fred)
+	return
+}
+
+func (m *MockFred) Expectiit(matchers ...ut.Matcher) *MockFred {
+	params := make([]interface{}, len(matchers))
+	for i, matcher := range matchers {
+		params[i] = matcher
+	}
+	m.CallTracker.AddCall("iit", params...)
+	return m
+}
+
+func (i *MockFred) many(things ...string) {
+	if i.CallTracker == nil {
+		panic("MockFred used without NewMockFred")
+	}
 	ut__params := make([]interface{}, 0+len(things))
 	for j, p := range things {
 		ut__params[0+j] = p
@@ -39,8 +88,21 @@ func (i *MockFred) many(
 	return
 }
 
+func (m *MockFred) Expectmany(matchers ...ut.Matcher) *MockFred {
+	params := make([]interface{}, len(matchers))
+	for i, matcher := range matchers {
+		params[i] = matcher
+	}
+	m.CallTracker.AddCall("many", params...)
+	return m
+}
+
 func (i *MockFred) doit(blah string) int {
+	if i.CallTracker == nil {
+		panic("MockFred used without NewMockFred")
+	}
 	r := i.TrackCall("doit", blah)
+	r = ut.FillReturns(i.CallTracker, "doit", r, 1)
 	var r_0 int
 	if r[0] != nil {
 		r_0 = r[0].(int)
@@ -48,9 +110,26 @@ func (i *MockFred) doit(blah string) int {
 	return r_0
 }
 
+func (m *MockFred) doitReturns(r0 int) *MockFred {
+	m.CallTracker.SetReturns(r0)
+	return m
+}
+
+func (m *MockFred) Expectdoit(matchers ...ut.Matcher) *MockFred {
+	params := make([]interface{}, len(matchers))
+	for i, matcher := range matchers {
+		params[i] = matcher
+	}
+	m.CallTracker.AddCall("doit", params...)
+	return m
+}
+
 func (i *MockFred) donit(blah, fah string) (int, error) {
-	r := i.TrackCall("donit", blah,
-		fah)
+	if i.CallTracker == nil {
+		panic("MockFred used without NewMockFred")
+	}
+	r := i.TrackCall("donit", blah, fah)
+	r = ut.FillReturns(i.CallTracker, "donit", r, 2)
 	var r_0 int
 	if r[0] != nil {
 		r_0 = r[0].(int)
@@ -61,9 +140,27 @@ func (i *MockFred) donit(blah, fah string) (int, error) {
 	}
 	return r_0, r_1
 }
+
+func (m *MockFred) donitReturns(r0 int, r1 error) *MockFred {
+	m.CallTracker.SetReturns(r0, r1)
+	return m
+}
+
+func (m *MockFred) Expectdonit(matchers ...ut.Matcher) *MockFred {
+	params := make([]interface{}, len(matchers))
+	for i, matcher := range matchers {
+		params[i] = matcher
+	}
+	m.CallTracker.AddCall("donit", params...)
+	return m
+}
+
 func (i *MockFred) adonit(blah, fah George, brian func(int) error) (int, error) {
-	r := i.TrackCall("adonit", blah,
-		fah, brian)
+	if i.CallTracker == nil {
+		panic("MockFred used without NewMockFred")
+	}
+	r := i.TrackCall("adonit", blah, fah, brian)
+	r = ut.FillReturns(i.CallTracker, "adonit", r, 2)
 	var r_0 int
 	if r[0] != nil {
 		r_0 = r[0].(int)
@@ -74,3 +171,17 @@ func (i *MockFred) adonit(blah, fah George, brian func(int) error) (int, error)
 	}
 	return r_0, r_1
 }
+
+func (m *MockFred) adonitReturns(r0 int, r1 error) *MockFred {
+	m.CallTracker.SetReturns(r0, r1)
+	return m
+}
+
+func (m *MockFred) Expectadonit(matchers ...ut.Matcher) *MockFred {
+	params := make([]interface{}, len(matchers))
+	for i, matcher := range matchers {
+		params[i] = matcher
+	}
+	m.CallTracker.AddCall("adonit", params...)
+	return m
+}
@@ -0,0 +1,44 @@
+package ut
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var formatters = struct {
+	sync.RWMutex
+	m map[reflect.Type]func(interface{}) string
+}{
+	m: make(map[reflect.Type]func(interface{}) string),
+}
+
+// SetFormatter registers a function used to show values of type typ in
+// failure messages, in place of the default %#v. Use it when a parameter type
+// has a noisy representation. Pass a nil fn to remove the formatter.
+//
+//	ut.SetFormatter(reflect.TypeOf(&Request{}), func(v interface{}) string {
+//		return "Request " + v.(*Request).ID
+//	})
+func SetFormatter(typ reflect.Type, fn func(interface{}) string) {
+	formatters.Lock()
+	defer formatters.Unlock()
+	if fn == nil {
+		delete(formatters.m, typ)
+		return
+	}
+	formatters.m[typ] = fn
+}
+
+// formatValue shows a value in a failure message
+func formatValue(v interface{}) string {
+	if v != nil {
+		formatters.RLock()
+		fn, ok := formatters.m[reflect.TypeOf(v)]
+		formatters.RUnlock()
+		if ok {
+			return fn(v)
+		}
+	}
+	return fmt.Sprintf("%#v", v)
+}
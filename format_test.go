@@ -0,0 +1,45 @@
+package ut
+
+import (
+	"reflect"
+	"testing"
+)
+
+type noisy struct {
+	ID   string
+	blob []byte
+}
+
+func TestSetFormatter(t *testing.T) {
+	typ := reflect.TypeOf(&noisy{})
+	SetFormatter(typ, func(v interface{}) string {
+		return "noisy " + v.(*noisy).ID
+	})
+	defer SetFormatter(typ, nil)
+
+	l := &logRecorder{TB: &failRecorder{TB: t}}
+	ct := NewCallRecords(l)
+	ct.AddCall("Send", &noisy{ID: "a", blob: make([]byte, 100)})
+	ct.TrackCall("Send", &noisy{ID: "b", blob: make([]byte, 100)})
+
+	if len(l.logs) < 3 {
+		t.Fatalf("Expected failure logs. %q", l.logs)
+	}
+	exp := []string{
+		"Call to Send parameter 0 unexpected",
+		"  expected noisy a (*ut.noisy)",
+		"       got noisy b (*ut.noisy)",
+	}
+	if !reflect.DeepEqual(l.logs[:3], exp) {
+		t.Fatalf("Logs not as expected. %q", l.logs)
+	}
+
+	if s := paramsToString([]interface{}{&noisy{ID: "c"}, 37}); s != "(noisy c, 37)" {
+		t.Fatalf("Params not as expected. Have %s", s)
+	}
+
+	SetFormatter(typ, nil)
+	if s := formatValue(noisy{ID: "d"}); s != `ut.noisy{ID:"d", blob:[]uint8(nil)}` {
+		t.Fatalf("Formatter should only apply to its own type. Have %s", s)
+	}
+}
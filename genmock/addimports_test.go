@@ -102,3 +102,45 @@ func buildImport(path, name string) *ast.ImportSpec {
 	}
 	return is
 }
+
+func TestNestedSelectors(t *testing.T) {
+	// a.b.C can't be parsed as a type, so we build it by hand
+	nested := &ast.SelectorExpr{
+		X: &ast.SelectorExpr{
+			X:   ast.NewIdent("a"),
+			Sel: ast.NewIdent("b"),
+		},
+		Sel: ast.NewIdent("C"),
+	}
+
+	if id := selectorRoot(nested); id == nil || id.Name != "a" {
+		t.Fatalf("Root of nested selector not as expected. Have %v", id)
+	}
+
+	fi := newFindUsedImports()
+	ast.Walk(fi, nested)
+	if !fi.isUsed(buildImport("example.com/a", "")) {
+		t.Fatalf("Import a should be used")
+	}
+
+	f := &ast.File{
+		Name: ast.NewIdent("mocks"),
+		Decls: []ast.Decl{
+			&ast.FuncDecl{
+				Name: ast.NewIdent("F"),
+				Type: &ast.FuncType{
+					Params: &ast.FieldList{
+						List: []*ast.Field{{Names: []*ast.Ident{ast.NewIdent("p")}, Type: nested}},
+					},
+				},
+			},
+		},
+	}
+	err := checkTypesImported(f, nil)
+	if err == nil || err.Error() != "method F uses type a.b.C but package a is not imported" {
+		t.Fatalf("Error not as expected. Have %v", err)
+	}
+	if err := checkTypesImported(f, []*ast.ImportSpec{buildImport("example.com/a", "")}); err != nil {
+		t.Fatalf("Unexpected error. %v", err)
+	}
+}
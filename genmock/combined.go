@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"regexp"
+	"strings"
+)
+
+// With -single-mock, one mock implements several interfaces. The interfaces
+// are named as a comma separated list by -interface, and their methods are
+// combined into a single interface that the mock is built from.
+//
+//	genmock -package=. -interface=Reader,Closer -single-mock=MockReadCloser
+
+// interfacesPattern matches exactly the named interfaces
+func interfacesPattern(names []string) *regexp.Regexp {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = regexp.QuoteMeta(name)
+	}
+	return regexp.MustCompile("^(" + strings.Join(quoted, "|") + ")$")
+}
+
+// combineInterfaces builds an interface with the methods of each of the named
+// interfaces, in the order the interfaces are named. A method in more than
+// one interface is only included once, and must have the same signature in
+// each.
+func combineInterfaces(names []string, matched []namedInterface) (*ast.InterfaceType, error) {
+	found := make(map[string]namedInterface, len(matched))
+	for _, ni := range matched {
+		found[ni.name] = ni
+	}
+
+	combined := &ast.InterfaceType{Methods: &ast.FieldList{}}
+	// Which interface each method came from, and its signature
+	owners := make(map[string]string)
+	signatures := make(map[string]string)
+	embedded := make(map[string]struct{})
+	for _, name := range names {
+		ni, ok := found[name]
+		if !ok {
+			return nil, fmt.Errorf("could not find interface %s", name)
+		}
+		if ni.typeParams.NumFields() != 0 {
+			return nil, fmt.Errorf("%s is generic, so can't be combined with other interfaces", name)
+		}
+
+		for _, m := range ni.interfaceType.Methods.List {
+			ft, ok := m.Type.(*ast.FuncType)
+			if !ok {
+				// Embedded types shared by the interfaces are only kept once
+				key := types.ExprString(m.Type)
+				if _, ok := embedded[key]; !ok {
+					embedded[key] = struct{}{}
+					combined.Methods.List = append(combined.Methods.List, m)
+				}
+				continue
+			}
+
+			sig := signature(ft)
+			var keep []*ast.Ident
+			for _, n := range m.Names {
+				if owner, ok := owners[n.Name]; ok {
+					if signatures[n.Name] != sig {
+						return nil, fmt.Errorf("%s and %s both have a method %s, but with different signatures", owner, name, n.Name)
+					}
+					continue
+				}
+				owners[n.Name] = name
+				signatures[n.Name] = sig
+				keep = append(keep, n)
+			}
+			if len(keep) != 0 {
+				combined.Methods.List = append(combined.Methods.List, &ast.Field{Names: keep, Type: ft})
+			}
+		}
+	}
+	return combined, nil
+}
+
+// signature describes the parameter and result types of a method, ignoring
+// their names
+func signature(ft *ast.FuncType) string {
+	return "(" + fieldTypes(ft.Params) + ") (" + fieldTypes(ft.Results) + ")"
+}
+
+func fieldTypes(fl *ast.FieldList) string {
+	if fl == nil {
+		return ""
+	}
+	var typs []string
+	for _, f := range fl.List {
+		typ := types.ExprString(f.Type)
+		typs = append(typs, typ)
+		for i := 1; i < len(f.Names); i++ {
+			typs = append(typs, typ)
+		}
+	}
+	return strings.Join(typs, ", ")
+}
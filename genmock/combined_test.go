@@ -0,0 +1,138 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"strings"
+	"testing"
+)
+
+const combinedSource = `
+package blah
+
+import "context"
+
+type Reader interface {
+	Read(ctx context.Context, key string) ([]byte, error)
+	Close() error
+}
+
+type Writer interface {
+	Write(ctx context.Context, key string, data []byte) error
+	Close() error
+}
+
+type Lister interface {
+	List(ctx context.Context) (keys []string, err error)
+	Read(c context.Context, k string) ([]byte, error)
+}
+
+type Other interface {
+	Close()
+}
+
+type Box[T any] interface {
+	Get() T
+}
+`
+
+// combineFromSource combines the named interfaces in the source
+func combineFromSource(t *testing.T, names ...string) (*ast.InterfaceType, *InterfaceVisitor, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), "source.go", combinedSource, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse source. %v", err)
+	}
+	v := &InterfaceVisitor{pattern: interfacesPattern(names)}
+	ast.Walk(v, f)
+	it, err := combineInterfaces(names, v.matched)
+	return it, v, err
+}
+
+func TestSingleMock(t *testing.T) {
+	names := []string{"Reader", "Writer", "Lister"}
+	it, v, err := combineFromSource(t, names...)
+	if err != nil {
+		t.Fatalf("Failed to combine interfaces. %v", err)
+	}
+
+	o := &options{
+		ifName:        "Reader,Writer,Lister",
+		ifNames:       names,
+		mockName:      "MockStore",
+		targetPackage: "blah",
+		srcPackage:    v.pkgName,
+	}
+	code, err := buildMockForInterface(o, it, v.imports, v.localTypes)
+	if err != nil {
+		t.Fatalf("Failed to build mock. %v", err)
+	}
+
+	assertContains(t, code,
+		"func NewMockStore(t testing.TB) *MockStore {",
+		"func (i *MockStore) Read(ctx context.Context, key string) ([]byte, error) {",
+		"func (i *MockStore) Close() error {",
+		"func (i *MockStore) Write(ctx context.Context, key string, data []byte) error {",
+		"func (i *MockStore) List(ctx context.Context) ([]string, error) {",
+		"var _ Reader = (*MockStore)(nil)",
+		"var _ Writer = (*MockStore)(nil)",
+		"var _ Lister = (*MockStore)(nil)",
+	)
+	for _, method := range []string{"Read", "Close"} {
+		if c := strings.Count(code, "func (i *MockStore) "+method+"("); c != 1 {
+			t.Errorf("Expected one %s method, have %d\n%s", method, c, code)
+		}
+	}
+}
+
+func TestSingleMockErrors(t *testing.T) {
+	tests := []struct {
+		names []string
+		err   string
+	}{
+		{names: []string{"Reader", "Other"}, err: "Reader and Other both have a method Close, but with different signatures"},
+		{names: []string{"Reader", "Missing"}, err: "could not find interface Missing"},
+		{names: []string{"Reader", "Box"}, err: "Box is generic, so can't be combined with other interfaces"},
+	}
+
+	for i, test := range tests {
+		_, _, err := combineFromSource(t, test.names...)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("Test %d, error not as expected. Have %v", i, err)
+		}
+	}
+}
+
+func TestSingleMockOptions(t *testing.T) {
+	o := &options{
+		packagePath:   "source.go",
+		ifName:        "Reader, Writer",
+		singleMock:    "MockStore",
+		targetPackage: "blah",
+		format:        "gofmt",
+	}
+	if !o.validate() {
+		t.Fatalf("Expected options to be valid")
+	}
+	if o.mockName != "MockStore" || o.outfile != "mockstore.go" {
+		t.Errorf("Defaults not as expected. Have mock %s, outfile %s", o.mockName, o.outfile)
+	}
+	if names := o.interfaceNames(); len(names) != 2 || names[0] != "Reader" || names[1] != "Writer" {
+		t.Errorf("Interface names not as expected. Have %q", names)
+	}
+
+	o = &options{
+		packagePath:   "source.go",
+		ifName:        "Reader,S.H",
+		singleMock:    "MockStore",
+		targetPackage: "blah",
+		format:        "gofmt",
+	}
+	var w strings.Builder
+	errOutput = &w
+	defer func() { errOutput = os.Stderr }()
+	if o.validate() {
+		t.Fatalf("Expected an inline interface path to be rejected")
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// assertCompiles writes the files into a temporary GOPATH, alongside this copy
+// of ut, and checks go vet is happy with the package at pkgPath. files are
+// keyed by their path within the GOPATH's src directory. It runs the go tool,
+// so is slow and is skipped with -short.
+func assertCompiles(t *testing.T, pkgPath string, files map[string]string) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("Skipping compiling mocks with -short")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("Skipping compiling mocks as the go tool isn't on the path")
+	}
+
+	dir, err := ioutil.TempDir("", "genmock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	utDir, err := filepath.Abs("..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "src", "github.com", "philpearl", "ut")
+	if err := os.MkdirAll(filepath.Dir(link), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(utDir, link); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, "src", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := exec.Command(goTool, "vet", "./"+pkgPath)
+	cmd.Dir = filepath.Join(dir, "src")
+	cmd.Env = append(os.Environ(), "GOPATH="+dir, "GO111MODULE=off", "GOFLAGS=")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("Mock does not compile. %v\n%s", err, out)
+		for name, content := range files {
+			t.Logf("%s:\n%s", name, content)
+		}
+	}
+}
+
+func TestMocksCompile(t *testing.T) {
+	tests := []struct {
+		name   string
+		ifName string
+		src    string
+		// other packages the source imports, keyed by file path
+		others map[string]string
+	}{
+		{
+			name:   "nested func types",
+			ifName: "Watcher",
+			src: `
+package blah
+
+type Event struct{}
+
+type Watcher interface {
+	OnEvent(cb func(Event) (bool, error))
+	Convert(f func(int) (s string, err error)) func(string) (int, error)
+}
+`,
+		},
+		{
+			name:   "generic type arguments",
+			ifName: "Loader",
+			src: `
+package blah
+
+import (
+	"example.com/cache"
+	"time"
+)
+
+type Loader interface {
+	Load(c cache.Cache[string, []byte], ttl map[string]time.Duration) (cache.Entry[string, []time.Time], error)
+}
+`,
+			others: map[string]string{
+				"example.com/cache/cache.go": `
+package cache
+
+type Cache[K comparable, V any] struct{}
+
+type Entry[K comparable, V any] struct{}
+`,
+			},
+		},
+		{
+			name:   "generic interface",
+			ifName: "Mapper",
+			src: `
+package blah
+
+type Item struct{}
+
+type Mapper[T any, K comparable] interface {
+	Fn() func(T) T
+	Key(item T) (K, error)
+	Items(keys ...K) map[K]Item
+}
+`,
+		},
+		{
+			name:   "pointer to generic local type",
+			ifName: "Maker",
+			src: `
+package blah
+
+type Box[T any] struct {
+	v T
+}
+
+type Pair[K comparable, V any] struct{}
+
+type Maker[T any] interface {
+	Make() *Box[T]
+	Both(b *Box[T]) (*Pair[string, *Box[T]], error)
+}
+`,
+		},
+		{
+			name:   "variadic local type",
+			ifName: "Putter",
+			src: `
+package blah
+
+type Local struct{}
+
+type Putter interface {
+	Put(keys ...Local) error
+	PutAll(fn func(...*Local), keys ...[]Local)
+}
+`,
+		},
+		{
+			name:   "slice of self",
+			ifName: "Node",
+			src: `
+package blah
+
+type Node interface {
+	Parent() Node
+	Children() []Node
+	Siblings() [2]Node
+	Named() map[string][]Node
+	Walk(fn func(Node) []Node) ([]*Node, error)
+}
+`,
+		},
+		{
+			name:   "generic composite params",
+			ifName: "Cache",
+			src: `
+package blah
+
+type Cache[K comparable, V any] interface {
+	MGet(keys []K) (map[K]V, error)
+	MSet(items map[K]V) error
+	Keys() [][]K
+}
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Build the mock both in the interface's package and in another
+			for _, inPackage := range []bool{true, false} {
+				o := &options{ifName: test.ifName, targetPackage: "blah"}
+				mockFile := "example.com/blah/mock.go"
+				if !inPackage {
+					o = &options{
+						ifName:        test.ifName,
+						targetPackage: "mocks",
+						pkg:           &build.Package{ImportPath: "example.com/blah"},
+					}
+					mockFile = "example.com/mocks/mock.go"
+				}
+				code := generateWithOptions(t, o, test.src, test.ifName)
+
+				files := map[string]string{
+					"example.com/blah/source.go": test.src,
+					mockFile:                     code,
+				}
+				for name, content := range test.others {
+					files[name] = content
+				}
+				assertCompiles(t, filepath.Dir(mockFile), files)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+)
+
+// buildDeclarativeHelpers builds a type describing an expected call and an
+// Expect method that adds a list of them, so expectations can be set up as a
+// single struct literal.
+//
+//	m.Expect([]MockFooCall{
+//		{Method: "Get", Args: []interface{}{1}, Returns: []interface{}{"a"}},
+//		{Method: "Close"},
+//	})
+func buildDeclarativeHelpers(o *options) ([]ast.Decl, error) {
+	callType := o.mockName + "Call"
+	mockType := o.mockType()
+	code := fmt.Sprintf(`
+type %s struct {
+	Method  string
+	Args    []interface{}
+	Returns []interface{}
+}
+
+func (m *%s) Expect(calls []%s) *%s {
+	for _, c := range calls {
+		m.CallTracker.AddCall(c.Method, c.Args...)
+		m.CallTracker.SetReturns(c.Returns...)
+	}
+	return m
+}
+`,
+		callType,
+		mockType, callType, mockType,
+	)
+
+	return parseDecls(code)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDeclarative(t *testing.T) {
+	src := `
+package blah
+
+type Store interface {
+	Get(id int) (string, error)
+	Close()
+}
+`
+	code := generateWithOptions(t, &options{declarative: true}, src, "Store")
+	assertContains(t, code,
+		"type MockStoreCall struct { Method string Args []interface{} Returns []interface{} }",
+		"func (m *MockStore) Expect(calls []MockStoreCall) *MockStore {",
+		"m.CallTracker.AddCall(c.Method, c.Args...)",
+		"m.CallTracker.SetReturns(c.Returns...)",
+	)
+
+	code = generateFromSource(t, src, "Store")
+	if strings.Contains(code, "MockStoreCall") {
+		t.Fatalf("Declarative helpers should not be generated by default\n%s", code)
+	}
+}
+
+func TestDeclarativeExpectMethod(t *testing.T) {
+	var w bytes.Buffer
+	warnOutput = &w
+	defer func() { warnOutput = os.Stderr }()
+
+	code := generateWithOptions(t, &options{ifName: "Waiter", declarative: true}, `
+package blah
+
+type Waiter interface {
+	Expect(n int) bool
+}
+`, "Waiter")
+
+	if strings.Contains(code, "MockWaiterCall") {
+		t.Fatalf("Declarative helpers should not be generated\n%s", code)
+	}
+	if w.String() != "genmock: warning: Waiter already has an Expect method, so -declarative is ignored\n" {
+		t.Fatalf("Warning not as expected. Have %q", w.String())
+	}
+}
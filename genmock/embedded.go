@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"strings"
+)
+
+/*
+An interface can embed other interfaces, and gets their methods as its own
+
+	type ReadWriter interface {
+		Reader
+		io.Writer
+	}
+
+The embedded interfaces show up in the interface's method list as Fields with
+no Names, whose Type is an Ident for a local interface, or a SelectorExpr for
+one from an imported package. The mock needs their methods, so we find each
+embedded interface's declaration and put its methods in its place. Interfaces
+they embed in turn are flattened the same way.
+
+Types used by methods from another package are relative to that package, so
+we qualify its types with the name the package is imported by, and add the
+imports its methods use to the mock's.
+*/
+
+// embedPackage is a package we're finding embedded interfaces in
+type embedPackage struct {
+	// path is the package's import path, and is empty for the source package
+	path string
+	// dir is the package's directory, which its imports are found from
+	dir        string
+	imports    []*ast.ImportSpec
+	interfaces map[string]*ast.InterfaceType
+	// types are the names of the types the package declares
+	types map[string]struct{}
+}
+
+// flattener gathers the methods of an interface and those it embeds
+type flattener struct {
+	methods map[string]*ast.FuncType
+	// imports are those of the other packages we've taken methods from
+	imports []*ast.ImportSpec
+	// external are the methods we've taken from other packages
+	external []ast.Node
+}
+
+// flattenEmbedded returns the interface with the interfaces it embeds
+// replaced by their methods, along with the imports those methods need. A
+// method that is embedded more than once is only included once, which Go
+// allows if it has the same signature each time. Embedded types we can't
+// find, such as generic interfaces, are left in place.
+func flattenEmbedded(o *options, t *ast.InterfaceType, imports []*ast.ImportSpec) (*ast.InterfaceType, []*ast.ImportSpec, error) {
+	if !hasEmbedded(t) {
+		return t, imports, nil
+	}
+
+	src := &embedPackage{
+		dir:        o.srcDir(),
+		imports:    imports,
+		interfaces: o.srcInterfaces,
+	}
+	f := &flattener{methods: make(map[string]*ast.FuncType)}
+	list, err := f.flatten(src, nil, o.ifName, t, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	imports, err = f.mergeImports(imports)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &ast.InterfaceType{Methods: &ast.FieldList{List: list}}, imports, nil
+}
+
+// hasEmbedded indicates whether the interface embeds anything
+func hasEmbedded(t *ast.InterfaceType) bool {
+	for _, m := range t.Methods.List {
+		if _, ok := m.Type.(*ast.FuncType); !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// flatten returns the methods of interface t, which is called name and
+// declared in package p. The package's types are qualified with pkg, unless
+// pkg is nil. stack lists the interfaces we're already flattening, so we
+// don't go round in circles.
+func (f *flattener) flatten(p *embedPackage, pkg *ast.Ident, name string, t *ast.InterfaceType, stack []string) ([]*ast.Field, error) {
+	key := p.path + "." + name
+	for _, s := range stack {
+		if s == key {
+			return nil, fmt.Errorf("%s embeds itself", name)
+		}
+	}
+	stack = append(stack, key)
+
+	var list []*ast.Field
+	for _, m := range t.Methods.List {
+		ft, ok := m.Type.(*ast.FuncType)
+		if !ok {
+			fields, err := f.embedded(p, pkg, m, stack)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, fields...)
+			continue
+		}
+
+		if pkg != nil {
+			qualifyPackageTypes(ft, p.types, pkg)
+			f.external = append(f.external, ft)
+		}
+
+		// Methods already included are left out
+		var names []*ast.Ident
+		for _, n := range m.Names {
+			if have, ok := f.methods[n.Name]; ok {
+				if signature(have) != signature(ft) {
+					return nil, fmt.Errorf("%s has more than one method %s, with signatures %s and %s", name, n.Name, signature(have), signature(ft))
+				}
+				continue
+			}
+			f.methods[n.Name] = ft
+			names = append(names, n)
+		}
+		switch {
+		case len(names) == len(m.Names):
+			list = append(list, m)
+		case len(names) > 0:
+			list = append(list, &ast.Field{Names: names, Type: ft})
+		}
+	}
+	return list, nil
+}
+
+// embedded returns the methods of an interface embedded in package p. If we
+// can't find the interface the embedded field is returned unchanged.
+func (f *flattener) embedded(p *embedPackage, pkg *ast.Ident, m *ast.Field, stack []string) ([]*ast.Field, error) {
+	switch typ := m.Type.(type) {
+	case *ast.Ident:
+		if t, ok := p.interfaces[typ.Name]; ok {
+			return f.flatten(p, pkg, typ.Name, t, stack)
+		}
+	case *ast.SelectorExpr:
+		x, ok := typ.X.(*ast.Ident)
+		if !ok {
+			break
+		}
+		is := findImport(p.imports, x.Name)
+		if is == nil {
+			break
+		}
+		ep, err := loadEmbedPackage(strings.Trim(is.Path.Value, "\""), p.dir)
+		if err != nil {
+			warnf("Could not find the methods of %s. %v", types.ExprString(typ), err)
+			break
+		}
+		t, ok := ep.interfaces[typ.Sel.Name]
+		if !ok {
+			break
+		}
+		if p.path != "" {
+			f.imports = append(f.imports, is)
+		}
+		f.imports = append(f.imports, ep.imports...)
+		return f.flatten(ep, x, typ.Sel.Name, t, stack)
+	}
+	return []*ast.Field{m}, nil
+}
+
+// mergeImports adds the imports used by methods from other packages to the
+// source's imports. It's an error if one of these imports has the same name as
+// a different package the source imports.
+func (f *flattener) mergeImports(imports []*ast.ImportSpec) ([]*ast.ImportSpec, error) {
+	used := newFindUsedImports()
+	for _, n := range f.external {
+		ast.Walk(used, n)
+	}
+	for _, is := range f.imports {
+		if !used.isUsed(is) {
+			continue
+		}
+		name := importName(is)
+		if have := findImport(imports, name); have != nil {
+			if have.Path.Value != is.Path.Value {
+				return nil, fmt.Errorf("embedded methods need %s imported as %s, which clashes with the import of %s", is.Path.Value, name, have.Path.Value)
+			}
+			continue
+		}
+		imports = append(imports, is)
+	}
+	return imports, nil
+}
+
+// findImport returns the import with the given name, or nil if there isn't
+// one
+func findImport(imports []*ast.ImportSpec, name string) *ast.ImportSpec {
+	for _, is := range imports {
+		if importName(is) == name {
+			return is
+		}
+	}
+	return nil
+}
+
+// loadEmbedPackage parses the Go files of the package with the import path,
+// found from dir, to find the interfaces it declares
+func loadEmbedPackage(path, dir string) (*embedPackage, error) {
+	bp, err := build.Import(path, dir, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	v := &InterfaceVisitor{}
+	for _, name := range bp.GoFiles {
+		file, err := parser.ParseFile(fset, filepath.Join(bp.Dir, name), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		ast.Walk(v, file)
+	}
+	return &embedPackage{
+		path:       bp.ImportPath,
+		dir:        bp.Dir,
+		imports:    v.imports,
+		interfaces: v.interfaces,
+		types:      v.localTypes,
+	}, nil
+}
+
+// qualifyPackageTypes qualifies the types a method uses that are declared in
+// its own package, as the method is going into a mock in another package
+func qualifyPackageTypes(ft *ast.FuncType, pkgTypes map[string]struct{}, pkg *ast.Ident) {
+	q := &typeQualifier{
+		pkg: pkg,
+		needs: func(id *ast.Ident) bool {
+			_, ok := pkgTypes[id.Name]
+			return ok
+		},
+	}
+	q.typeExpr(ft)
+}
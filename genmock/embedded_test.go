@@ -0,0 +1,209 @@
+package main
+
+import (
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestEmbeddedInterfaces(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		exp  []string
+	}{
+		{
+			name: "local",
+			src: `
+package blah
+
+type Item struct{}
+
+type Getter interface {
+	Get(key string) (Item, error)
+}
+
+type Store interface {
+	Getter
+	Put(key string, item Item) error
+}
+`,
+			exp: []string{
+				"func (i *MockStore) Get(key string) (Item, error) {",
+				"func (i *MockStore) Put(key string, item Item) error {",
+				"var _ Store = (*MockStore)(nil)",
+			},
+		},
+		{
+			name: "transitive",
+			src: `
+package blah
+
+type Getter interface {
+	Get(key string) string
+}
+
+type Lister interface {
+	Getter
+	List() []string
+}
+
+type Store interface {
+	Lister
+	Put(key, value string)
+}
+`,
+			exp: []string{
+				"func (i *MockStore) Get(key string) string {",
+				"func (i *MockStore) List() []string {",
+				"func (i *MockStore) Put(key, value string) {",
+			},
+		},
+		{
+			name: "other package",
+			src: `
+package blah
+
+import "net/http"
+
+type Handler interface {
+	http.Handler
+	Close() error
+}
+`,
+			exp: []string{
+				`"net/http"`,
+				"func (i *MockHandler) ServeHTTP(p0 http.ResponseWriter, p1 *http.Request) {",
+				`i.TrackCall("ServeHTTP", p0, p1)`,
+				"func (i *MockHandler) Close() error {",
+			},
+		},
+		{
+			name: "other package transitive",
+			src: `
+package blah
+
+import "io"
+
+type Conn interface {
+	io.ReadWriteCloser
+}
+`,
+			exp: []string{
+				"func (i *MockConn) Read(p []byte) (int, error) {",
+				"func (i *MockConn) Write(p []byte) (int, error) {",
+				"func (i *MockConn) Close() error {",
+			},
+		},
+		{
+			name: "other package imports",
+			src: `
+package blah
+
+import "database/sql/driver"
+
+type Connector interface {
+	driver.Connector
+}
+`,
+			exp: []string{
+				`"context"`,
+				`"database/sql/driver"`,
+				"func (i *MockConnector) Connect(p0 context.Context) (driver.Conn, error) {",
+				"func (i *MockConnector) Driver() driver.Driver {",
+			},
+		},
+		{
+			name: "renamed import",
+			src: `
+package blah
+
+import stdio "io"
+
+type Closer interface {
+	stdio.Closer
+	Name() string
+}
+`,
+			exp: []string{
+				"func (i *MockCloser) Close() error {",
+				"func (i *MockCloser) Name() string {",
+			},
+		},
+		{
+			name: "deduplicated",
+			src: `
+package blah
+
+import "io"
+
+type Reader interface {
+	io.Reader
+	Close() error
+}
+
+type ReadCloser interface {
+	Reader
+	io.ReadCloser
+}
+`,
+			exp: []string{
+				"func (i *MockReadCloser) Read(p []byte) (int, error) {",
+				"func (i *MockReadCloser) Close() error {",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := parser.ParseFile(token.NewFileSet(), "source.go", test.src, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ifName := ""
+			for _, d := range f.Decls {
+				if gd, ok := d.(*ast.GenDecl); ok && gd.Tok == token.TYPE {
+					ifName = gd.Specs[0].(*ast.TypeSpec).Name.Name
+				}
+			}
+			pkg := &build.Package{Name: "blah", ImportPath: "example.com/blah"}
+			code := generateWithOptions(t, &options{ifName: ifName, targetPackage: "blah", pkg: pkg}, test.src, ifName)
+			assertContains(t, code, test.exp...)
+			for _, m := range []string{"Read", "Close"} {
+				if n := strings.Count(code, ") "+m+"("); n > 1 {
+					t.Errorf("%s generated %d times\n%s", m, n, code)
+				}
+			}
+		})
+	}
+}
+
+func TestEmbeddedSignatureClash(t *testing.T) {
+	f, err := parser.ParseFile(token.NewFileSet(), "source.go", `
+package blah
+
+import "io"
+
+type Reader interface {
+	io.Reader
+	Read() string
+}
+`, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &InterfaceVisitor{name: "Reader"}
+	ast.Walk(v, f)
+
+	o := &options{ifName: "Reader", mockName: "MockReader", srcInterfaces: v.interfaces}
+	_, err = buildMockForInterface(o, v.interfaceType, v.imports, v.localTypes)
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+	if exp := "Reader has more than one method Read, with signatures ([]byte) (int, error) and () (string)"; err.Error() != exp {
+		t.Fatalf("Error not as expected. Have %q", err.Error())
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"go/ast"
+	"go/types"
+	"strings"
+)
+
+// Mocks of generic interfaces are generic too. For
+//
+//	type Mapper[K comparable, V any] interface { ... }
+//
+// we build
+//
+//	type MockMapper[K comparable, V any] struct {
+//		ut.CallTracker
+//	}
+//
+// and every method on the mock has a *MockMapper[K, V] receiver.
+
+// typeParamsDecl returns the type parameter list for declaring the mock, such
+// as "[K comparable, V any]", or "" if the interface isn't generic
+func (o *options) typeParamsDecl() string {
+	if o.typeParams.NumFields() == 0 {
+		return ""
+	}
+	decls := make([]string, len(o.typeParams.List))
+	for i, f := range o.typeParams.List {
+		names := make([]string, len(f.Names))
+		for j, n := range f.Names {
+			names[j] = n.Name
+		}
+		decls[i] = strings.Join(names, ", ") + " " + types.ExprString(f.Type)
+	}
+	return "[" + strings.Join(decls, ", ") + "]"
+}
+
+// typeParamNames returns the names of the interface's type parameters
+func (o *options) typeParamNames() []string {
+	var names []string
+	if o.typeParams != nil {
+		for _, f := range o.typeParams.List {
+			for _, n := range f.Names {
+				names = append(names, n.Name)
+			}
+		}
+	}
+	return names
+}
+
+// mockType returns the mock's type as used in receivers, such as
+// "MockMapper[K, V]"
+func (o *options) mockType() string {
+	names := o.typeParamNames()
+	if len(names) == 0 {
+		return o.mockName
+	}
+	return o.mockName + "[" + strings.Join(names, ", ") + "]"
+}
+
+// mockTypeExpr builds the AST for the mock's type as used in receivers
+func (o *options) mockTypeExpr() ast.Expr {
+	names := o.typeParamNames()
+	switch len(names) {
+	case 0:
+		return ast.NewIdent(o.mockName)
+	case 1:
+		return &ast.IndexExpr{X: ast.NewIdent(o.mockName), Index: ast.NewIdent(names[0])}
+	}
+	indices := make([]ast.Expr, len(names))
+	for i, n := range names {
+		indices[i] = ast.NewIdent(n)
+	}
+	return &ast.IndexListExpr{X: ast.NewIdent(o.mockName), Indices: indices}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// With -io-backed, a mock of an interface that reads or writes like
+// io.Reader and io.Writer does so from buffers, so a test can prime the data
+// to read and check what was written rather than adding a call for every Read
+// and Write.
+//
+//	m := NewMockConn(t).PrimeRead([]byte("request"))
+//	UnderTest(m)
+//	if string(m.Written()) != "response" { ... }
+//
+// Calls to Read and Write are recorded rather than asserted, so
+// GetRecordedParams still shows them.
+
+// ioHelperMethods are the methods buildIOBacking adds to the mock
+var ioHelperMethods = []string{"PrimeRead", "Written"}
+
+// ioBacking says which of Read and Write are backed by buffers
+type ioBacking struct {
+	read, write bool
+}
+
+func (b ioBacking) any() bool {
+	return b.read || b.write
+}
+
+// backs indicates whether the named method is built by buildIOBacking rather
+// than as a normal mock method
+func (b ioBacking) backs(name string) bool {
+	return (name == "Read" && b.read) || (name == "Write" && b.write)
+}
+
+// findIOBacking finds the methods of the interface that read or write like
+// io.Reader and io.Writer. These are Read and Write methods with the same
+// signatures, and those from embedding io.Reader, io.Writer or io.ReadWriter.
+func findIOBacking(t *ast.InterfaceType, imports []*ast.ImportSpec) ioBacking {
+	ioName := ioImportName(imports)
+
+	var b ioBacking
+	for _, m := range t.Methods.List {
+		switch mt := m.Type.(type) {
+		case *ast.FuncType:
+			if !isIOMethod(mt) {
+				continue
+			}
+			for _, n := range m.Names {
+				switch n.Name {
+				case "Read":
+					b.read = true
+				case "Write":
+					b.write = true
+				}
+			}
+		case *ast.SelectorExpr:
+			if x, ok := mt.X.(*ast.Ident); !ok || ioName == "" || x.Name != ioName {
+				continue
+			}
+			switch mt.Sel.Name {
+			case "Reader":
+				b.read = true
+			case "Writer":
+				b.write = true
+			case "ReadWriter":
+				b.read, b.write = true, true
+			}
+		}
+	}
+	return b
+}
+
+// isEmbeddedIO indicates whether an embedded type is one that findIOBacking
+// recognises
+func isEmbeddedIO(expr ast.Expr, imports []*ast.ImportSpec) bool {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	x, ok := sel.X.(*ast.Ident)
+	if !ok || x.Name != ioImportName(imports) {
+		return false
+	}
+	switch sel.Sel.Name {
+	case "Reader", "Writer", "ReadWriter":
+		return true
+	}
+	return false
+}
+
+// isIOMethod indicates whether the method has the signature of io.Reader's
+// Read and io.Writer's Write: (p []byte) (n int, err error)
+func isIOMethod(t *ast.FuncType) bool {
+	if t.Params.NumFields() != 1 || t.Results.NumFields() != 2 {
+		return false
+	}
+	arr, ok := t.Params.List[0].Type.(*ast.ArrayType)
+	if !ok || arr.Len != nil || !isIdent(arr.Elt, "byte") {
+		return false
+	}
+	return isIdent(t.Results.List[0].Type, "int") && isIdent(t.Results.List[1].Type, "error")
+}
+
+func isIdent(expr ast.Expr, name string) bool {
+	id, ok := expr.(*ast.Ident)
+	return ok && id.Name == name
+}
+
+// ioImportName returns the name the source uses for the io package, or "" if
+// it isn't imported
+func ioImportName(imports []*ast.ImportSpec) string {
+	for _, is := range imports {
+		if is.Path.Value == `"io"` {
+			return importName(is)
+		}
+	}
+	return ""
+}
+
+// fields are the fields added to the mock to back Read and Write
+func (b ioBacking) fields() string {
+	fields := "\n\tioLock sync.Mutex"
+	if b.read {
+		fields += "\n\treadBuf bytes.Buffer"
+	}
+	if b.write {
+		fields += "\n\twriteBuf bytes.Buffer"
+	}
+	return fields
+}
+
+// buildIOBacking builds the Read and Write methods backed by buffers, and the
+// helpers for priming the data to read and getting what was written. Once the
+// primed data is all read, Read returns io.EOF.
+func buildIOBacking(o *options, b ioBacking) ([]ast.Decl, error) {
+	mockType := o.mockType()
+	var code strings.Builder
+
+	method := func(name, buf string) {
+		fmt.Fprintf(&code, `
+func (i *%s) %s(p []byte) (int, error) {
+	if i.CallTracker == nil {
+		panic(%q)
+	}
+`, mockType, name, o.mockName+" used without "+o.constructorName)
+		if o.logCalls {
+			fmt.Fprintf(&code, "\ti.LogCall(%q, p)\n", name)
+		}
+		fmt.Fprintf(&code, `	i.TrackCall(%q, p)
+	i.ioLock.Lock()
+	defer i.ioLock.Unlock()
+	return i.%s.%s(p)
+}
+`, name, buf, name)
+	}
+
+	if b.read {
+		method("Read", "readBuf")
+		fmt.Fprintf(&code, `
+func (m *%s) PrimeRead(data []byte) *%s {
+	m.ioLock.Lock()
+	defer m.ioLock.Unlock()
+	m.readBuf.Write(data)
+	return m
+}
+`, mockType, mockType)
+	}
+
+	if b.write {
+		method("Write", "writeBuf")
+		fmt.Fprintf(&code, `
+func (m *%s) Written() []byte {
+	m.ioLock.Lock()
+	defer m.ioLock.Unlock()
+	return append([]byte(nil), m.writeBuf.Bytes()...)
+}
+`, mockType)
+	}
+
+	return parseDecls(code.String())
+}
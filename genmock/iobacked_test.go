@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestIOBacked(t *testing.T) {
+	code := generateWithOptions(t, &options{ioBacked: true}, `
+package blah
+
+import "io"
+
+type Conn interface {
+	io.ReadWriter
+	Close() error
+}
+`, "Conn")
+
+	assertContains(t, code,
+		`"bytes"`,
+		`"sync"`,
+		`type MockConn struct {
+	ut.CallTracker
+	ioLock   sync.Mutex
+	readBuf  bytes.Buffer
+	writeBuf bytes.Buffer
+}`,
+		`m := &MockConn{CallTracker: ut.NewCallRecords(t).SetErrorResults(map[string]ut.ErrorResult{"Read": {Index: 1, Results: 2}, "Write": {Index: 1, Results: 2}, "Close": {Index: 0, Results: 1}})}
+	m.RecordCall("Read")
+	m.RecordCall("Write")
+	return m`,
+		"func (i *MockConn) Read(p []byte) (int, error) {",
+		"return i.readBuf.Read(p)",
+		"func (m *MockConn) PrimeRead(data []byte) *MockConn {",
+		"func (i *MockConn) Write(p []byte) (int, error) {",
+		"return i.writeBuf.Write(p)",
+		"func (m *MockConn) Written() []byte {",
+		"func (i *MockConn) Close() error {",
+	)
+	if strings.Contains(code, `"io"`) {
+		t.Fatalf("The io import isn't needed\n%s", code)
+	}
+}
+
+func TestIOBackedMethods(t *testing.T) {
+	code := generateWithOptions(t, &options{ioBacked: true, logCalls: true}, `
+package blah
+
+type Source interface {
+	Read(buf []byte) (n int, err error)
+	Write(key string) error
+}
+`, "Source")
+
+	assertContains(t, code,
+		"readBuf  bytes.Buffer",
+		`m.RecordCall("Read")`,
+		"func (i *MockSource) Read(p []byte) (int, error) {",
+		`i.LogCall("Read", p)`,
+		"func (m *MockSource) PrimeRead(data []byte) *MockSource {",
+		// Write doesn't look like io.Writer's, so is mocked as usual
+		"func (i *MockSource) Write(key string) error {",
+		"func (m *MockSource) WriteReturns(r0 error) *MockSource {",
+	)
+	for _, unexpected := range []string{"writeBuf", "Written", "ReadReturns", `m.RecordCall("Write")`} {
+		if strings.Contains(code, unexpected) {
+			t.Fatalf("Did not expect %s\n%s", unexpected, code)
+		}
+	}
+}
+
+func TestIOBackedIgnored(t *testing.T) {
+	var w bytes.Buffer
+	warnOutput = &w
+	defer func() { warnOutput = os.Stderr }()
+
+	code := generateWithOptions(t, &options{ioBacked: true}, `
+package blah
+
+type Getter interface {
+	Get(key string) error
+}
+`, "Getter")
+	if strings.Contains(code, "bytes.Buffer") {
+		t.Fatalf("Nothing should be backed by buffers\n%s", code)
+	}
+	if !strings.Contains(w.String(), "-io-backed is ignored") {
+		t.Fatalf("Expected a warning. Have %q", w.String())
+	}
+
+	w.Reset()
+	code = generateWithOptions(t, &options{ioBacked: true}, `
+package blah
+
+type Reader interface {
+	Read(p []byte) (int, error)
+	Written() []byte
+}
+`, "Reader")
+	if strings.Contains(code, "bytes.Buffer") {
+		t.Fatalf("Nothing should be backed by buffers\n%s", code)
+	}
+	if !strings.Contains(w.String(), "already has a method Written, so -io-backed is ignored") {
+		t.Fatalf("Expected a warning. Have %q", w.String())
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"go/ast"
+	"go/types"
 )
 
 /*
@@ -24,8 +25,38 @@ An imported interface shows up with a Type which is a SelectorExpr. An imported
 struct is similar
 
 A base type shows with a Type that is an Ident with no Obj
+
+A type parameter of a generic interface also has an Obj of Kind type, but it
+is declared by a Field in the type parameter list rather than by a TypeSpec,
+and must not be qualified
+
+A local type alias, such as type Bytes = []byte, is declared by a TypeSpec
+too, so is qualified like any other local type rather than expanded. The
+qualified alias is the same type as the one it stands for, so tests can prime
+and check values of either.
+
+The parser resolves identifiers against the whole file scope once the file is
+parsed, so a local type declared after the interface that uses it still has
+an Obj and is qualified just the same.
 */
 
+// localPackageName returns the name the mock uses for the interface's package
+// when the mock is built elsewhere. This is utmocklocal, unless one of the
+// source's imports already uses that name.
+func localPackageName(imports []*ast.ImportSpec) string {
+	used := make(map[string]struct{}, len(imports))
+	for _, is := range imports {
+		used[importName(is)] = struct{}{}
+	}
+	name := "utmocklocal"
+	for i := 2; ; i++ {
+		if _, ok := used[name]; !ok {
+			return name
+		}
+		name = fmt.Sprintf("utmocklocal%d", i)
+	}
+}
+
 func qualifyLocalTypes(n ast.Node, localPkgName string) bool {
 	v := &QualifyLocalTypesVisitor{
 		pkg: ast.NewIdent(localPkgName),
@@ -63,7 +94,7 @@ type TypeObjVistor struct {
 func (to *TypeObjVistor) Visit(n ast.Node) ast.Visitor {
 	switch n := n.(type) {
 	case *ast.Ident:
-		if n.Obj != nil && n.Obj.Kind == ast.Typ {
+		if n.Obj != nil && n.Obj.Kind == ast.Typ && isTypeDecl(n.Obj) {
 			p := to.ancestors[len(to.ancestors)-1]
 			switch p := p.(type) {
 			case *ast.Field:
@@ -80,8 +111,25 @@ func (to *TypeObjVistor) Visit(n ast.Node) ast.Visitor {
 				}
 			case *ast.ChanType:
 				p.Value = to.buildSelector(n)
+			case *ast.Ellipsis:
+				p.Elt = to.buildSelector(n)
+			case *ast.IndexExpr:
+				if p.X == n {
+					p.X = to.buildSelector(n)
+				} else if p.Index == n {
+					p.Index = to.buildSelector(n)
+				}
+			case *ast.IndexListExpr:
+				if p.X == n {
+					p.X = to.buildSelector(n)
+				}
+				for i, idx := range p.Indices {
+					if idx == n {
+						p.Indices[i] = to.buildSelector(n)
+					}
+				}
 			default:
-				fmt.Printf("Unexpected type %T\n", p)
+				warnf("unexpected type %T", p)
 				printNode(p)
 			}
 			return nil
@@ -99,6 +147,23 @@ func (to *TypeObjVistor) Visit(n ast.Node) ast.Visitor {
 	return to
 }
 
+// qualifyLocalConstraints qualifies local types used as constraints on the type
+// parameters of a generic interface, as the mock declares the same type
+// parameters
+func qualifyLocalConstraints(typeParams *ast.FieldList, localPkgName string) {
+	q := &QualifyLocalTypesVisitor{
+		pkg: ast.NewIdent(localPkgName),
+	}
+	ast.Walk(&TypeObjVistor{q: q}, typeParams)
+}
+
+// isTypeDecl indicates whether the object is declared by a type declaration,
+// rather than being a type parameter
+func isTypeDecl(obj *ast.Object) bool {
+	_, ok := obj.Decl.(*ast.TypeSpec)
+	return ok
+}
+
 func (to *TypeObjVistor) buildSelector(n *ast.Ident) *ast.SelectorExpr {
 	to.q.added = true
 	return &ast.SelectorExpr{
@@ -110,5 +175,109 @@ func (to *TypeObjVistor) buildSelector(n *ast.Ident) *ast.SelectorExpr {
 func printNode(n ast.Node) {
 	var w bytes.Buffer
 	ast.Fprint(&w, nil, n, nil)
-	fmt.Printf(w.String())
+	warnOutput.Write(w.Bytes())
+}
+
+// qualifyDotImportedTypes qualifies types that come from a dot import. The
+// import isn't carried over to the mock, so in the mock these types need a
+// package name. It returns the import the qualified types need, or nil if
+// nothing was qualified.
+//
+// Dot-imported identifiers aren't resolved by the parser, so we treat any
+// unresolved type name that isn't predeclared or declared in the source
+// package as coming from the dot import. If there's more than one dot import
+// we can't tell which package a type comes from, so we leave things alone.
+func qualifyDotImportedTypes(t *ast.InterfaceType, imports []*ast.ImportSpec, localTypes map[string]struct{}) *ast.ImportSpec {
+	var dot *ast.ImportSpec
+	for _, is := range imports {
+		if is.Name != nil && is.Name.Name == "." {
+			if dot != nil {
+				warnf("more than one dot import, so dot-imported types are not qualified")
+				return nil
+			}
+			dot = is
+		}
+	}
+	if dot == nil {
+		return nil
+	}
+
+	q := &typeQualifier{
+		pkg: ast.NewIdent(importName(&ast.ImportSpec{Path: dot.Path})),
+		needs: func(id *ast.Ident) bool {
+			if id.Obj != nil || types.Universe.Lookup(id.Name) != nil {
+				return false
+			}
+			_, ok := localTypes[id.Name]
+			return !ok
+		},
+	}
+	for _, m := range t.Methods.List {
+		if ft, ok := m.Type.(*ast.FuncType); ok {
+			q.typeExpr(ft)
+		}
+	}
+	if !q.added {
+		return nil
+	}
+	return &ast.ImportSpec{
+		Name: q.pkg,
+		Path: dot.Path,
+	}
+}
+
+// typeQualifier qualifies type names with a package name
+type typeQualifier struct {
+	pkg *ast.Ident
+	// needs indicates whether a type name needs qualifying
+	needs func(id *ast.Ident) bool
+	added bool
+}
+
+func (q *typeQualifier) fieldList(fl *ast.FieldList) {
+	if fl == nil {
+		return
+	}
+	for _, f := range fl.List {
+		f.Type = q.typeExpr(f.Type)
+	}
+}
+
+// typeExpr qualifies the type names within a type expression that need it
+func (q *typeQualifier) typeExpr(e ast.Expr) ast.Expr {
+	switch e := e.(type) {
+	case *ast.Ident:
+		if !q.needs(e) {
+			return e
+		}
+		q.added = true
+		return &ast.SelectorExpr{X: q.pkg, Sel: ast.NewIdent(e.Name)}
+	case *ast.StarExpr:
+		e.X = q.typeExpr(e.X)
+	case *ast.ArrayType:
+		e.Elt = q.typeExpr(e.Elt)
+	case *ast.MapType:
+		e.Key = q.typeExpr(e.Key)
+		e.Value = q.typeExpr(e.Value)
+	case *ast.ChanType:
+		e.Value = q.typeExpr(e.Value)
+	case *ast.Ellipsis:
+		e.Elt = q.typeExpr(e.Elt)
+	case *ast.IndexExpr:
+		e.X = q.typeExpr(e.X)
+		e.Index = q.typeExpr(e.Index)
+	case *ast.IndexListExpr:
+		e.X = q.typeExpr(e.X)
+		for i := range e.Indices {
+			e.Indices[i] = q.typeExpr(e.Indices[i])
+		}
+	case *ast.FuncType:
+		q.fieldList(e.Params)
+		q.fieldList(e.Results)
+	case *ast.StructType:
+		q.fieldList(e.Fields)
+	case *ast.InterfaceType:
+		q.fieldList(e.Methods)
+	}
+	return e
 }
@@ -5,6 +5,7 @@ import (
 	"go/format"
 	"go/parser"
 	"go/token"
+	"strings"
 	"testing"
 )
 
@@ -147,6 +148,54 @@ type L1 struct{}
 type I1 interface {
 	f1(p []llmock.L1,) chan llmock.L1
 }
+`,
+			added: true,
+		},
+		{
+			code: `
+package blah
+
+type I1 interface {
+	f1(p L1) *L2
+}
+
+type L1 struct {}
+
+type L2 int
+`,
+			exp: `package blah
+
+type I1 interface {
+	f1(p llmock.L1,) *llmock.L2
+}
+
+type L1 struct{}
+
+type L2 int
+`,
+			added: true,
+		},
+		{
+			code: `
+package blah
+
+type L1 struct {}
+
+type Pair[K comparable, V any] struct {}
+
+type I1 interface {
+	f1(p Pair[string, []L1]) Pair[L1, int]
+}
+`,
+			exp: `package blah
+
+type L1 struct{}
+
+type Pair[K comparable, V any] struct{}
+
+type I1 interface {
+	f1(p llmock.Pair[string, []llmock.L1]) llmock.Pair[llmock.L1, int]
+}
 `,
 			added: true,
 		},
@@ -174,3 +223,30 @@ type I1 interface {
 	}
 
 }
+
+func TestDotImportedTypes(t *testing.T) {
+	code := generateFromSource(t, `
+package blah
+
+import (
+	"io"
+	. "time"
+)
+
+type Local struct{}
+
+type Clock interface {
+	Sleep(d Duration, l Local) (*Timer, error)
+	Months(ms ...Month) map[Weekday][]io.Reader
+}
+`, "Clock")
+
+	assertContains(t, code,
+		`time "time"`,
+		"func (i *MockClock) Sleep(d time.Duration, l Local) (*time.Timer, error) {",
+		"func (i *MockClock) Months(ms ...time.Month) map[time.Weekday][]io.Reader {",
+	)
+	if strings.Contains(code, `. "time"`) {
+		t.Fatalf("Dot import should not be carried over\n%s", code)
+	}
+}
@@ -8,29 +8,20 @@ import (
 	"go/build"
 	"go/format"
 	"go/parser"
+	"go/printer"
 	"go/token"
+	"go/types"
+	"io"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"text/template"
 )
 
-// blockVisitor walks the AST and extracts the first Block Statement it finds.
-// We only use it when we've generated the code ourselves so we know there is only
-// one code block to look for
-type blockVisitor struct {
-	stmts []ast.Stmt
-}
-
-func (v *blockVisitor) Visit(n ast.Node) ast.Visitor {
-	switch n := n.(type) {
-	case *ast.BlockStmt:
-		v.stmts = n.List
-		return nil
-	}
-	return v
-}
-
 // findUsedImports is an AST Visitor that notes which imports the code is using.
 type findUsedImports struct {
 	names map[string]struct{}
@@ -43,22 +34,50 @@ func newFindUsedImports() *findUsedImports {
 func (v *findUsedImports) Visit(n ast.Node) ast.Visitor {
 	sel, ok := n.(*ast.SelectorExpr)
 	if ok {
-		id, ok := sel.X.(*ast.Ident)
-		if ok {
+		if id := selectorRoot(sel); id != nil {
 			v.names[id.Name] = struct{}{}
 		}
 	}
 	return v
 }
 
+// selectorRoot returns the identifier at the left of a selector expression,
+// which for a qualified type is the package name. Types only ever have one
+// level of selector, but we follow nested selectors such as a.b.C in case
+// they turn up, rather than miss the package. It returns nil if the selector
+// isn't rooted in an identifier.
+func selectorRoot(sel *ast.SelectorExpr) *ast.Ident {
+	for {
+		switch x := sel.X.(type) {
+		case *ast.Ident:
+			return x
+		case *ast.SelectorExpr:
+			sel = x
+		default:
+			return nil
+		}
+	}
+}
+
 // isUsed indicates whether an import is used.
 //
 // Import specs can either just be a path, in which case the last
-// path component is the name, so it can also have a separate name
+// path component is the name, so it can also have a separate name. A blank
+// import is only there for its side effects, so is never used.
 func (v *findUsedImports) isUsed(s *ast.ImportSpec) bool {
+	if s.Name != nil && s.Name.Name == "_" {
+		return false
+	}
+	_, ok := v.names[importName(s)]
+	return ok
+}
+
+// importName returns the name an import is referred to by in the code. If the
+// import isn't explicitly named we assume the package name is the last path
+// component.
+func importName(s *ast.ImportSpec) string {
 	if s.Name != nil {
-		_, ok := v.names[s.Name.Name]
-		return ok
+		return s.Name.Name
 	}
 
 	path := s.Path.Value
@@ -70,9 +89,7 @@ func (v *findUsedImports) isUsed(s *ast.ImportSpec) bool {
 	}
 	parts := strings.Split(path, "/")
 
-	name := parts[len(parts)-1]
-	_, ok := v.names[name]
-	return ok
+	return parts[len(parts)-1]
 }
 
 // InterfaceVisitor walks the AST and finds interfaces.
@@ -80,106 +97,397 @@ func (v *findUsedImports) isUsed(s *ast.ImportSpec) bool {
 type InterfaceVisitor struct {
 	name          string
 	interfaceType *ast.InterfaceType
-	imports       []*ast.ImportSpec
+	// Type parameters of the interface if it is generic
+	typeParams *ast.FieldList
+	imports    []*ast.ImportSpec
+	// The names of all the types declared in the AST
+	localTypes map[string]struct{}
+	// The name of the package the AST is for
+	pkgName string
+	// All the interfaces declared in the AST, by name
+	interfaces map[string]*ast.InterfaceType
+
+	// If pattern is set we collect every interface whose name matches it
+	pattern *regexp.Regexp
+	matched []namedInterface
+}
+
+// namedInterface is an interface found by InterfaceVisitor
+type namedInterface struct {
+	name          string
+	interfaceType *ast.InterfaceType
+	typeParams    *ast.FieldList
 }
 
 func (i *InterfaceVisitor) Visit(n ast.Node) ast.Visitor {
 	switch n := n.(type) {
 	case *ast.TypeSpec:
+		if i.localTypes == nil {
+			i.localTypes = make(map[string]struct{})
+		}
+		i.localTypes[n.Name.Name] = struct{}{}
+
 		t, ok := n.Type.(*ast.InterfaceType)
 		if ok {
 			// This is an interface
+			if i.interfaces == nil {
+				i.interfaces = make(map[string]*ast.InterfaceType)
+			}
+			i.interfaces[n.Name.Name] = t
 			if n.Name.Name == i.name {
 				i.interfaceType = t
+				i.typeParams = n.TypeParams
+			}
+			if i.pattern != nil && i.pattern.MatchString(n.Name.Name) {
+				i.matched = append(i.matched, namedInterface{name: n.Name.Name, interfaceType: t, typeParams: n.TypeParams})
 			}
 			return nil
 		}
+
+		// The interface may be declared inline in a field of a struct, and
+		// named by a path like S.H
+		if st, ok := n.Type.(*ast.StructType); ok && strings.HasPrefix(i.name, n.Name.Name+".") {
+			path := strings.Split(i.name, ".")[1:]
+			if t := findInlineInterface(st, path); t != nil {
+				i.interfaceType = t
+				i.typeParams = n.TypeParams
+			}
+		}
 	case *ast.ImportSpec:
 		i.imports = append(i.imports, n)
+	case *ast.File:
+		i.pkgName = n.Name.Name
 	}
 
 	return i
 }
 
+// findInlineInterface follows the path of field names through struct types to
+// find an interface declared inline, such as H in
+//
+//	type S struct {
+//		H interface {
+//			Handle()
+//		}
+//	}
+func findInlineInterface(st *ast.StructType, path []string) *ast.InterfaceType {
+	for _, f := range st.Fields.List {
+		for _, n := range f.Names {
+			if n.Name != path[0] {
+				continue
+			}
+			if len(path) == 1 {
+				t, _ := f.Type.(*ast.InterfaceType)
+				return t
+			}
+			if inner, ok := f.Type.(*ast.StructType); ok {
+				return findInlineInterface(inner, path[1:])
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// warnOutput is where warnings are written. It's discarded with -quiet
+var warnOutput io.Writer = os.Stderr
+
+// errOutput is where errors are written. Generated code may be written to
+// stdout, so errors must go elsewhere
+var errOutput io.Writer = os.Stderr
+
+// warnf reports something the user should know about that doesn't stop us
+// generating the mock
+func warnf(format string, args ...interface{}) {
+	fmt.Fprintf(warnOutput, "genmock: warning: "+format+"\n", args...)
+}
+
+// errorf reports an error that stops us generating the mock
+func errorf(format string, args ...interface{}) {
+	fmt.Fprintf(errOutput, "genmock: "+format+"\n", args...)
+}
+
 func sameDir(d1, d2 string) bool {
 	a1, _ := filepath.Abs(d1)
 	a2, _ := filepath.Abs(d2)
 	return filepath.Clean(a1) == filepath.Clean(a2)
 }
 
-func buildMockForInterface(o *options, t *ast.InterfaceType, imports []*ast.ImportSpec) string {
-	// TODO: if we're not building this mock in the package it came from then
-	// we need to qualify any local types and add an import.
-	// We make up a package name that's unlikely to be used
+func buildMockForInterface(o *options, t *ast.InterfaceType, imports []*ast.ImportSpec, localTypes map[string]struct{}) (string, error) {
+	constructorName, err := o.buildConstructorName()
+	if err != nil {
+		return "", err
+	}
+	o.constructorName = constructorName
+
+	// The mock needs the methods of any interfaces this one embeds
+	t, imports, err = flattenEmbedded(o, t, imports)
+	if err != nil {
+		return "", err
+	}
 
-	if o.pkg != nil {
-		thisdir, _ := os.Getwd()
-		if !sameDir(thisdir, o.pkg.Dir) {
-			if qualifyLocalTypes(t, "utmocklocal") {
-				imports = append(imports, &ast.ImportSpec{
-					Name: ast.NewIdent("utmocklocal"),
-					Path: &ast.BasicLit{
-						Kind:  token.STRING,
-						Value: "\"" + o.pkg.ImportPath + "\"",
-					},
-				})
-			}
+	// Types from a dot import are unqualified in the source, but the dot
+	// import isn't carried into the mock so we qualify them.
+	if is := qualifyDotImportedTypes(t, imports, localTypes); is != nil {
+		imports = append(imports, is)
+	}
+
+	// If we're not building this mock in the package it came from then we
+	// need to qualify any local types and add an import. We make up a package
+	// name that's unlikely to be used. The mock's package may have the same
+	// name as the interface's, so we can't use that.
+	inPackage := o.inPackage()
+	qualify := !inPackage && o.pkg != nil
+	localName := localPackageName(imports)
+	if qualify {
+		if build.IsLocalImport(o.pkg.ImportPath) {
+			return "", fmt.Errorf("can't find the import path for %s, so the mock must be built in the same package. Run genmock within a module or GOPATH", o.pkg.ImportPath)
+		}
+		qualifyLocalTypes(t, localName)
+		if o.typeParams != nil {
+			qualifyLocalConstraints(o.typeParams, localName)
 		}
+		// This is only added to the mock if it is used
+		imports = append(imports, &ast.ImportSpec{
+			Name: ast.NewIdent(localName),
+			Path: &ast.BasicLit{
+				Kind:  token.STRING,
+				Value: "\"" + o.pkg.ImportPath + "\"",
+			},
+		})
+	}
+
+	h, err := checkMethodNames(o, t)
+	if err != nil {
+		return "", err
 	}
 
 	// Mock Implementation of the interface
-	mockAst, fset, err := buildBasicFile(o.targetPackage, o.mockName)
+	errorResults := findErrorResults(t)
+	var iob ioBacking
+	if h.ioBacked {
+		if iob = findIOBacking(t, imports); !iob.any() {
+			warnf("%s has no methods like io.Reader's Read or io.Writer's Write, so -io-backed is ignored", o.ifName)
+		}
+	}
+	mockAst, fset, err := buildBasicFile(o, h.stringer, errorResults, iob)
 	if err != nil {
-		fmt.Printf("Failed to parse basic AST. %v", err)
+		errorf("Failed to parse basic AST. %v", err)
 		os.Exit(2)
 	}
 
 	// Build a map to keep track of where the comments are
 	cmap := ast.NewCommentMap(fset, mockAst, mockAst.Comments)
 
+	// Check at compile time that the mock implements the interface, if we
+	// know how to refer to the interface. We can't for a generic interface
+	// without picking type arguments, or for an interface declared inline in a
+	// struct as it has no name
+	if o.ifName != "" && !o.inlineInterface() && (inPackage || o.pkg != nil) && o.typeParams.NumFields() == 0 {
+		for _, name := range o.interfaceNames() {
+			var ifaceType ast.Expr = ast.NewIdent(name)
+			if qualify {
+				ifaceType = &ast.SelectorExpr{
+					X:   ast.NewIdent(localName),
+					Sel: ast.NewIdent(name),
+				}
+			}
+			mockAst.Decls = append(mockAst.Decls, buildInterfaceAssertion(ifaceType, o.mockName))
+		}
+	}
+
+
 	// Method receiver for our mock interface
-	recv := buildMethodReceiver(o.mockName)
+	recv := buildMethodReceiver(o.mockTypeExpr())
+
+	if h.declarative {
+		decls, err := buildDeclarativeHelpers(o)
+		if err != nil {
+			return "", fmt.Errorf("failed to build declarative helpers. %v", err)
+		}
+		mockAst.Decls = append(mockAst.Decls, decls...)
+	}
+
+	if h.testify {
+		decls, err := buildTestifyHelpers(o)
+		if err != nil {
+			return "", fmt.Errorf("failed to build testify helpers. %v", err)
+		}
+		mockAst.Decls = append(mockAst.Decls, decls...)
+	}
 
 	// Add methods to our mockAst for each interface method
+	iface := t
 	for _, m := range t.Methods.List {
 		t, ok := m.Type.(*ast.FuncType)
 		if ok {
+			// Positions from the source file mean nothing in the mock
+			clearPositions(t)
+
 			// Names for return values causes problems, so remove them.
 			if t.Results != nil {
 				removeFieldNames(t.Results)
 			}
 
+			// Unnamed and blank parameters can't be passed to
+			// TrackCall, so give them names
+			nameParams(t.Params)
+
+			// Parameters can't share names with packages used in the
+			// method types, or with names used in the mock method body
+			if o.timeCalls {
+				renameShadowingParams(t, "time")
+			} else {
+				renameShadowingParams(t)
+			}
+
 			// We can have multiple names for a method type if multiple
 			// methods are declared with the same signature
 			for _, n := range m.Names {
-				fd := buildMockMethod(recv, n.Name, t)
+				// Only types in the same package can implement an
+				// unexported method
+				if !inPackage && !ast.IsExported(n.Name) {
+					return "", fmt.Errorf("%s has unexported method %s, so can only be mocked in its own package", o.ifName, n.Name)
+				}
+
+				if iob.backs(n.Name) {
+					// Built from buffers below
+					continue
+				}
+
+				if o.skipsTrack(n.Name) {
+					if t.Results.NumFields() != 0 {
+						return "", fmt.Errorf("%s has results, so can't be listed in -skip-track", n.Name)
+					}
+					mockAst.Decls = append(mockAst.Decls, buildStubMethod(recv, n.Name, t))
+					continue
+				}
+
+				fd := buildMockMethod(o, recv, n.Name, t)
 
 				mockAst.Decls = append(mockAst.Decls, fd)
+
+				// Typed helper for setting the method's returns
+				if _, skip := h.noReturns[n.Name]; t.Results.NumFields() != 0 && !skip {
+					mockAst.Decls = append(mockAst.Decls, buildReturnsHelper(o.mockTypeExpr(), n.Name, t.Results))
+				}
+
+				if _, skip := h.noMatcher[n.Name]; o.matcherHelpers && !skip {
+					decls, err := buildMatcherHelper(o, n.Name)
+					if err != nil {
+						return "", fmt.Errorf("failed to build matcher helper for %s. %v", n.Name, err)
+					}
+					mockAst.Decls = append(mockAst.Decls, decls...)
+				}
+
+				if o.rpcStyle && isRPCMethod(t) {
+					decls, err := buildRPCHelpers(o, n.Name, t)
+					if err != nil {
+						return "", fmt.Errorf("failed to build helpers for %s. %v", n.Name, err)
+					}
+					mockAst.Decls = append(mockAst.Decls, decls...)
+				}
 			}
+		} else if star, ok := m.Type.(*ast.StarExpr); ok {
+			return "", fmt.Errorf("%s embeds %s, but interfaces can't be embedded via a pointer. Embed %s instead", o.ifName, types.ExprString(star), types.ExprString(star.X))
+		} else if iob.any() && isEmbeddedIO(m.Type, imports) {
+			// Built from buffers below
+		} else {
+			warnf("%s is not a method so is not included in %s", types.ExprString(m.Type), o.mockName)
+		}
+	}
+
+	for _, name := range o.skipTrackNames() {
+		if !hasMethod(iface, name) {
+			warnf("-skip-track lists %s, which is not a method of %s", name, o.ifName)
 		}
 	}
 
-	addImportsToMock(mockAst, fset, imports)
+	if iob.any() {
+		decls, err := buildIOBacking(o, iob)
+		if err != nil {
+			return "", fmt.Errorf("failed to build io backing. %v", err)
+		}
+		mockAst.Decls = append(mockAst.Decls, decls...)
+	}
+
+	if err := addImportsToMock(mockAst, fset, imports, o.strict); err != nil {
+		return "", err
+	}
 
 	// Fixup the comments
 	mockAst.Comments = cmap.Filter(mockAst).Comments()
 
+	return formatMock(o.format, fset, mockAst)
+}
+
+// formatMock prints the mock's AST using the chosen formatter
+func formatMock(formatter string, fset *token.FileSet, mockAst *ast.File) (string, error) {
 	var buf bytes.Buffer
-	format.Node(&buf, fset, mockAst)
+	switch formatter {
+	case "none":
+		// Print without any of the usual formatting. This is useful to see
+		// exactly what genmock built.
+		c := &printer.Config{Mode: printer.RawFormat, Tabwidth: 8}
+		if err := c.Fprint(&buf, fset, mockAst); err != nil {
+			return "", err
+		}
+	case "goimports":
+		code, err := gofmtMock(fset, mockAst)
+		if err != nil {
+			return "", err
+		}
+		cmd := exec.Command("goimports")
+		cmd.Stdin = strings.NewReader(code)
+		var out bytes.Buffer
+		cmd.Stdout = &out
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return "", fmt.Errorf("goimports failed. %v", err)
+		}
+		return out.String(), nil
+	default:
+		return gofmtMock(fset, mockAst)
+	}
+	return buf.String(), nil
+}
 
-	return buf.String()
+// gofmtMock formats the mock as gofmt would.
+//
+// The methods we add to the mock have no positions, so the printer doesn't
+// know to leave a blank line between them. We add blank lines between
+// top-level functions ourselves.
+func gofmtMock(fset *token.FileSet, mockAst *ast.File) (string, error) {
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, mockAst); err != nil {
+		return "", err
+	}
+	return strings.Replace(buf.String(), "\n}\nfunc ", "\n}\n\nfunc ", -1), nil
 }
 
-func addImportsToMock(mockAst *ast.File, fset *token.FileSet, imports []*ast.ImportSpec) {
+// addImportsToMock adds the imports the mock uses from the interface's source.
+// In strict mode it returns an error if a method type refers to a package that
+// none of the imports provide, as the mock would not compile.
+func addImportsToMock(mockAst *ast.File, fset *token.FileSet, imports []*ast.ImportSpec, strict bool) error {
 	// Find all the imports we're using in the mockAST
 	fi := newFindUsedImports()
 	ast.Walk(fi, mockAst)
 
-	// Pick imports out of our input AST that are used in the mock
+	if strict {
+		if err := checkTypesImported(mockAst, imports); err != nil {
+			return err
+		}
+	}
+
+	// Pick imports out of our input AST that are used in the mock. Their
+	// positions are either from the source file or missing, and either way
+	// would upset sorting the imports and placing the comments at the top of
+	// the mock. So we place them alongside the mock's existing imports.
+	pos := mockAst.Imports[len(mockAst.Imports)-1].Pos()
 	usedImports := []ast.Spec{}
 	for _, is := range imports {
 		if fi.isUsed(is) {
-			usedImports = append(usedImports, is)
+			usedImports = append(usedImports, importAt(is, pos))
 		}
 	}
 
@@ -191,6 +499,58 @@ func addImportsToMock(mockAst *ast.File, fset *token.FileSet, imports []*ast.Imp
 		// Sort the imports
 		ast.SortImports(fset, mockAst)
 	}
+	return nil
+}
+
+// importAt returns a copy of the import spec placed at pos
+func importAt(is *ast.ImportSpec, pos token.Pos) *ast.ImportSpec {
+	c := &ast.ImportSpec{
+		Path: &ast.BasicLit{ValuePos: pos, Kind: is.Path.Kind, Value: is.Path.Value},
+	}
+	if is.Name != nil {
+		c.Name = &ast.Ident{NamePos: pos, Name: is.Name.Name}
+	}
+	return c
+}
+
+// checkTypesImported checks that every package qualifier used in the types of
+// the mock's methods is provided by either the mock's own imports or the
+// imports carried over from the interface's source.
+func checkTypesImported(mockAst *ast.File, imports []*ast.ImportSpec) error {
+	available := map[string]struct{}{}
+	for _, is := range mockAst.Imports {
+		available[importName(is)] = struct{}{}
+	}
+	for _, is := range imports {
+		available[importName(is)] = struct{}{}
+	}
+
+	for _, d := range mockAst.Decls {
+		fd, ok := d.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		var err error
+		ast.Inspect(fd.Type, func(n ast.Node) bool {
+			if err != nil {
+				return false
+			}
+			sel, ok := n.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			if id := selectorRoot(sel); id != nil {
+				if _, ok := available[id.Name]; !ok {
+					err = fmt.Errorf("method %s uses type %s but package %s is not imported", fd.Name.Name, types.ExprString(sel), id.Name)
+				}
+			}
+			return false
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // removeFieldNames removes names from the FieldList in place.
@@ -211,7 +571,358 @@ func removeFieldNames(fl *ast.FieldList) {
 	fl.List = l
 }
 
-func buildBasicFile(packageName, mockName string) (*ast.File, *token.FileSet, error) {
+// mockBodyNames are names used within the body of mock methods that
+// parameters must not hide
+var mockBodyNames = map[string]struct{}{
+	"i":  {},
+	"r":  {},
+	"ut": {},
+}
+
+// renameShadowingParams renames parameters in place if their names would hide
+// a package used in the method's types, a name used in the mock method body
+// (including any bodyNames), or a predeclared identifier such as len, nil or
+// int. A parameter called time in
+//
+//     Sleep(time time.Duration) time.Time
+//
+// would otherwise stop the mock body referring to time.Time. We add
+// underscores to the name until it is unique.
+func renameShadowingParams(t *ast.FuncType, bodyNames ...string) {
+	used := map[string]struct{}{}
+	for name := range mockBodyNames {
+		used[name] = struct{}{}
+	}
+	for _, name := range bodyNames {
+		used[name] = struct{}{}
+	}
+	ast.Inspect(t, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok {
+				used[id.Name] = struct{}{}
+			}
+		}
+		return true
+	})
+
+	taken := map[string]struct{}{}
+	for _, f := range t.Params.List {
+		for _, n := range f.Names {
+			taken[n.Name] = struct{}{}
+		}
+	}
+
+	for _, f := range t.Params.List {
+		for _, n := range f.Names {
+			if _, ok := used[n.Name]; !ok && types.Universe.Lookup(n.Name) == nil {
+				continue
+			}
+			name := n.Name
+			for {
+				name += "_"
+				_, isUsed := used[name]
+				_, isTaken := taken[name]
+				if !isUsed && !isTaken && types.Universe.Lookup(name) == nil {
+					break
+				}
+			}
+			taken[name] = struct{}{}
+			n.Name = name
+		}
+	}
+}
+
+// nameParams names unnamed and blank parameters in place, so the mock method
+// can track them. The parameter at position n is called pn, with underscores
+// added if another parameter already has that name.
+func nameParams(params *ast.FieldList) {
+	taken := map[string]struct{}{}
+	for _, f := range params.List {
+		for _, n := range f.Names {
+			taken[n.Name] = struct{}{}
+		}
+	}
+
+	pos := 0
+	name := func() *ast.Ident {
+		name := fmt.Sprintf("p%d", pos)
+		for {
+			if _, ok := taken[name]; !ok {
+				break
+			}
+			name += "_"
+		}
+		taken[name] = struct{}{}
+		return ast.NewIdent(name)
+	}
+
+	for _, f := range params.List {
+		if len(f.Names) == 0 {
+			f.Names = []*ast.Ident{name()}
+			pos++
+			continue
+		}
+		for i, n := range f.Names {
+			if n.Name == "_" {
+				f.Names[i] = name()
+			}
+			pos++
+		}
+	}
+}
+
+// buildInterfaceAssertion builds a declaration that checks the mock
+// implements the interface
+//
+//     var _ Interface = (*MockInterface)(nil)
+func buildInterfaceAssertion(ifaceType ast.Expr, mockName string) ast.Decl {
+	return &ast.GenDecl{
+		Tok: token.VAR,
+		Specs: []ast.Spec{
+			&ast.ValueSpec{
+				Names: []*ast.Ident{ast.NewIdent("_")},
+				Type:  ifaceType,
+				Values: []ast.Expr{
+					&ast.CallExpr{
+						Fun: &ast.ParenExpr{
+							X: &ast.StarExpr{X: ast.NewIdent(mockName)},
+						},
+						Args: []ast.Expr{ast.NewIdent("nil")},
+					},
+				},
+			},
+		},
+	}
+}
+
+// hasMethod indicates whether the interface declares the named method
+func hasMethod(t *ast.InterfaceType, name string) bool {
+	for _, m := range t.Methods.List {
+		for _, n := range m.Names {
+			if n.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasAnyMethod returns the first of the named methods the interface declares
+func hasAnyMethod(t *ast.InterfaceType, names []string) (string, bool) {
+	for _, name := range names {
+		if hasMethod(t, name) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// trackerMethods are the methods of ut.CallTracker, which the mock gets by
+// embedding the tracker
+var trackerMethods = []string{
+	"AddCall", "SetReturns", "ReturnsError", "BlocksUntilCancelled",
+	"SetErrorResults", "Before", "After", "TrackCall", "MustTrackCall", "T",
+	"AssertDone", "AssertDoneWith", "ResetMethod", "RecordCall",
+	"GetRecordedParams", "SetDefaultFunc", "LogCall", "Unordered",
+	"RecordLatency", "Stats", "Lenient", "SetUnexpectedReturns",
+	"SetSkipOnUnexpected", "UnexpectedCalls", "AssertConsumedInOrder",
+	"TotalCalls", "SetMaxCalls", "LastReturns", "Log", "SetCallLogFile",
+	"AssertAllCallsArg", "AssertSequence", "AssertSequenceDiff", "Summary",
+	"SetTrackGoroutines", "CallGoroutines",
+}
+
+// helpers notes which of the helper methods genmock can generate the mock
+// gets, as the helpers mustn't clash with the mock's other methods
+type helpers struct {
+	stringer    bool
+	declarative bool
+	testify     bool
+	ioBacked    bool
+	// noReturns and noMatcher name the methods whose typed returns helper or
+	// matcher helper would clash
+	noReturns map[string]struct{}
+	noMatcher map[string]struct{}
+}
+
+// checkMethodNames checks the interface's methods don't clash with methods
+// the mock declares itself, or with tracker methods the mock's methods call.
+// Other tracker methods are hidden by the interface's methods of the same
+// name, which works but may surprise, so we warn about those.
+//
+// It also decides which helpers the mock gets. A helper can't have the name of
+// one of the interface's methods, of a tracker method the mock promotes or of
+// another helper, so we warn about helpers that would clash and leave them out.
+func checkMethodNames(o *options, t *ast.InterfaceType) (helpers, error) {
+	needed := []string{"AddCall", "SetReturns", "CallTracker", "TrackCall"}
+	if o.eager {
+		needed = append(needed, "MustTrackCall", "T")
+	}
+	if o.logCalls {
+		needed = append(needed, "LogCall")
+	}
+	if o.timeCalls {
+		needed = append(needed, "RecordLatency")
+	}
+	if name, ok := hasAnyMethod(t, needed); ok {
+		return helpers{}, fmt.Errorf("%s has a method %s, which clashes with the mock's own %s", o.ifName, name, name)
+	}
+
+	// owners notes what already has each method name
+	owners := make(map[string]string)
+	for _, name := range trackerMethods {
+		owners[name] = "ut.CallTracker"
+	}
+	for _, m := range t.Methods.List {
+		for _, n := range m.Names {
+			owners[n.Name] = o.ifName
+		}
+	}
+	clash := func(names ...string) (string, string, bool) {
+		for _, name := range names {
+			if owner, ok := owners[name]; ok {
+				return owner, name, true
+			}
+		}
+		return "", "", false
+	}
+	claim := func(names ...string) {
+		for _, name := range names {
+			owners[name] = o.mockName
+		}
+	}
+
+	// The -rpc-style helpers are what the option asks for, so a clash is an
+	// error and the other per-method helpers make way for them
+	if o.rpcStyle {
+		for _, m := range t.Methods.List {
+			ft, ok := m.Type.(*ast.FuncType)
+			if !ok || !isRPCMethod(ft) {
+				continue
+			}
+			for _, n := range m.Names {
+				helper := "Expect" + n.Name
+				if owner, _, ok := clash(helper); ok {
+					return helpers{}, fmt.Errorf("%s has a method %s, which clashes with the -rpc-style helper for %s", owner, helper, n.Name)
+				}
+				claim(helper)
+			}
+		}
+	}
+
+	o.hidesTracker = false
+	for _, name := range trackerMethods {
+		if hasMethod(t, name) {
+			o.hidesTracker = true
+			warnf("%s has a method %s, which hides the tracker's %s. Tests can call m.CallTracker.%s to reach the tracker's", o.ifName, name, name, name)
+		}
+	}
+
+	h := helpers{
+		noReturns: make(map[string]struct{}),
+		noMatcher: make(map[string]struct{}),
+	}
+	if o.stringer {
+		if owner, _, ok := clash("String"); ok {
+			warnf("%s already has a String method, so -stringer is ignored", owner)
+		} else {
+			h.stringer = true
+			claim("String")
+		}
+	}
+	if o.declarative {
+		if owner, _, ok := clash("Expect"); ok {
+			warnf("%s already has an Expect method, so -declarative is ignored", owner)
+		} else {
+			h.declarative = true
+			claim("Expect")
+		}
+	}
+	if o.testifyCompat {
+		if owner, name, ok := clash(testifyMethods...); ok {
+			warnf("%s already has a method %s, so -testify-compat is ignored", owner, name)
+		} else {
+			h.testify = true
+			claim(testifyMethods...)
+		}
+	}
+	if o.ioBacked {
+		if owner, name, ok := clash(ioHelperMethods...); ok {
+			warnf("%s already has a method %s, so -io-backed is ignored", owner, name)
+		} else {
+			h.ioBacked = true
+			claim(ioHelperMethods...)
+		}
+	}
+
+	for _, m := range t.Methods.List {
+		ft, ok := m.Type.(*ast.FuncType)
+		if !ok {
+			continue
+		}
+		for _, n := range m.Names {
+			if o.skipsTrack(n.Name) {
+				continue
+			}
+			if ft.Results.NumFields() != 0 {
+				helper := n.Name + "Returns"
+				if owner, _, ok := clash(helper); ok {
+					warnf("%s has a method %s, so no typed returns helper is generated for %s", owner, helper, n.Name)
+					h.noReturns[n.Name] = struct{}{}
+				} else {
+					claim(helper)
+				}
+			}
+			if o.matcherHelpers {
+				helper := "Expect" + n.Name
+				if owner, _, ok := clash(helper); ok {
+					warnf("%s has a method %s, so no matcher helper is generated for %s", owner, helper, n.Name)
+					h.noMatcher[n.Name] = struct{}{}
+				} else {
+					claim(helper)
+				}
+			}
+		}
+	}
+	return h, nil
+}
+
+func buildBasicFile(o *options, stringer bool, errorResults []errorResult, iob ioBacking) (*ast.File, *token.FileSet, error) {
+	mockName, mockType := o.mockName, o.mockType()
+	tracker := "ut.NewCallRecords(t)"
+	if len(errorResults) > 0 {
+		// Tell the tracker where methods return errors, for ReturnsError
+		tracker += ".SetErrorResults(" + errorResultsLiteral(errorResults) + ")"
+	}
+	if o.callLogFile != "" {
+		tracker += fmt.Sprintf(".SetCallLogFile(%q)", o.callLogFile)
+	}
+	if o.trackGoroutines {
+		tracker += ".SetTrackGoroutines(true)"
+	}
+	var extraImports, extraFields string
+	if o.timeCalls {
+		extraImports = "\n\t\"time\""
+	}
+	constructorBody := fmt.Sprintf("return &%s{%s}", mockType, tracker)
+	if iob.any() {
+		extraImports += "\n\t\"bytes\"\n\t\"sync\""
+		extraFields = iob.fields()
+		constructorBody = fmt.Sprintf("m := &%s{CallTracker: %s}", mockType, tracker)
+		if iob.read {
+			constructorBody += "\n\tm.RecordCall(\"Read\")"
+		}
+		if iob.write {
+			constructorBody += "\n\tm.RecordCall(\"Write\")"
+		}
+		constructorBody += "\n\treturn m"
+	}
+	// If a method hides one of the tracker's with a different signature then
+	// the mock isn't a ut.CallTracker, so we return the embedded tracker
+	// instead.
+	self := "m"
+	if o.hidesTracker {
+		self = "m.CallTracker"
+	}
 	code := fmt.Sprintf(
 		`
 package %s
@@ -221,27 +932,36 @@ package %s
 
 import (
 	"testing"
-	"github.com/philpearl/ut"
+	"github.com/philpearl/ut"%s
 )
 
-type %s struct {
-	ut.CallTracker
+type %s%s struct {
+	ut.CallTracker%s
 }
 
-func New%s(t *testing.T) *%s {
-	return &%s{ut.NewCallRecords(t)}
+func %s%s(t testing.TB) *%s {
+	%s
 }
 
 func (m *%s) AddCall(name string, params ...interface{}) ut.CallTracker {
 	m.CallTracker.AddCall(name, params...)
-	return m
+	return %s
 }
 
 func (m *%s) SetReturns(params ...interface{}) ut.CallTracker {
 	m.CallTracker.SetReturns(params...)
-	return m
+	return %s
+}
+`, o.targetPackage, extraImports, mockName, o.typeParamsDecl(), extraFields, o.constructorName, o.typeParamsDecl(), mockType, constructorBody, mockType, self, mockType, self)
+
+	if stringer {
+		code += fmt.Sprintf(`
+// String summarises the calls made to the mock, to help debug failing tests
+func (m *%s) String() string {
+	return m.CallTracker.Summary()
 }
-`, packageName, mockName, mockName, mockName, mockName, mockName, mockName)
+`, mockType)
+	}
 
 	fset := token.NewFileSet()
 	file, err := parser.ParseFile(fset, "dummy.go", code, parser.ParseComments)
@@ -250,7 +970,7 @@ func (m *%s) SetReturns(params ...interface{}) ut.CallTracker {
 
 // Build method receiver builds a little bit of AST for the method receiver
 // part of a method call
-func buildMethodReceiver(name string) *ast.FieldList {
+func buildMethodReceiver(mockType ast.Expr) *ast.FieldList {
 	return &ast.FieldList{
 		List: []*ast.Field{
 			{
@@ -258,13 +978,24 @@ func buildMethodReceiver(name string) *ast.FieldList {
 					ast.NewIdent("i"),
 				},
 				Type: &ast.StarExpr{
-					X: ast.NewIdent(name),
+					X: mockType,
 				},
 			},
 		},
 	}
 }
 
+// buildStubMethod builds a method that does nothing, for a method listed in
+// -skip-track. Calls to it aren't tracked, so tests needn't expect them.
+func buildStubMethod(recv *ast.FieldList, name string, t *ast.FuncType) *ast.FuncDecl {
+	return &ast.FuncDecl{
+		Recv: recv,
+		Name: ast.NewIdent(name),
+		Type: t,
+		Body: &ast.BlockStmt{},
+	}
+}
+
 /* buildMockMethod builds the AST for the mock method.
 The function body needs to look something like:
 
@@ -275,6 +1006,7 @@ The function body needs to look something like:
 return values.  So instead we do
 
 	r := ut.TrackCall("method", param1, param2)
+	r = ut.FillReturns(i.CallTracker, "method", r, 2)
 	var r_0 int
 	var r_1 thing
 	if r[0] != nil { r_0 = r[0].(int) }
@@ -287,38 +1019,56 @@ return values.  So instead we do
 	ut__params[0] = param1
 	ut__params[1] = param2
 	r := ut.TrackCall("method", ut__params...)
+	r = ut.FillReturns(i.CallTracker, "method", r, 2)
 	var r_0 int
 	var r_1 thing
 	if r[0] != nil { r_0 = r[0].(int) }
 	if r[1] != nil { r_1 = r[1].(thing) }
 	return r_0, r_1
 */
-func buildMockMethod(recv *ast.FieldList, name string, t *ast.FuncType) *ast.FuncDecl {
+func buildMockMethod(o *options, recv *ast.FieldList, name string, t *ast.FuncType) *ast.FuncDecl {
 
-	stmts := []ast.Stmt{}
-	p, ellipsis, err := storeParams(t.Params)
-	if err != nil {
-		fmt.Printf("Failed to set up call parameters. %v", err)
+	stmts, ellipsis := storeParams(t.Params)
+
+	track := "TrackCall"
+	if o.eager {
+		// Mark the method as a test helper so failures are reported
+		// against the caller, and fail as soon as a call doesn't match
+		stmts = append([]ast.Stmt{markHelper()}, stmts...)
+		track = "MustTrackCall"
 	}
-	if p != nil {
-		stmts = append(stmts, p...)
+
+	// A mock built without its constructor has no tracker. Say so rather
+	// than panic with a nil dereference
+	stmts = append([]ast.Stmt{checkTracker(o.mockName, o.constructorName)}, stmts...)
+
+	if o.logCalls {
+		stmts = append(stmts, logCall(name, ellipsis, t.Params))
 	}
 
-	p, err = trackCall(t.Results.NumFields(), name, ellipsis, t.Params)
-	if err != nil {
-		fmt.Printf("failed to track call. %v", err)
+	if o.timeCalls {
+		stmts = append(stmts, startTimer())
+	}
+
+	stmts = append(stmts, trackCall(track, t.Results.NumFields(), name, ellipsis, t.Params))
+
+	if o.timeCalls {
+		stmts = append(stmts, recordLatency(name))
 	}
-	stmts = append(stmts, p...)
 
-	p, err = declReturnValues(t.Results)
+	if t.Results.NumFields() != 0 {
+		stmts = append(stmts, fillReturns(t.Results.NumFields(), name))
+	}
+
+	p, err := declReturnValues(t.Results)
 	if err != nil {
-		fmt.Printf("failed to declare return values. %v", err)
+		errorf("failed to declare return values. %v", err)
 	}
 	stmts = append(stmts, p...)
 
 	p, err = buildReturnStatement(t.Results.NumFields())
 	if err != nil {
-		fmt.Printf("failed to build return statement. %v", err)
+		errorf("failed to build return statement. %v", err)
 	}
 	if p != nil {
 		stmts = append(stmts, p...)
@@ -340,44 +1090,116 @@ func buildMockMethod(recv *ast.FieldList, name string, t *ast.FuncType) *ast.Fun
 // If the parameters include an ellipsis we need to copy parameters into
 // an interface{} array as follows.
 //
-//  params := []interface{}{}
-//  params[0] = p1
-//  params[1] = p2
-//  for i, p := range ellipsisParam {
-//      params[2+i]	= p
+//  ut__params := make([]interface{}, 2+len(ellipsisParam))
+//  ut__params[0] = p1
+//  ut__params[1] = p2
+//  for j, p := range ellipsisParam {
+//      ut__params[2+j] = p
 //  }
 //
 // If not it is better to add the params to the call directly for performance
 // reasons
-func storeParams(params *ast.FieldList) ([]ast.Stmt, bool, error) {
+func storeParams(params *ast.FieldList) ([]ast.Stmt, bool) {
 	// Is there an ellipsis parameter?
 	listlen := len(params.List)
-	if listlen > 0 {
-		last := params.List[len(params.List)-1]
-		if _, ok := last.Type.(*ast.Ellipsis); ok {
-			code := fmt.Sprintf("\tut__params := make([]interface{}, %d + len(%s))\n", params.NumFields()-1, last.Names[0].Name)
-			i := 0
-			for _, f := range params.List {
-				for _, n := range f.Names {
-					if _, ok := f.Type.(*ast.Ellipsis); ok {
-						// Ellipsis expression
-						code += fmt.Sprintf(`
-    for j, p := range %s {
-    	ut__params[%d+j] = p
-    }
-`, n.Name, i)
-					} else {
-						code += fmt.Sprintf("\tut__params[%d] = %s\n", i, n.Name)
-					}
-					i++
-				}
-			}
+	if listlen == 0 {
+		return nil, false
+	}
+	last := params.List[listlen-1]
+	if _, ok := last.Type.(*ast.Ellipsis); !ok {
+		return nil, false
+	}
+
+	numFixed := intLit(params.NumFields() - 1)
+	stmts := []ast.Stmt{
+		// ut__params := make([]interface{}, 2+len(ellipsisParam))
+		&ast.AssignStmt{
+			Lhs: []ast.Expr{ast.NewIdent("ut__params")},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{
+				&ast.CallExpr{
+					Fun: ast.NewIdent("make"),
+					Args: []ast.Expr{
+						&ast.ArrayType{Elt: emptyInterface()},
+						&ast.BinaryExpr{
+							X:  numFixed,
+							Op: token.ADD,
+							Y: &ast.CallExpr{
+								Fun:  ast.NewIdent("len"),
+								Args: []ast.Expr{ast.NewIdent(last.Names[0].Name)},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
 
-			stmts, err := parseCodeBlock(code)
-			return stmts, true, err
+	i := 0
+	for _, f := range params.List {
+		for _, n := range f.Names {
+			if _, ok := f.Type.(*ast.Ellipsis); ok {
+				// for j, p := range ellipsisParam {
+				//     ut__params[2+j] = p
+				// }
+				stmts = append(stmts, &ast.RangeStmt{
+					Key:   ast.NewIdent("j"),
+					Value: ast.NewIdent("p"),
+					Tok:   token.DEFINE,
+					X:     ast.NewIdent(n.Name),
+					Body: &ast.BlockStmt{
+						List: []ast.Stmt{
+							&ast.AssignStmt{
+								Lhs: []ast.Expr{
+									&ast.IndexExpr{
+										X: ast.NewIdent("ut__params"),
+										Index: &ast.BinaryExpr{
+											X:  intLit(i),
+											Op: token.ADD,
+											Y:  ast.NewIdent("j"),
+										},
+									},
+								},
+								Tok: token.ASSIGN,
+								Rhs: []ast.Expr{ast.NewIdent("p")},
+							},
+						},
+					},
+				})
+			} else {
+				// ut__params[0] = p1
+				stmts = append(stmts, &ast.AssignStmt{
+					Lhs: []ast.Expr{
+						&ast.IndexExpr{
+							X:     ast.NewIdent("ut__params"),
+							Index: intLit(i),
+						},
+					},
+					Tok: token.ASSIGN,
+					Rhs: []ast.Expr{ast.NewIdent(n.Name)},
+				})
+			}
+			i++
 		}
 	}
-	return nil, false, nil
+
+	return stmts, true
+}
+
+// intLit builds an integer literal
+func intLit(i int) *ast.BasicLit {
+	return &ast.BasicLit{
+		Kind:  token.INT,
+		Value: fmt.Sprintf("%d", i),
+	}
+}
+
+// emptyInterface builds interface{}. The printer only keeps the braces
+// together if they have positions on the same line.
+func emptyInterface() *ast.InterfaceType {
+	return &ast.InterfaceType{
+		Methods: &ast.FieldList{Opening: 1, Closing: 1},
+	}
 }
 
 // trackCall builds the ast for the call expression.
@@ -385,31 +1207,190 @@ func storeParams(params *ast.FieldList) ([]ast.Stmt, bool, error) {
 // The call looks like
 //     r := i.TrackCall("method", params...)
 //
-// If there are no return values r := is omitted
-func trackCall(numReturns int, methodName string, ellipsis bool, params *ast.FieldList) ([]ast.Stmt, error) {
-	code := "\t"
+// fn is TrackCall or MustTrackCall. If there are no return values r := is
+// omitted
+func trackCall(fn string, numReturns int, methodName string, ellipsis bool, params *ast.FieldList) ast.Stmt {
+	call := callTracker(fn, methodName, ellipsis, params)
+	if numReturns == 0 {
+		return &ast.ExprStmt{X: call}
+	}
+	return &ast.AssignStmt{
+		Lhs: []ast.Expr{
+			ast.NewIdent("r"),
+		},
+		Tok: token.DEFINE,
+		Rhs: []ast.Expr{
+			call,
+		},
+	}
+}
+
+// checkTracker builds the statement that checks the mock has a tracker
+//
+//     if i.CallTracker == nil {
+//         panic("MockFoo used without NewMockFoo")
+//     }
+func checkTracker(mockName, constructorName string) ast.Stmt {
+	return &ast.IfStmt{
+		Cond: &ast.BinaryExpr{
+			X:  &ast.SelectorExpr{X: ast.NewIdent("i"), Sel: ast.NewIdent("CallTracker")},
+			Op: token.EQL,
+			Y:  ast.NewIdent("nil"),
+		},
+		Body: &ast.BlockStmt{
+			List: []ast.Stmt{
+				&ast.ExprStmt{
+					X: &ast.CallExpr{
+						Fun: ast.NewIdent("panic"),
+						Args: []ast.Expr{
+							&ast.BasicLit{
+								Kind:  token.STRING,
+								Value: fmt.Sprintf("%q", mockName+" used without "+constructorName),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// markHelper builds the statement that marks the mock method as a test helper
+//
+//     i.T().Helper()
+func markHelper() ast.Stmt {
+	return &ast.ExprStmt{
+		X: &ast.CallExpr{
+			Fun: &ast.SelectorExpr{
+				X: &ast.CallExpr{
+					Fun: &ast.SelectorExpr{X: ast.NewIdent("i"), Sel: ast.NewIdent("T")},
+				},
+				Sel: ast.NewIdent("Helper"),
+			},
+		},
+	}
+}
+
+// startTimer builds the statement that notes when the call started
+//
+//     ut__start := time.Now()
+func startTimer() ast.Stmt {
+	return &ast.AssignStmt{
+		Lhs: []ast.Expr{ast.NewIdent("ut__start")},
+		Tok: token.DEFINE,
+		Rhs: []ast.Expr{
+			&ast.CallExpr{
+				Fun: &ast.SelectorExpr{X: ast.NewIdent("time"), Sel: ast.NewIdent("Now")},
+			},
+		},
+	}
+}
 
-	if numReturns != 0 {
-		code += "r := "
+// recordLatency builds the statement that records how long the call took
+//
+//     i.RecordLatency("method", time.Since(ut__start))
+func recordLatency(methodName string) ast.Stmt {
+	return &ast.ExprStmt{
+		X: &ast.CallExpr{
+			Fun: &ast.SelectorExpr{X: ast.NewIdent("i"), Sel: ast.NewIdent("RecordLatency")},
+			Args: []ast.Expr{
+				&ast.BasicLit{Kind: token.STRING, Value: fmt.Sprintf("%q", methodName)},
+				&ast.CallExpr{
+					Fun:  &ast.SelectorExpr{X: ast.NewIdent("time"), Sel: ast.NewIdent("Since")},
+					Args: []ast.Expr{ast.NewIdent("ut__start")},
+				},
+			},
+		},
+	}
+}
+
+// logCall builds the statement that logs the call to the test log.
+//
+//     i.LogCall("method", params...)
+func logCall(methodName string, ellipsis bool, params *ast.FieldList) ast.Stmt {
+	return &ast.ExprStmt{X: callTracker("LogCall", methodName, ellipsis, params)}
+}
+
+// callTracker builds a call to a CallTracker method that takes the name of
+// the mock method and its parameters.
+//
+//     i.fn("method", param1, param2)
+//
+// If there's an ellipsis parameter, the parameters have already been copied
+// to ut__params
+//
+//     i.fn("method", ut__params...)
+func callTracker(fn, methodName string, ellipsis bool, params *ast.FieldList) *ast.CallExpr {
+	call := &ast.CallExpr{
+		Fun: &ast.SelectorExpr{
+			X:   ast.NewIdent("i"),
+			Sel: ast.NewIdent(fn),
+		},
+		Args: []ast.Expr{
+			&ast.BasicLit{
+				Kind:  token.STRING,
+				Value: fmt.Sprintf("%q", methodName),
+			},
+		},
 	}
-	code += fmt.Sprintf("i.TrackCall(\"%s\", ", methodName)
 
 	if ellipsis {
-		code += "ut__params...)\n"
+		call.Args = append(call.Args, ast.NewIdent("ut__params"))
+		call.Ellipsis = 1
 	} else {
-		names := []string{}
 		for _, f := range params.List {
 			for _, n := range f.Names {
-				names = append(names, n.Name)
+				call.Args = append(call.Args, ast.NewIdent(n.Name))
 			}
 		}
-		code += strings.Join(names, ", ") + ")\n"
 	}
-	return parseCodeBlock(code)
+
+	return call
+}
+
+// fillReturns builds the statement that pads the returned values out to the
+// number the method needs, so a call primed with too few returns doesn't panic.
+//
+//     r = ut.FillReturns(i.CallTracker, "method", r, 2)
+func fillReturns(numReturns int, methodName string) ast.Stmt {
+	return &ast.AssignStmt{
+		Lhs: []ast.Expr{
+			ast.NewIdent("r"),
+		},
+		Tok: token.ASSIGN,
+		Rhs: []ast.Expr{
+			&ast.CallExpr{
+				Fun: &ast.SelectorExpr{
+					X:   ast.NewIdent("ut"),
+					Sel: ast.NewIdent("FillReturns"),
+				},
+				Args: []ast.Expr{
+					&ast.SelectorExpr{
+						X:   ast.NewIdent("i"),
+						Sel: ast.NewIdent("CallTracker"),
+					},
+					&ast.BasicLit{
+						Kind:  token.STRING,
+						Value: fmt.Sprintf("%q", methodName),
+					},
+					ast.NewIdent("r"),
+					&ast.BasicLit{
+						Kind:  token.INT,
+						Value: fmt.Sprintf("%d", numReturns),
+					},
+				},
+			},
+		},
+	}
 }
 
 // declReturnValues builds the return part of the call
 //
+// The nil check only skips the type assertion when the return was primed with
+// an untyped nil, leaving r_X as its zero value. A typed nil such as
+// (*T)(nil) is non-nil once boxed, so it is asserted and returned as is. For
+// an interface result like error that means the caller gets a non-nil error
+// holding a nil pointer, just as it would from a real implementation.
 func declReturnValues(results *ast.FieldList) ([]ast.Stmt, error) {
 	if results.NumFields() == 0 {
 		return nil, nil
@@ -486,51 +1467,189 @@ func buildReturnStatement(count int) ([]ast.Stmt, error) {
 
 func generateMockFromAst(o *options, node ast.Node) bool {
 	// Find  our iterface and any imports in the AST
-	v := &InterfaceVisitor{name: o.ifName}
+	if len(o.ifNames) != 0 {
+		return generateSingleMockFromAst(o, node)
+	}
+
+	v := &InterfaceVisitor{name: o.ifName, pattern: o.ifRegexp}
 	ast.Walk(v, node)
+	o.srcPackage = v.pkgName
+	o.srcInterfaces = v.interfaces
+
+	if o.ifRegexp != nil {
+		// Build a mock for each interface that matches
+		for _, ni := range v.matched {
+			ifOpts := o.forInterface(ni.name)
+			ifOpts.typeParams = ni.typeParams
+			writeMock(ifOpts, ni.interfaceType, v.imports, v.localTypes)
+		}
+		return len(v.matched) > 0
+	}
 
 	if v.interfaceType != nil {
 		// We found our interface!
-		code := buildMockForInterface(o, v.interfaceType, v.imports)
+		o.typeParams = v.typeParams
+		writeMock(o, v.interfaceType, v.imports, v.localTypes)
+		return true
+	}
+	return false
+}
 
-		err := ioutil.WriteFile(o.outfile, []byte(code), 0666)
-		if err != nil {
-			fmt.Printf("Failed to open %s for writing", o.outfile)
+// generateSingleMockFromAst builds one mock implementing all the interfaces
+// named for -single-mock
+func generateSingleMockFromAst(o *options, node ast.Node) bool {
+	v := &InterfaceVisitor{pattern: interfacesPattern(o.ifNames)}
+	ast.Walk(v, node)
+	if len(v.matched) == 0 {
+		return false
+	}
+	o.srcPackage = v.pkgName
+	o.srcInterfaces = v.interfaces
+
+	t, err := combineInterfaces(o.ifNames, v.matched)
+	if err != nil {
+		errorf("Failed to build %s. %v", o.mockName, err)
+		os.Exit(2)
+	}
+	writeMock(o, t, v.imports, v.localTypes)
+	return true
+}
+
+func writeMock(o *options, t *ast.InterfaceType, imports []*ast.ImportSpec, localTypes map[string]struct{}) {
+	code, err := buildMockForInterface(o, t, imports, localTypes)
+	if err != nil {
+		errorf("Failed to build %s. %v", o.mockName, err)
+		os.Exit(2)
+	}
+
+	err = ioutil.WriteFile(o.outfile, []byte(code), 0666)
+	if err != nil {
+		errorf("Failed to open %s for writing", o.outfile)
+		os.Exit(2)
+	}
+
+	if o.postCommand != "" {
+		if err := runPostCommand(o.postCommand, o.outfile); err != nil {
+			errorf("Post command failed for %s. %v", o.outfile, err)
 			os.Exit(2)
 		}
-		return true
 	}
-	return false
+}
+
+// runPostCommand runs the user's command on the file we've written. The
+// command is split into words on whitespace, and each word is a template
+// that can refer to the file as {{.File}}. The command isn't run via a
+// shell. Anything it writes goes to stderr.
+func runPostCommand(command, file string) error {
+	words := strings.Fields(command)
+	if len(words) == 0 {
+		return fmt.Errorf("no command")
+	}
+	data := struct{ File string }{File: file}
+	args := make([]string, len(words))
+	for i, word := range words {
+		tmpl, err := template.New("post-command").Parse(word)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return err
+		}
+		args[i] = buf.String()
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = errOutput
+	cmd.Stderr = errOutput
+	return cmd.Run()
 }
 
 func generateMock(o *options) {
+	// Look for the type in each of the packages in the directory
+	for _, node := range parseSource(o) {
+		if generateMockFromAst(o, node) {
+			return
+		}
+	}
+}
+
+// parseSource parses the package or file containing the interfaces. It
+// returns a node for each package found, or just the file.
+func parseSource(o *options) []ast.Node {
 	fset := token.NewFileSet()
 	// package path can be a directory
 	stat, err := os.Stat(o.packagePath)
 	if err != nil {
-		fmt.Printf("Failed to access %s. %v", o.packagePath, err)
+		errorf("Failed to access %s. %v", o.packagePath, err)
+		os.Exit(2)
 	}
 	if stat.IsDir() {
-		pkgs, err := parser.ParseDir(fset, o.packagePath, func(fileinfo os.FileInfo) bool {
-			return fileinfo.Name() != o.outfile
-		}, 0)
+		return parseDir(fset, o.packagePath, o.outfile)
+	}
+
+	p, err := parser.ParseFile(fset, o.packagePath, nil, 0)
+	if err != nil {
+		errorf("Failed to parse %s. %v", o.packagePath, err)
+		os.Exit(2)
+	}
+	return []ast.Node{p}
+}
+
+// parseDir parses the Go files in the directory, other than the outfile, and
+// returns a node for each package found. Files that don't parse are skipped
+// with a warning, as the interface is likely to be in another file.
+func parseDir(fset *token.FileSet, dir, outfile string) []ast.Node {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		errorf("Failed to read %s. %v", dir, err)
+		os.Exit(2)
+	}
+
+	var nodes []ast.Node
+	pkgs := make(map[string]*ast.Package)
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasSuffix(name, ".go") || name == outfile {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, 0)
 		if err != nil {
-			fmt.Printf("Failed to parse %s. %v", o.packagePath, err)
-			os.Exit(2)
+			warnf("Skipping %s as it doesn't parse. %v", name, err)
+			continue
 		}
-		// Look for the type in each of the files in the directory
-		for _, pkg := range pkgs {
-			if generateMockFromAst(o, pkg) {
-				return
-			}
+		pkg, ok := pkgs[f.Name.Name]
+		if !ok {
+			pkg = &ast.Package{Name: f.Name.Name, Files: make(map[string]*ast.File)}
+			pkgs[f.Name.Name] = pkg
+			nodes = append(nodes, pkg)
 		}
-	} else {
-		p, err := parser.ParseFile(fset, o.packagePath, nil, 0)
-		if err != nil {
-			fmt.Printf("Failed to parse %s. %v", o.packagePath, err)
-			os.Exit(2)
+		pkg.Files[name] = f
+	}
+	return nodes
+}
+
+// listOutput is where -list writes the interface names
+var listOutput io.Writer = os.Stdout
+
+// listInterfaces writes the names of the interfaces in the source, one per
+// line and in alphabetical order. Interfaces in external test packages are
+// left out as nothing else can use them.
+func listInterfaces(o *options) {
+	var names []string
+	for _, node := range parseSource(o) {
+		if pkg, ok := node.(*ast.Package); ok && strings.HasSuffix(pkg.Name, "_test") {
+			continue
 		}
-		generateMockFromAst(o, p)
+		v := &InterfaceVisitor{pattern: regexp.MustCompile("")}
+		ast.Walk(v, node)
+		for _, ni := range v.matched {
+			names = append(names, ni.name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintln(listOutput, name)
 	}
 }
 
@@ -540,42 +1659,194 @@ type options struct {
 	packagePath string
 	// Name of the interface to Mock
 	ifName string
+	// Name of a mock implementing all the interfaces listed in ifName
+	singleMock string
+	// The interfaces listed in ifName, with singleMock
+	ifNames []string
+	// Pattern for the names of interfaces to mock, as an alternative to ifName
+	ifPattern string
+	ifRegexp  *regexp.Regexp
+	// Create mocks for all the interfaces
+	all bool
 	// Name of the file to create
 	outfile string
 	// Name of the mock to create
 	mockName string
 	// Name of the package the mock should be created in
 	targetPackage string
+	// Log each call to the mock via the test's Logf
+	logCalls bool
+	// Fail if a method uses a package that the source doesn't import
+	strict bool
+	// How to format the mock: gofmt, goimports or none
+	format string
+	// Generate a String method that summarises the calls made
+	stringer bool
+	// Generate typed helpers for methods with a request and response
+	rpcStyle bool
+	// Comma separated list of methods that do nothing rather than track calls
+	skipTrack string
+	// Generate Expect<method> helpers taking matchers
+	matcherHelpers bool
+	// Don't write warnings
+	quiet bool
+	// Record how long each call takes
+	timeCalls bool
+	// File to write each call to as a line of JSON
+	callLogFile string
+	// Note the goroutine making each call
+	trackGoroutines bool
+	// Back Read and Write methods with buffers
+	ioBacked bool
+	// Command to run on each file written
+	postCommand string
+	// Template for the name of the mock's constructor
+	constructor string
+	// Name of the mock's constructor, from the constructor template
+	constructorName string
+	// The interface has a method hiding one of the tracker's, so the mock
+	// may not be a ut.CallTracker itself
+	hidesTracker bool
+	// Generate an Expect method taking a list of expected calls
+	declarative bool
+	// Fail as soon as a call doesn't match, reporting the caller's line
+	eager bool
+	// List the interfaces rather than generating mocks
+	list bool
+	// Generate methods named like testify's
+	testifyCompat bool
 
 	pkg *build.Package
+	// Name of the package containing the interface
+	srcPackage string
+	// Interfaces declared alongside the interface, which it may embed
+	srcInterfaces map[string]*ast.InterfaceType
+	// Type parameters of the interface if it is generic
+	typeParams *ast.FieldList
+}
+
+// defaultConstructor is the template for the name of the mock's constructor
+const defaultConstructor = "New{{.Mock}}"
+
+// buildConstructorName builds the name of the mock's constructor from the
+// constructor template. The template can use the names of the mock and the
+// interface.
+func (o *options) buildConstructorName() (string, error) {
+	constructor := o.constructor
+	if constructor == "" {
+		constructor = defaultConstructor
+	}
+	tmpl, err := template.New("constructor").Parse(constructor)
+	if err != nil {
+		return "", fmt.Errorf("invalid constructor template. %v", err)
+	}
+	var buf bytes.Buffer
+	data := struct{ Mock, Interface string }{Mock: o.mockName, Interface: o.ifName}
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("invalid constructor template. %v", err)
+	}
+	name := buf.String()
+	if !token.IsIdentifier(name) {
+		return "", fmt.Errorf("constructor name %q is not a valid identifier", name)
+	}
+	return name, nil
+}
+
+// inPackage indicates whether the mock is being built in the same package as
+// the interface. A mock for package foo built in the same directory but in
+// the external test package foo_test is not in the package.
+func (o *options) inPackage() bool {
+	if o.pkg != nil {
+		thisdir, _ := os.Getwd()
+		return sameDir(thisdir, o.pkg.Dir) && o.targetPackage == o.pkg.Name
+	}
+	return o.srcPackage == "" || o.targetPackage == o.srcPackage
 }
 
 func (o *options) validate() bool {
 	if o.packagePath == "" {
-		fmt.Printf("You must specify a filename or interface package")
+		errorf("You must specify a filename or interface package")
 		return false
 	}
-	if o.ifName == "" {
-		fmt.Printf("You must specify an interface name")
+	if o.list {
+		// We only need to find the package
+		return o.resolvePackage()
+	}
+	if o.all {
+		if o.ifName != "" || o.ifPattern != "" || o.outfile != "" || o.mockName != "" {
+			errorf("You cannot specify an interface, interface pattern, outfile or mock name with -all")
+			return false
+		}
+		// A pattern that matches every interface
+		o.ifPattern = "^"
+	}
+	if o.ifName == "" && o.ifPattern == "" {
+		errorf("You must specify an interface name or pattern")
 		return false
 	}
 	if o.targetPackage == "" {
-		fmt.Printf("You must specify a package name for the mock")
+		errorf("You must specify a package name for the mock")
 		return false
 	}
-	if o.outfile == "" {
-		o.outfile = fmt.Sprintf("mock%s.go", strings.ToLower(o.ifName))
+	switch o.format {
+	case "gofmt", "goimports", "none":
+	default:
+		errorf("Unknown format %s. Use gofmt, goimports or none", o.format)
+		return false
 	}
-	if o.mockName == "" {
-		o.mockName = "Mock" + o.ifName
+	if o.rpcStyle && o.matcherHelpers {
+		errorf("You cannot use -rpc-style with -matcher-helpers, as both generate Expect<method> helpers")
+		return false
+	}
+	if o.singleMock != "" {
+		if o.ifPattern != "" || o.mockName != "" {
+			errorf("You cannot specify an interface pattern or mock name with -single-mock")
+			return false
+		}
+		for _, name := range strings.Split(o.ifName, ",") {
+			name = strings.TrimSpace(name)
+			if !token.IsIdentifier(name) {
+				errorf("Invalid interface name %q. -single-mock needs a comma separated list of interface names", name)
+				return false
+			}
+			o.ifNames = append(o.ifNames, name)
+		}
+		o.mockName = o.singleMock
+	}
+	if o.ifPattern != "" {
+		if o.ifName != "" || o.outfile != "" || o.mockName != "" {
+			errorf("You cannot specify an interface, outfile or mock name with an interface pattern")
+			return false
+		}
+		r, err := regexp.Compile(o.ifPattern)
+		if err != nil {
+			errorf("Invalid interface pattern %s. %v", o.ifPattern, err)
+			return false
+		}
+		o.ifRegexp = r
+	} else {
+		o.setDefaults()
 	}
 
+	return o.resolvePackage()
+}
+
+// resolvePackage finds the directory for the package path, unless it is the
+// path to a file
+func (o *options) resolvePackage() bool {
 	if !strings.HasSuffix(o.packagePath, ".go") {
 		pkg, err := build.Import(o.packagePath, ".", 0)
 		if err != nil {
-			fmt.Printf("Could not access package %s, %v", o.packagePath, err)
+			errorf("Could not access package %s, %v", o.packagePath, err)
 			return false
 		}
+		if build.IsLocalImport(pkg.ImportPath) {
+			// The mock only needs the import path if it is built outside the
+			// package, so we don't fail here if we can't find it
+			if importPath, err := moduleImportPath(pkg.Dir); err == nil {
+				pkg.ImportPath = importPath
+			}
+		}
 		o.packagePath = pkg.Dir
 		o.pkg = pkg
 	}
@@ -583,12 +1854,106 @@ func (o *options) validate() bool {
 	return true
 }
 
+// srcDir returns the directory containing the interface's source, which the
+// packages it imports are found from
+func (o *options) srcDir() string {
+	if o.pkg != nil && o.pkg.Dir != "" {
+		return o.pkg.Dir
+	}
+	return filepath.Dir(o.packagePath)
+}
+
+// setDefaults fills in the outfile and mock name if they're not set
+func (o *options) setDefaults() {
+	if len(o.ifNames) != 0 {
+		// The mock of several interfaces is named by -single-mock
+		if o.outfile == "" {
+			o.outfile = strings.ToLower(o.mockName) + ".go"
+		}
+		return
+	}
+	name := strings.Replace(o.ifName, ".", "", -1)
+	if o.outfile == "" {
+		o.outfile = fmt.Sprintf("mock%s.go", strings.ToLower(name))
+	}
+	if o.mockName == "" {
+		o.mockName = "Mock" + name
+	}
+}
+
+// inlineInterface is true if the interface is declared inline in a struct
+// field, and named by a path like S.H
+func (o *options) inlineInterface() bool {
+	return strings.Contains(o.ifName, ".")
+}
+
+// skipTrackNames returns the methods listed by -skip-track
+func (o *options) skipTrackNames() []string {
+	var names []string
+	for _, name := range strings.Split(o.skipTrack, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// skipsTrack indicates whether the named method is listed by -skip-track
+func (o *options) skipsTrack(name string) bool {
+	for _, n := range o.skipTrackNames() {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// interfaceNames returns the names of the interfaces the mock implements
+func (o *options) interfaceNames() []string {
+	if len(o.ifNames) != 0 {
+		return o.ifNames
+	}
+	return []string{o.ifName}
+}
+
+// forInterface returns a copy of the options for building a mock of the
+// named interface, with the default outfile and mock name for that interface
+func (o *options) forInterface(name string) *options {
+	ifOpts := *o
+	ifOpts.ifName = name
+	ifOpts.outfile = ""
+	ifOpts.mockName = ""
+	ifOpts.setDefaults()
+	return &ifOpts
+}
+
 func (o *options) setup() {
 	flag.StringVar(&o.packagePath, "package", "", "The package that contains the interface definition; Must be specified. You can also provide a path to a Go file containing the interface.")
-	flag.StringVar(&o.ifName, "interface", "", "The interface that we should create a mock for; Must be specified.")
+	flag.BoolVar(&o.list, "list", false, "List the interfaces in the package, one per line, rather than generating mocks.")
+	flag.StringVar(&o.ifName, "interface", "", "The interface that we should create a mock for; Must be specified unless -interface-regexp is used. An interface declared inline in a struct field can be named by its path, such as S.H.")
+	flag.StringVar(&o.ifPattern, "interface-regexp", "", "Create mocks for every interface whose name matches this regular expression, instead of a single named interface. Each mock uses the default outfile and mock name.")
+	flag.BoolVar(&o.all, "all", false, "Create mocks for all the interfaces in the package, instead of a single named interface. Each mock uses the default outfile and mock name.")
+	flag.StringVar(&o.singleMock, "single-mock", "", "Create one mock with this name that implements all the interfaces given as a comma separated list by -interface, such as -interface=Reader,Closer. Methods shared by the interfaces are only generated once.")
 	flag.StringVar(&o.outfile, "outfile", "", "The file to create the mock in. By default will use mock<interface>.go in the current directory.")
 	flag.StringVar(&o.mockName, "mock", "", "The name for the mock class. By default will use Mock<interface>.")
 	flag.StringVar(&o.targetPackage, "mock-package", "", "Package name to use for the mock file; Must be specified.")
+	flag.StringVar(&o.format, "format", "gofmt", "How to format the mock: gofmt, goimports (which must be installed) or none to leave the output unformatted.")
+	flag.BoolVar(&o.rpcStyle, "rpc-style", false, "For methods that take a single request and return a response and an error, also generate typed Expect<method>(req).Return(resp, err) helpers.")
+	flag.StringVar(&o.skipTrack, "skip-track", "", "A comma separated list of methods, such as \"Log,Debug\", that do nothing rather than track calls, so tests needn't expect them. The methods must not return anything.")
+	flag.BoolVar(&o.matcherHelpers, "matcher-helpers", false, "Generate an Expect<method>(matchers ...ut.Matcher) helper for each method, which adds an expected call with the parameters checked by the matchers. Set the returns with the typed <method>Returns helper.")
+	flag.BoolVar(&o.declarative, "declarative", false, "Generate an Expect method on the mock that takes a slice of Mock<interface>Call structs, so expectations can be set up with a single struct literal.")
+	flag.BoolVar(&o.testifyCompat, "testify-compat", false, "Generate On, Return and AssertExpectations methods on the mock that work like AddCall, SetReturns and AssertDone, to ease moving tests from testify.")
+	flag.BoolVar(&o.stringer, "stringer", false, "Generate a String method on the mock that summarises the expected calls made and outstanding.")
+	flag.BoolVar(&o.strict, "strict", false, "Fail if an interface method uses a type from a package the source does not import, rather than generating a mock that won't compile.")
+	flag.BoolVar(&o.eager, "eager", false, "Generate mocks that stop the test as soon as a call doesn't match the expected call, and report the failure at the line that called the mock.")
+	flag.BoolVar(&o.logCalls, "log-calls", false, "Generate mocks that log each call and its parameters to the test log.")
+	flag.BoolVar(&o.timeCalls, "time-calls", false, "Generate mocks that record how long each call takes. Use the mock's Stats method to see the count, total, min and max.")
+	flag.StringVar(&o.postCommand, "post-command", "", "A command to run on each mock file once it is written, such as \"goimports -w {{.File}}\". {{.File}} is replaced with the file name. The command is not run via a shell.")
+	flag.StringVar(&o.callLogFile, "call-log-file", "", "Generate mocks that write each call to this file as a line of JSON, to help debug tests that fail in CI. The file is appended to, and a relative path is relative to the directory the test runs in.")
+	flag.BoolVar(&o.trackGoroutines, "track-goroutines", false, "Generate mocks that note the goroutine making each call, so tests can check them with CallGoroutines. This slows every call down.")
+	flag.BoolVar(&o.ioBacked, "io-backed", false, "For interfaces with Read or Write methods like io.Reader and io.Writer, or that embed them, generate Read and Write backed by buffers. Prime the data to read with PrimeRead, and get what was written with Written.")
+	flag.StringVar(&o.constructor, "constructor", defaultConstructor, "Template for the name of the mock's constructor. {{.Mock}} is replaced with the mock name and {{.Interface}} with the interface name.")
+	flag.BoolVar(&o.quiet, "quiet", false, "Don't write warnings. Errors are still written to stderr.")
 }
 
 func main() {
@@ -596,11 +1961,19 @@ func main() {
 	o.setup()
 
 	flag.Parse()
+	if o.quiet {
+		warnOutput = ioutil.Discard
+	}
 
 	if !o.validate() {
 		flag.Usage()
 		os.Exit(2)
 	}
 
+	if o.list {
+		listInterfaces(o)
+		return
+	}
+
 	generateMock(o)
 }
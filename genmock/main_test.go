@@ -0,0 +1,2206 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/philpearl/ut"
+)
+
+// generateFromSource builds a mock for the named interface found in src and
+// checks the generated code parses.
+func generateFromSource(t *testing.T, src, ifName string) string {
+	return generateWithOptions(t, &options{}, src, ifName)
+}
+
+// generateWithOptions is like generateFromSource, but allows generation
+// options to be set.
+func generateWithOptions(t *testing.T, o *options, src, ifName string) string {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "source.go", src, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse source. %v", err)
+	}
+
+	v := &InterfaceVisitor{name: ifName}
+	ast.Walk(v, f)
+	if v.interfaceType == nil {
+		t.Fatalf("Interface %s not found", ifName)
+	}
+
+	o.srcPackage = v.pkgName
+	o.srcInterfaces = v.interfaces
+	o.typeParams = v.typeParams
+	if o.targetPackage == "" {
+		o.targetPackage = "mocks"
+	}
+	if o.mockName == "" {
+		o.mockName = "Mock" + ifName
+	}
+	code, err := buildMockForInterface(o, v.interfaceType, v.imports, v.localTypes)
+	if err != nil {
+		t.Fatalf("Failed to build mock. %v", err)
+	}
+
+	if _, err := parser.ParseFile(token.NewFileSet(), "mock.go", code, 0); err != nil {
+		t.Fatalf("Generated code does not parse. %v\n%s", err, code)
+	}
+	return code
+}
+
+// assertContains checks the generated code contains each of the expected
+// snippets. Runs of whitespace are treated as a single space, as the line
+// breaks genmock produces aren't always pretty.
+func assertContains(t *testing.T, code string, exp ...string) {
+	flat := strings.Join(strings.Fields(code), " ")
+	for _, e := range exp {
+		if !strings.Contains(flat, strings.Join(strings.Fields(e), " ")) {
+			t.Errorf("Generated code does not contain `%s`\n%s", e, code)
+		}
+	}
+}
+
+func TestNestedFuncTypes(t *testing.T) {
+	code := generateFromSource(t, `
+package blah
+
+type Event struct{}
+
+type Watcher interface {
+	OnEvent(cb func(Event) (bool, error))
+	Convert(f func(int) (s string, err error)) func(string) (int, error)
+}
+`, "Watcher")
+
+	assertContains(t, code,
+		"func (i *MockWatcher) OnEvent(cb func(Event) (bool, error)) {",
+		`i.TrackCall("OnEvent", cb)`,
+		"func (i *MockWatcher) Convert(f func(int) (s string, err error)) func(string) (int, error) {",
+		"var r_0 func(string) (int, error)",
+		"r_0 = r[0].(func(string) (int, error))",
+	)
+}
+
+func TestCommaOkReturns(t *testing.T) {
+	code := generateFromSource(t, `
+package blah
+
+type Value struct{}
+
+type Store interface {
+	Lookup(k string) (Value, bool)
+}
+`, "Store")
+
+	assertContains(t, code,
+		`r := i.TrackCall("Lookup", k)`,
+		`r = ut.FillReturns(i.CallTracker, "Lookup", r, 2)`,
+		"r_1 = r[1].(bool)",
+	)
+}
+
+func TestLogCalls(t *testing.T) {
+	src := `
+package blah
+
+type Logger interface {
+	Log(level int, msg string, args ...interface{}) error
+	Flush()
+}
+`
+	code := generateWithOptions(t, &options{logCalls: true}, src, "Logger")
+	assertContains(t, code,
+		`i.LogCall("Log", ut__params...)`,
+		`i.LogCall("Flush")`,
+	)
+
+	code = generateFromSource(t, src, "Logger")
+	if strings.Contains(code, "LogCall") {
+		t.Fatalf("LogCall should not be generated by default\n%s", code)
+	}
+}
+
+func TestInterfaceRegexp(t *testing.T) {
+	f, err := parser.ParseFile(token.NewFileSet(), "source.go", `
+package blah
+
+type UserService interface {
+	Get(id int) string
+}
+
+type Store interface {
+	Put(id int, name string)
+}
+
+type OrderService interface {
+	Place(id int) error
+}
+`, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse source. %v", err)
+	}
+
+	o := &options{ifRegexp: regexp.MustCompile("^.*Service$")}
+	v := &InterfaceVisitor{pattern: o.ifRegexp}
+	ast.Walk(v, f)
+
+	exp := []struct {
+		name     string
+		mockName string
+		outfile  string
+	}{
+		{name: "UserService", mockName: "MockUserService", outfile: "mockuserservice.go"},
+		{name: "OrderService", mockName: "MockOrderService", outfile: "mockorderservice.go"},
+	}
+	if len(v.matched) != len(exp) {
+		t.Fatalf("Expected %d interfaces, found %d", len(exp), len(v.matched))
+	}
+	for i, e := range exp {
+		if v.matched[i].name != e.name {
+			t.Errorf("Interface %d is %s, expected %s", i, v.matched[i].name, e.name)
+		}
+		ifOpts := o.forInterface(v.matched[i].name)
+		if ifOpts.mockName != e.mockName || ifOpts.outfile != e.outfile {
+			t.Errorf("Interface %d has mock %s in %s, expected %s in %s", i, ifOpts.mockName, ifOpts.outfile, e.mockName, e.outfile)
+		}
+	}
+}
+
+func TestWarnNotMethod(t *testing.T) {
+	var w bytes.Buffer
+	warnOutput = &w
+	defer func() { warnOutput = os.Stderr }()
+
+	code := generateFromSource(t, `
+package blah
+
+type Reader[T any] interface {
+	Read() T
+}
+
+type ReadCounter interface {
+	Reader[int]
+	Count() int
+}
+`, "ReadCounter")
+
+	assertContains(t, code, "func (i *MockReadCounter) Count() int {")
+	exp := "genmock: warning: Reader[int] is not a method so is not included in MockReadCounter\n"
+	if w.String() != exp {
+		t.Fatalf("Warning not as expected. Have %q", w.String())
+	}
+}
+
+func TestStrictImports(t *testing.T) {
+	tests := []struct {
+		src string
+		err string
+	}{
+		{
+			src: `
+package blah
+
+import "time"
+
+type Timer interface {
+	Wait(d time.Duration) <-chan time.Time
+}
+`,
+		},
+		{
+			src: `
+package blah
+
+import "time"
+
+type Timer interface {
+	Wait(d time.Duration) (*bytes.Buffer, error)
+}
+`,
+			err: "method Wait uses type bytes.Buffer but package bytes is not imported",
+		},
+	}
+
+	for i, test := range tests {
+		f, err := parser.ParseFile(token.NewFileSet(), "source.go", test.src, 0)
+		if err != nil {
+			t.Fatalf("Test %d, failed to parse source. %v", i, err)
+		}
+		v := &InterfaceVisitor{name: "Timer"}
+		ast.Walk(v, f)
+
+		o := &options{targetPackage: "mocks", mockName: "MockTimer", strict: true}
+		_, err = buildMockForInterface(o, v.interfaceType, v.imports, v.localTypes)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("Test %d, unexpected error. %v", i, err)
+			}
+		} else if err == nil || err.Error() != test.err {
+			t.Errorf("Test %d, error not as expected. Have %v", i, err)
+		}
+	}
+}
+
+func TestUnsafePointer(t *testing.T) {
+	code := generateFromSource(t, `
+package blah
+
+import (
+	"io"
+	"unsafe"
+)
+
+type Allocator interface {
+	Alloc(size uintptr) unsafe.Pointer
+	Free(p unsafe.Pointer)
+}
+`, "Allocator")
+
+	assertContains(t, code,
+		`"unsafe"`,
+		"func (i *MockAllocator) Alloc(size uintptr) unsafe.Pointer {",
+		"r_0 = r[0].(unsafe.Pointer)",
+		"func (i *MockAllocator) Free(p unsafe.Pointer) {",
+	)
+	if strings.Contains(code, `"io"`) {
+		t.Fatalf("Unused import io should not be added\n%s", code)
+	}
+}
+
+func TestParamsShadowingPackages(t *testing.T) {
+	code := generateFromSource(t, `
+package blah
+
+import "time"
+
+type Sleeper interface {
+	Sleep(time time.Duration, time_ string) time.Time
+	Count(i, r int, ut ...string) int
+}
+`, "Sleeper")
+
+	assertContains(t, code,
+		"func (i *MockSleeper) Sleep(time__ time.Duration, time_ string) time.Time {",
+		`i.TrackCall("Sleep", time__, time_)`,
+		"var r_0 time.Time",
+		"func (i *MockSleeper) Count(i_, r_ int, ut_ ...string) int {",
+		"ut__params[0] = i_",
+		"ut__params[1] = r_",
+		"for j, p := range ut_ {",
+	)
+}
+
+func TestMultipleInterfaceReturns(t *testing.T) {
+	code := generateFromSource(t, `
+package blah
+
+import "io"
+
+type Piper interface {
+	Pipes() (io.Reader, io.Writer, io.Closer)
+}
+`, "Piper")
+
+	assertContains(t, code,
+		"func (i *MockPiper) Pipes() (io.Reader, io.Writer, io.Closer) {",
+		"r_0 = r[0].(io.Reader)",
+		"r_1 = r[1].(io.Writer)",
+		"r_2 = r[2].(io.Closer)",
+		"return r_0, r_1, r_2",
+	)
+	if n := strings.Count(code, `"io"`); n != 1 {
+		t.Fatalf("io should be imported once, found %d times\n%s", n, code)
+	}
+}
+
+func TestFormatNone(t *testing.T) {
+	src := `
+package blah
+
+type Adder interface {
+	Add(a, b int) int
+}
+`
+	formatted := generateFromSource(t, src, "Adder")
+	raw := generateWithOptions(t, &options{format: "none"}, src, "Adder")
+
+	if raw == formatted {
+		t.Fatalf("Expected unformatted output to differ from formatted output")
+	}
+	assertContains(t, raw, "func (i *MockAdder) Add(a, b int) int {")
+
+	reformatted, err := format.Source([]byte(raw))
+	if err != nil {
+		t.Fatalf("Failed to format raw output. %v", err)
+	}
+	if strings.Join(strings.Fields(string(reformatted)), " ") != strings.Join(strings.Fields(formatted), " ") {
+		t.Fatalf("Raw output formats to\n%s\nexpected\n%s", reformatted, formatted)
+	}
+}
+
+func TestSliceParamNotVariadic(t *testing.T) {
+	src := `
+package blah
+
+type Setter interface {
+	Set(name string, vals []int)
+}
+`
+	f, err := parser.ParseFile(token.NewFileSet(), "source.go", src, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse source. %v", err)
+	}
+	v := &InterfaceVisitor{name: "Setter"}
+	ast.Walk(v, f)
+
+	ft := v.interfaceType.Methods.List[0].Type.(*ast.FuncType)
+	stmts, ellipsis := storeParams(ft.Params)
+	if ellipsis || stmts != nil {
+		t.Fatalf("A slice parameter should not be treated as variadic")
+	}
+
+	code := generateFromSource(t, src, "Setter")
+	assertContains(t, code, `i.TrackCall("Set", name, vals)`)
+	if strings.Contains(code, "ut__params") {
+		t.Fatalf("Parameters should be passed directly\n%s", code)
+	}
+}
+
+func TestStringer(t *testing.T) {
+	src := `
+package blah
+
+type Adder interface {
+	Add(a, b int) int
+}
+
+type Named interface {
+	String() string
+}
+`
+	code := generateWithOptions(t, &options{stringer: true}, src, "Adder")
+	assertContains(t, code,
+		"func (m *MockAdder) String() string {",
+		"return m.CallTracker.Summary()",
+	)
+
+	var w bytes.Buffer
+	warnOutput = &w
+	defer func() { warnOutput = os.Stderr }()
+
+	code = generateWithOptions(t, &options{stringer: true}, src, "Named")
+	if strings.Contains(code, "Summary()") {
+		t.Fatalf("String should not be generated when the interface has one\n%s", code)
+	}
+	if w.Len() == 0 {
+		t.Fatalf("Expected a warning")
+	}
+}
+
+func TestBuiltinNames(t *testing.T) {
+	// The methods are unexported, so the mock has to be in the same package
+	code := generateWithOptions(t, &options{targetPackage: "blah"}, `
+package blah
+
+type Builtins interface {
+	len() int
+	copy(dst, src []byte) int
+	new(make int, nil error, len ...string) error
+	append(int int) string
+}
+`, "Builtins")
+
+	assertContains(t, code,
+		"func (i *MockBuiltins) len() int {",
+		`i.TrackCall("len")`,
+		"func (i *MockBuiltins) copy(dst, src []byte) int {",
+		`i.TrackCall("copy", dst, src)`,
+		"func (i *MockBuiltins) new(make_ int, nil_ error, len_ ...string) error {",
+		"ut__params := make([]interface{}, 2+len(len_))",
+		"ut__params[0] = make_",
+		"ut__params[1] = nil_",
+		"if r[0] != nil {",
+		"func (i *MockBuiltins) append(int_ int) string {",
+		`i.TrackCall("append", int_)`,
+	)
+}
+
+func TestEmbeddedPointer(t *testing.T) {
+	f, err := parser.ParseFile(token.NewFileSet(), "source.go", `
+package blah
+
+import "io"
+
+type ReadCounter interface {
+	*io.Reader
+	Count() int
+}
+`, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse source. %v", err)
+	}
+	v := &InterfaceVisitor{name: "ReadCounter"}
+	ast.Walk(v, f)
+
+	o := &options{ifName: "ReadCounter", targetPackage: "mocks", mockName: "MockReadCounter"}
+	_, err = buildMockForInterface(o, v.interfaceType, v.imports, v.localTypes)
+	exp := "ReadCounter embeds *io.Reader, but interfaces can't be embedded via a pointer. Embed io.Reader instead"
+	if err == nil || err.Error() != exp {
+		t.Fatalf("Error not as expected. Have %v", err)
+	}
+}
+
+// BenchmarkManyMethods builds a mock for an interface with 500 methods. This
+// should take well under 100ms; most of the time is spent formatting the
+// output.
+func BenchmarkManyMethods(b *testing.B) {
+	src := &bytes.Buffer{}
+	src.WriteString("package blah\n\nimport \"io\"\n\ntype Big interface {\n")
+	for i := 0; i < 500; i++ {
+		fmt.Fprintf(src, "\tMethod%d(a int, b string, r io.Reader, rest ...string) (int, error)\n", i)
+	}
+	src.WriteString("}\n")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		f, err := parser.ParseFile(token.NewFileSet(), "source.go", src.String(), 0)
+		if err != nil {
+			b.Fatalf("Failed to parse source. %v", err)
+		}
+		v := &InterfaceVisitor{name: "Big"}
+		ast.Walk(v, f)
+
+		o := &options{targetPackage: "mocks", mockName: "MockBig"}
+		if _, err := buildMockForInterface(o, v.interfaceType, v.imports, v.localTypes); err != nil {
+			b.Fatalf("Failed to build mock. %v", err)
+		}
+	}
+}
+
+func TestGeneratedMethods(t *testing.T) {
+	code := generateFromSource(t, `
+package blah
+
+type Logger interface {
+	Log(level int, msg string, args ...interface{}) error
+	Flush(names ...string)
+	Set(a, b int)
+}
+`, "Logger")
+
+	exp := `func (i *MockLogger) Log(level int, msg string, args ...interface{}) error {
+	if i.CallTracker == nil {
+		panic("MockLogger used without NewMockLogger")
+	}
+	ut__params := make([]interface{}, 2+len(args))
+	ut__params[0] = level
+	ut__params[1] = msg
+	for j, p := range args {
+		ut__params[2+j] = p
+	}
+	r := i.TrackCall("Log", ut__params...)
+	r = ut.FillReturns(i.CallTracker, "Log", r, 1)
+	var r_0 error
+	if r[0] != nil {
+		r_0 = r[0].(error)
+	}
+	return r_0
+}
+
+func (m *MockLogger) LogReturns(r0 error) *MockLogger {
+	m.CallTracker.SetReturns(r0)
+	return m
+}
+
+func (i *MockLogger) Flush(names ...string) {
+	if i.CallTracker == nil {
+		panic("MockLogger used without NewMockLogger")
+	}
+	ut__params := make([]interface{}, 0+len(names))
+	for j, p := range names {
+		ut__params[0+j] = p
+	}
+	i.TrackCall("Flush", ut__params...)
+	return
+}
+
+func (i *MockLogger) Set(a, b int) {
+	if i.CallTracker == nil {
+		panic("MockLogger used without NewMockLogger")
+	}
+	i.TrackCall("Set", a, b)
+	return
+}
+`
+	methods := code[strings.Index(code, "func (i *MockLogger) Log("):]
+	if methods != exp {
+		t.Fatalf("Generated methods not as expected. Have\n%s", methods)
+	}
+}
+
+func TestExternalTestPackage(t *testing.T) {
+	src := `
+package blah
+
+type Thing struct{}
+
+type Getter interface {
+	Get(id int) *Thing
+}
+`
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory. %v", err)
+	}
+	pkg := &build.Package{Name: "blah", Dir: wd, ImportPath: "example.com/blah"}
+
+	// In the package itself
+	code := generateWithOptions(t, &options{ifName: "Getter", targetPackage: "blah", pkg: pkg}, src, "Getter")
+	assertContains(t, code,
+		"package blah",
+		"var _ Getter = (*MockGetter)(nil)",
+		"func (i *MockGetter) Get(id int) *Thing {",
+	)
+	if strings.Contains(code, "utmocklocal") {
+		t.Fatalf("Types should not be qualified in the same package\n%s", code)
+	}
+
+	// In the external test package in the same directory
+	code = generateWithOptions(t, &options{ifName: "Getter", targetPackage: "blah_test", pkg: pkg}, src, "Getter")
+	if !strings.HasPrefix(code, "package blah_test\n\n// THIS CODE IS AUTO-GENERATED BY genmock\n") {
+		t.Fatalf("Header not as expected\n%s", code)
+	}
+	assertContains(t, code,
+		"package blah_test",
+		`utmocklocal "example.com/blah"`,
+		"var _ utmocklocal.Getter = (*MockGetter)(nil)",
+		"func (i *MockGetter) Get(id int) *utmocklocal.Thing {",
+	)
+}
+
+func TestGenericTypeArguments(t *testing.T) {
+	code := generateWithOptions(t, &options{strict: true}, `
+package blah
+
+import (
+	"example.com/cache"
+	"time"
+)
+
+type Loader interface {
+	Load(c cache.Cache[string, []byte], ttl map[string]time.Duration) (cache.Entry[string, []time.Time], error)
+}
+`, "Loader")
+
+	assertContains(t, code,
+		`"example.com/cache"`,
+		`"time"`,
+		"func (i *MockLoader) Load(c cache.Cache[string, []byte], ttl map[string]time.Duration) (cache.Entry[string, []time.Time], error) {",
+		"r_0 = r[0].(cache.Entry[string, []time.Time])",
+		"func (m *MockLoader) LoadReturns(r0 cache.Entry[string, []time.Time], r1 error) *MockLoader {",
+	)
+}
+
+func TestUnexportedMethod(t *testing.T) {
+	src := `
+package blah
+
+type Cache interface {
+	Get(key string) []byte
+	evict(key string) bool
+}
+`
+	code := generateWithOptions(t, &options{targetPackage: "blah"}, src, "Cache")
+	assertContains(t, code,
+		"func (i *MockCache) Get(key string) []byte {",
+		"func (i *MockCache) evict(key string) bool {",
+		`r := i.TrackCall("evict", key)`,
+		"func (m *MockCache) evictReturns(r0 bool) *MockCache {",
+	)
+
+	f, err := parser.ParseFile(token.NewFileSet(), "source.go", src, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse source. %v", err)
+	}
+	v := &InterfaceVisitor{name: "Cache"}
+	ast.Walk(v, f)
+
+	o := &options{ifName: "Cache", srcPackage: v.pkgName, targetPackage: "mocks", mockName: "MockCache"}
+	_, err = buildMockForInterface(o, v.interfaceType, v.imports, v.localTypes)
+	if err == nil || err.Error() != "Cache has unexported method evict, so can only be mocked in its own package" {
+		t.Fatalf("Error not as expected. Have %v", err)
+	}
+}
+
+func TestErrorsToErrOutput(t *testing.T) {
+	var w bytes.Buffer
+	errOutput = &w
+	defer func() { errOutput = os.Stderr }()
+
+	o := &options{}
+	if o.validate() {
+		t.Fatalf("Expected empty options to be invalid")
+	}
+	if w.String() != "genmock: You must specify a filename or interface package\n" {
+		t.Fatalf("Error output not as expected. Have %q", w.String())
+	}
+}
+
+func TestIteratorReturns(t *testing.T) {
+	pkg := &build.Package{Name: "blah", Dir: "/nowhere", ImportPath: "example.com/blah"}
+	code := generateWithOptions(t, &options{ifName: "Querier", pkg: pkg, strict: true}, `
+package blah
+
+import (
+	"context"
+	"iter"
+
+	"example.com/db"
+)
+
+type Row struct{}
+
+type Querier interface {
+	Query(ctx context.Context) (iter.Seq[Row], error)
+	Scan(ctx context.Context) iter.Seq2[int, db.Row]
+}
+`, "Querier")
+
+	assertContains(t, code,
+		`"context"`,
+		`"iter"`,
+		`"example.com/db"`,
+		`utmocklocal "example.com/blah"`,
+		"func (i *MockQuerier) Query(ctx context.Context) (iter.Seq[utmocklocal.Row], error) {",
+		"r_0 = r[0].(iter.Seq[utmocklocal.Row])",
+		"func (i *MockQuerier) Scan(ctx context.Context) iter.Seq2[int, db.Row] {",
+		"r_0 = r[0].(iter.Seq2[int, db.Row])",
+	)
+}
+
+func TestTrailingComments(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "source.go", `
+package blah
+
+// Doer does things
+type Doer interface {
+	// Do does a thing
+	Do(n int) error // returns an error if it can't
+	Undo() // undoes the last thing
+} // some note
+`, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("Failed to parse source. %v", err)
+	}
+	v := &InterfaceVisitor{name: "Doer"}
+	ast.Walk(v, f)
+
+	o := &options{ifName: "Doer", srcPackage: v.pkgName, targetPackage: "mocks", mockName: "MockDoer"}
+	code, err := buildMockForInterface(o, v.interfaceType, v.imports, v.localTypes)
+	if err != nil {
+		t.Fatalf("Failed to build mock. %v", err)
+	}
+
+	assertContains(t, code,
+		"func (i *MockDoer) Do(n int) error {",
+		"func (i *MockDoer) Undo() {",
+	)
+	for _, c := range []string{"some note", "does a thing", "returns an error", "undoes"} {
+		if strings.Contains(code, c) {
+			t.Errorf("Source comment %q leaked into the mock\n%s", c, code)
+		}
+	}
+}
+
+func TestTimeCalls(t *testing.T) {
+	src := `
+package blah
+
+type Clock interface {
+	Tick(time int) error
+	Stop()
+}
+`
+	code := generateWithOptions(t, &options{timeCalls: true}, src, "Clock")
+	if !strings.HasPrefix(code, "package mocks\n\n// THIS CODE IS AUTO-GENERATED BY genmock\n") {
+		t.Fatalf("Header not as expected\n%s", code)
+	}
+	assertContains(t, code,
+		`"time"`,
+		"func (i *MockClock) Tick(time_ int) error {",
+		`ut__start := time.Now()
+	r := i.TrackCall("Tick", time_)
+	i.RecordLatency("Tick", time.Since(ut__start))`,
+		`ut__start := time.Now()
+	i.TrackCall("Stop")
+	i.RecordLatency("Stop", time.Since(ut__start))`,
+	)
+
+	code = generateFromSource(t, src, "Clock")
+	if strings.Contains(code, "RecordLatency") || strings.Contains(code, `"time"`) {
+		t.Fatalf("Calls should not be timed by default\n%s", code)
+	}
+}
+
+func TestRunPostCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genmock")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir. %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "mockfred.go")
+	if err := ioutil.WriteFile(file, []byte("package mocks\n"), 0666); err != nil {
+		t.Fatalf("Failed to write file. %v", err)
+	}
+
+	if err := runPostCommand("cp {{.File}} {{.File}}.bak", file); err != nil {
+		t.Fatalf("Post command failed. %v", err)
+	}
+	if _, err := os.Stat(file + ".bak"); err != nil {
+		t.Fatalf("Post command did not run. %v", err)
+	}
+
+	var w bytes.Buffer
+	errOutput = &w
+	defer func() { errOutput = os.Stderr }()
+	if err := runPostCommand("cat {{.File}}.missing", file); err == nil {
+		t.Fatalf("Expected failing command to return an error")
+	}
+	if !strings.Contains(w.String(), "mockfred.go.missing") {
+		t.Fatalf("Command output should go to the error output. Have %q", w.String())
+	}
+
+	if err := runPostCommand("cat {{.Nope", file); err == nil {
+		t.Fatalf("Expected a bad template to return an error")
+	}
+}
+
+func TestLocalNamedMapType(t *testing.T) {
+	pkg := &build.Package{Name: "blah", Dir: "/nowhere", ImportPath: "example.com/blah"}
+	code := generateWithOptions(t, &options{ifName: "Client", pkg: pkg}, `
+package blah
+
+import "net/url"
+
+type Value struct{}
+
+type Headers map[string][]string
+
+type Params map[string][]*Value
+
+type Client interface {
+	Head(u *url.URL) (Headers, error)
+	Query(p Params) map[Value]Headers
+}
+`, "Client")
+
+	assertContains(t, code,
+		`utmocklocal "example.com/blah"`,
+		`"net/url"`,
+		"func (i *MockClient) Head(u *url.URL) (utmocklocal.Headers, error) {",
+		"var r_0 utmocklocal.Headers",
+		"r_0 = r[0].(utmocklocal.Headers)",
+		"func (i *MockClient) Query(p utmocklocal.Params) map[utmocklocal.Value]utmocklocal.Headers {",
+		"func (m *MockClient) HeadReturns(r0 utmocklocal.Headers, r1 error) *MockClient {",
+	)
+}
+
+func TestSharedSignature(t *testing.T) {
+	f, err := parser.ParseFile(token.NewFileSet(), "source.go", `
+package blah
+
+type Switch interface {
+	On(level int) error
+}
+`, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse source. %v", err)
+	}
+	v := &InterfaceVisitor{name: "Switch"}
+	ast.Walk(v, f)
+
+	// Go syntax doesn't let interface methods share a signature, but the AST
+	// allows a field to have more than one name
+	m := v.interfaceType.Methods.List[0]
+	m.Names = append(m.Names, ast.NewIdent("Off"))
+
+	o := &options{ifName: "Switch", srcPackage: v.pkgName, targetPackage: "mocks", mockName: "MockSwitch"}
+	code, err := buildMockForInterface(o, v.interfaceType, v.imports, v.localTypes)
+	if err != nil {
+		t.Fatalf("Failed to build mock. %v", err)
+	}
+
+	assertContains(t, code,
+		"func (i *MockSwitch) On(level int) error {",
+		`r := i.TrackCall("On", level)`,
+		`r = ut.FillReturns(i.CallTracker, "On", r, 1)`,
+		"func (m *MockSwitch) OnReturns(r0 error) *MockSwitch {",
+		"func (i *MockSwitch) Off(level int) error {",
+		`r := i.TrackCall("Off", level)`,
+		`r = ut.FillReturns(i.CallTracker, "Off", r, 1)`,
+		"func (m *MockSwitch) OffReturns(r0 error) *MockSwitch {",
+	)
+}
+
+func TestChannelReturns(t *testing.T) {
+	code := generateFromSource(t, `
+package blah
+
+type Watcher interface {
+	Watch(key string) chan string
+	Events() <-chan string
+}
+`, "Watcher")
+
+	assertContains(t, code,
+		"r_0 = r[0].(chan string)",
+		"r_0 = r[0].(<-chan string)",
+		"func (m *MockWatcher) EventsReturns(r0 <-chan string) *MockWatcher {",
+	)
+}
+
+func TestBlankImport(t *testing.T) {
+	code := generateFromSource(t, `
+package blah
+
+import (
+	"database/sql"
+	_ "github.com/lib/pq"
+)
+
+type Store interface {
+	DB() *sql.DB
+	Driver() _.Driver
+}
+`, "Store")
+
+	assertContains(t, code, `"database/sql"`)
+	if strings.Contains(code, "github.com/lib/pq") {
+		t.Fatalf("Blank import should not be carried over\n%s", code)
+	}
+
+	fi := newFindUsedImports()
+	fi.names["_"] = struct{}{}
+	if fi.isUsed(buildImport("github.com/lib/pq", "_")) {
+		t.Fatalf("A blank import should never be used")
+	}
+}
+
+func TestEager(t *testing.T) {
+	src := `
+package blah
+
+type Logger interface {
+	Log(level int, msg string, args ...interface{}) error
+	Flush()
+}
+`
+	code := generateWithOptions(t, &options{eager: true}, src, "Logger")
+	assertContains(t, code,
+		`func (i *MockLogger) Log(level int, msg string, args ...interface{}) error {
+	if i.CallTracker == nil {
+		panic("MockLogger used without NewMockLogger")
+	}
+	i.T().Helper()
+	ut__params := make([]interface{}, 2+len(args))`,
+		`r := i.MustTrackCall("Log", ut__params...)`,
+		`func (i *MockLogger) Flush() {
+	if i.CallTracker == nil {
+		panic("MockLogger used without NewMockLogger")
+	}
+	i.T().Helper()
+	i.MustTrackCall("Flush")`,
+	)
+
+	code = generateFromSource(t, src, "Logger")
+	if strings.Contains(code, "MustTrackCall") || strings.Contains(code, "Helper") {
+		t.Fatalf("Mocks should not be eager by default\n%s", code)
+	}
+}
+
+func TestErrorNotLast(t *testing.T) {
+	code := generateWithOptions(t, &options{rpcStyle: true}, `
+package blah
+
+type Odd interface {
+	Get(key string) (error, int)
+}
+`, "Odd")
+
+	assertContains(t, code,
+		"func (i *MockOdd) Get(key string) (error, int) {",
+		`var r_0 error
+	if r[0] != nil {
+		r_0 = r[0].(error)
+	}
+	var r_1 int
+	if r[1] != nil {
+		r_1 = r[1].(int)
+	}
+	return r_0, r_1`,
+		"func (m *MockOdd) GetReturns(r0 error, r1 int) *MockOdd {",
+	)
+	if strings.Contains(code, "ExpectGet") {
+		t.Fatalf("RPC helpers need the error last\n%s", code)
+	}
+}
+
+func TestErrorResults(t *testing.T) {
+	code := generateFromSource(t, `
+package blah
+
+type Store interface {
+	Get(key string) (val string, n int, err error)
+	Check() (error, bool)
+	Close() error
+	Len() int
+}
+`, "Store")
+
+	assertContains(t, code,
+		`return &MockStore{ut.NewCallRecords(t).SetErrorResults(map[string]ut.ErrorResult{"Get": {Index: 2, Results: 3}, "Check": {Index: 0, Results: 2}, "Close": {Index: 0, Results: 1}})}`,
+	)
+	// Tests mustn't be able to change the descriptor for other tests
+	if strings.Contains(code, "var MockStoreErrorResults") {
+		t.Fatalf("The error results should not be a package variable\n%s", code)
+	}
+	if strings.Contains(code, `"Len": {`) {
+		t.Fatalf("Len has no error result\n%s", code)
+	}
+
+	code = generateFromSource(t, `
+package blah
+
+type Lener interface {
+	Len() int
+}
+`, "Lener")
+	assertContains(t, code, "return &MockLener{ut.NewCallRecords(t)}")
+	if strings.Contains(code, "ErrorResults") {
+		t.Fatalf("No error results expected\n%s", code)
+	}
+}
+
+func TestInlineInterface(t *testing.T) {
+	src := `
+package blah
+
+type S struct {
+	Name string
+	H    interface {
+		Handle(req string) error
+	}
+	Inner struct {
+		G interface {
+			Get(key string) int
+		}
+	}
+}
+`
+	code := generateWithOptions(t, &options{mockName: "MockSH", pkg: &build.Package{ImportPath: "github.com/philpearl/blah"}}, src, "S.H")
+	assertContains(t, code,
+		"type MockSH struct {",
+		"func (i *MockSH) Handle(req string) error {",
+	)
+	if strings.Contains(code, "var _ ") {
+		t.Fatalf("An inline interface has no name to assert against\n%s", code)
+	}
+
+	code = generateWithOptions(t, &options{mockName: "MockSInnerG"}, src, "S.Inner.G")
+	assertContains(t, code, "func (i *MockSInnerG) Get(key string) int {")
+
+	for _, name := range []string{"S.Name", "S.X", "S.Inner", "T.H"} {
+		v := &InterfaceVisitor{name: name}
+		f, err := parser.ParseFile(token.NewFileSet(), "source.go", src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ast.Walk(v, f)
+		if v.interfaceType != nil {
+			t.Errorf("%s should not be found", name)
+		}
+	}
+}
+
+func TestInlineInterfaceDefaults(t *testing.T) {
+	o := &options{ifName: "S.H"}
+	o.setDefaults()
+	if o.mockName != "MockSH" || o.outfile != "mocksh.go" {
+		t.Fatalf("Defaults not as expected. Have %s and %s", o.mockName, o.outfile)
+	}
+}
+
+func TestByteAndRune(t *testing.T) {
+	code := generateWithOptions(t, &options{rpcStyle: true}, `
+package blah
+
+type Codec interface {
+	Encode() []byte
+	Next() rune
+	Put(b byte, rs []rune) (map[rune]byte, error)
+}
+`, "Codec")
+
+	assertContains(t, code,
+		"func (i *MockCodec) Encode() []byte {",
+		"r_0 = r[0].([]byte)",
+		"func (m *MockCodec) EncodeReturns(r0 []byte) *MockCodec {",
+		"func (i *MockCodec) Next() rune {",
+		"r_0 = r[0].(rune)",
+		"func (m *MockCodec) NextReturns(r0 rune) *MockCodec {",
+		"func (i *MockCodec) Put(b byte, rs []rune) (map[rune]byte, error) {",
+		"r_0 = r[0].(map[rune]byte)",
+	)
+	for _, underlying := range []string{"uint8", "int32"} {
+		if strings.Contains(code, underlying) {
+			t.Fatalf("byte and rune should not become %s\n%s", underlying, code)
+		}
+	}
+}
+
+func TestQualifiedArrayLength(t *testing.T) {
+	code := generateWithOptions(t, &options{strict: true}, `
+package blah
+
+import (
+	"bufio"
+	"crypto/sha256"
+)
+
+type Scanner interface {
+	Buf() [bufio.MaxScanTokenSize]byte
+	Sum(data []byte) (sum [sha256.Size]byte, err error)
+	Fill(p *[bufio.MaxScanTokenSize + 1]byte)
+}
+`, "Scanner")
+
+	assertContains(t, code,
+		`"bufio"`,
+		`"crypto/sha256"`,
+		"func (i *MockScanner) Buf() [bufio.MaxScanTokenSize]byte {",
+		"r_0 = r[0].([bufio.MaxScanTokenSize]byte)",
+		"func (i *MockScanner) Sum(data []byte) ([sha256.Size]byte, error) {",
+		"func (i *MockScanner) Fill(p *[bufio.MaxScanTokenSize + 1]byte) {",
+	)
+}
+
+func TestPointerToExternalStruct(t *testing.T) {
+	code := generateWithOptions(t, &options{strict: true}, `
+package blah
+
+import "math/big"
+
+type Bank interface {
+	Balance(account string) *big.Int
+	Transfer(from, to string, amount *big.Int) (*big.Int, error)
+}
+`, "Bank")
+
+	assertContains(t, code,
+		`"math/big"`,
+		"func (i *MockBank) Balance(account string) *big.Int {",
+		"r_0 = r[0].(*big.Int)",
+		"func (m *MockBank) BalanceReturns(r0 *big.Int) *MockBank {",
+		"func (i *MockBank) Transfer(from, to string, amount *big.Int) (*big.Int, error) {",
+	)
+}
+
+func TestGroupedTypeDeclaration(t *testing.T) {
+	src := `
+package blah
+
+type (
+	Reader interface {
+		Read(key string) ([]byte, error)
+	}
+
+	Key string
+
+	Writer interface {
+		Write(key Key, data []byte) error
+	}
+
+	Closer interface {
+		Close() error
+	}
+)
+`
+	code := generateFromSource(t, src, "Writer")
+	assertContains(t, code,
+		"type MockWriter struct {",
+		"func (i *MockWriter) Write(key Key, data []byte) error {",
+	)
+	for _, other := range []string{"Read(", "Close("} {
+		if strings.Contains(code, other) {
+			t.Fatalf("Mock of Writer should not have %s\n%s", other, code)
+		}
+	}
+
+	// Local types in the group are qualified like any others
+	pkg := &build.Package{ImportPath: "github.com/philpearl/blah"}
+	code = generateWithOptions(t, &options{pkg: pkg}, src, "Writer")
+	assertContains(t, code,
+		"func (i *MockWriter) Write(key utmocklocal.Key, data []byte) error {",
+	)
+}
+
+func TestSameExternalTypeInAndOut(t *testing.T) {
+	src := `
+package blah
+
+import "time"
+
+type Clock interface {
+	Transform(d time.Duration) time.Duration
+}
+`
+	for _, o := range []*options{{}, {timeCalls: true}} {
+		code := generateWithOptions(t, o, src, "Clock")
+		assertContains(t, code,
+			"func (i *MockClock) Transform(d time.Duration) time.Duration {",
+			"r_0 = r[0].(time.Duration)",
+			"func (m *MockClock) TransformReturns(r0 time.Duration) *MockClock {",
+		)
+		if c := strings.Count(code, `"time"`); c != 1 {
+			t.Fatalf("Expected time to be imported once, have %d\n%s", c, code)
+		}
+	}
+}
+
+func TestSkipTrack(t *testing.T) {
+	var w bytes.Buffer
+	warnOutput = &w
+	defer func() { warnOutput = os.Stderr }()
+
+	code := generateWithOptions(t, &options{ifName: "Logger", skipTrack: "Log, Debug,Trace", logCalls: true}, `
+package blah
+
+type Logger interface {
+	Log(msg string, args ...interface{})
+	Debug(msg string)
+	Flush() error
+}
+`, "Logger")
+
+	assertContains(t, code,
+		"func (i *MockLogger) Log(msg string, args ...interface{}) {\n}",
+		"func (i *MockLogger) Debug(msg string) {\n}",
+		`r := i.TrackCall("Flush")`,
+	)
+	for _, method := range []string{"Log", "Debug"} {
+		if strings.Contains(code, fmt.Sprintf("%q", method)) {
+			t.Errorf("%s should not be tracked\n%s", method, code)
+		}
+	}
+	if exp := "-skip-track lists Trace, which is not a method of Logger"; !strings.Contains(w.String(), exp) {
+		t.Errorf("Expected warning %q. Have %q", exp, w.String())
+	}
+}
+
+func TestSkipTrackWithResults(t *testing.T) {
+	f, err := parser.ParseFile(token.NewFileSet(), "source.go", `
+package blah
+
+type Logger interface {
+	Flush() error
+}
+`, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &InterfaceVisitor{name: "Logger"}
+	ast.Walk(v, f)
+
+	o := &options{ifName: "Logger", mockName: "MockLogger", targetPackage: "mocks", skipTrack: "Flush"}
+	_, err = buildMockForInterface(o, v.interfaceType, v.imports, v.localTypes)
+	if err == nil || err.Error() != "Flush has results, so can't be listed in -skip-track" {
+		t.Fatalf("Error not as expected. Have %v", err)
+	}
+}
+
+func TestConstructor(t *testing.T) {
+	src := `
+package blah
+
+type Getter interface {
+	Get(key string) error
+}
+`
+	code := generateFromSource(t, src, "Getter")
+	assertContains(t, code,
+		"func NewMockGetter(t testing.TB) *MockGetter {",
+		`panic("MockGetter used without NewMockGetter")`,
+	)
+
+	code = generateWithOptions(t, &options{constructor: "Make{{.Interface}}Mock", ifName: "Getter"}, src, "Getter")
+	assertContains(t, code,
+		"func MakeGetterMock(t testing.TB) *MockGetter {",
+		`panic("MockGetter used without MakeGetterMock")`,
+	)
+	if strings.Contains(code, "NewMockGetter") {
+		t.Fatalf("The default constructor should not be used\n%s", code)
+	}
+
+	for _, constructor := range []string{"New {{.Mock}}", "New{{.Mock", "New{{.Nope}}"} {
+		o := &options{constructor: constructor, ifName: "Getter", mockName: "MockGetter"}
+		if _, err := o.buildConstructorName(); err == nil {
+			t.Errorf("Expected an error for constructor %q", constructor)
+		}
+	}
+}
+
+func TestManyReturns(t *testing.T) {
+	code := generateFromSource(t, `
+package blah
+
+type Thing struct{}
+
+type Many interface {
+	Lots() (a, b int, c string, d error, e []byte, f map[string]int, g *Thing, h bool, i float64, j chan int)
+}
+`, "Many")
+
+	assertContains(t, code,
+		"func (i *MockMany) Lots() (int, int, string, error, []byte, map[string]int, *Thing, bool, float64, chan int) {",
+		`r = ut.FillReturns(i.CallTracker, "Lots", r, 10)`,
+		"return r_0, r_1, r_2, r_3, r_4, r_5, r_6, r_7, r_8, r_9",
+		"func (m *MockMany) LotsReturns(r0 int, r1 int, r2 string, r3 error, r4 []byte, r5 map[string]int, r6 *Thing, r7 bool, r8 float64, r9 chan int) *MockMany {",
+		"m.CallTracker.SetReturns(r0, r1, r2, r3, r4, r5, r6, r7, r8, r9)",
+		`"Lots": {Index: 3, Results: 10}`,
+	)
+
+	// Each temporary is declared with the right type and filled from the
+	// right index
+	types := []string{"int", "int", "string", "error", "[]byte", "map[string]int", "*Thing", "bool", "float64", "chan int"}
+	for i, typ := range types {
+		assertContains(t, code, fmt.Sprintf("var r_%d %s\n\tif r[%d] != nil {\n\t\tr_%d = r[%d].(%s)\n\t}", i, typ, i, i, i, typ))
+	}
+}
+
+func TestCallLogFile(t *testing.T) {
+	code := generateWithOptions(t, &options{callLogFile: "/tmp/calls.jsonl"}, `
+package blah
+
+type Getter interface {
+	Get(key string) error
+}
+`, "Getter")
+	assertContains(t, code,
+		`return &MockGetter{ut.NewCallRecords(t).SetErrorResults(map[string]ut.ErrorResult{"Get": {Index: 0, Results: 1}}).SetCallLogFile("/tmp/calls.jsonl")}`,
+	)
+}
+
+func TestTrackGoroutines(t *testing.T) {
+	code := generateWithOptions(t, &options{trackGoroutines: true}, `
+package blah
+
+type Getter interface {
+	Get(key string) string
+}
+`, "Getter")
+	assertContains(t, code,
+		`return &MockGetter{ut.NewCallRecords(t).SetTrackGoroutines(true)}`,
+	)
+}
+
+func TestNamedInterfaceResults(t *testing.T) {
+	code := generateFromSource(t, `
+package blah
+
+import "io"
+
+type Splitter interface {
+	Split() (a, b io.Reader, err error)
+}
+`, "Splitter")
+
+	assertContains(t, code,
+		"func (i *MockSplitter) Split() (io.Reader, io.Reader, error) {",
+		"var r_0 io.Reader\n\tif r[0] != nil {\n\t\tr_0 = r[0].(io.Reader)\n\t}",
+		"var r_1 io.Reader\n\tif r[1] != nil {\n\t\tr_1 = r[1].(io.Reader)\n\t}",
+		"return r_0, r_1, r_2",
+		"func (m *MockSplitter) SplitReturns(r0 io.Reader, r1 io.Reader, r2 error) *MockSplitter {",
+	)
+	if n := strings.Count(code, `"io"`); n != 1 {
+		t.Fatalf("Expected io to be imported once, have %d\n%s", n, code)
+	}
+}
+
+func TestMethodNameClashes(t *testing.T) {
+	tests := []struct {
+		o       *options
+		methods string
+		err     string
+	}{
+		{o: &options{}, methods: "AddCall(name string)", err: "Foo has a method AddCall, which clashes with the mock's own AddCall"},
+		{o: &options{}, methods: "SetReturns()", err: "Foo has a method SetReturns, which clashes with the mock's own SetReturns"},
+		{o: &options{}, methods: "CallTracker() int", err: "Foo has a method CallTracker, which clashes with the mock's own CallTracker"},
+		{o: &options{}, methods: "TrackCall()", err: "Foo has a method TrackCall, which clashes with the mock's own TrackCall"},
+		{o: &options{eager: true}, methods: "T() int", err: "Foo has a method T, which clashes with the mock's own T"},
+		{o: &options{}, methods: "T() int"},
+		{o: &options{logCalls: true}, methods: "LogCall()", err: "Foo has a method LogCall, which clashes with the mock's own LogCall"},
+		{o: &options{timeCalls: true}, methods: "RecordLatency()", err: "Foo has a method RecordLatency, which clashes with the mock's own RecordLatency"},
+		{o: &options{rpcStyle: true}, methods: "Get(key string) (string, error)\n\tExpectGet()", err: "Foo has a method ExpectGet, which clashes with the -rpc-style helper for Get"},
+		{o: &options{}, methods: "Get(key string) (string, error)\n\tExpectGet()"},
+		{o: &options{}, methods: "NewMockFoo() error\n\tNew() int"},
+	}
+
+	for i, test := range tests {
+		f, err := parser.ParseFile(token.NewFileSet(), "source.go", "package blah\ntype Foo interface {\n\t"+test.methods+"\n}\n", 0)
+		if err != nil {
+			t.Fatalf("Test %d, failed to parse. %v", i, err)
+		}
+		v := &InterfaceVisitor{name: "Foo"}
+		ast.Walk(v, f)
+		test.o.ifName = "Foo"
+
+		_, err = checkMethodNames(test.o, v.interfaceType)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("Test %d, unexpected error. %v", i, err)
+			}
+		} else if err == nil || err.Error() != test.err {
+			t.Errorf("Test %d, error not as expected. Have %v", i, err)
+		}
+	}
+}
+
+func TestMethodHidesTracker(t *testing.T) {
+	var w bytes.Buffer
+	warnOutput = &w
+	defer func() { warnOutput = os.Stderr }()
+
+	code := generateWithOptions(t, &options{ifName: "Job", stringer: true}, `
+package blah
+
+type Job interface {
+	AssertDone() error
+	Summary() string
+}
+`, "Job")
+	assertContains(t, code,
+		"func (i *MockJob) AssertDone() error {",
+		"func (i *MockJob) Summary() string {",
+		// String must use the tracker's Summary, not the mocked one
+		"return m.CallTracker.Summary()",
+		// The mock's AssertDone doesn't match the tracker's, so the mock
+		// isn't a ut.CallTracker
+		"m.CallTracker.AddCall(name, params...)\n\treturn m.CallTracker\n",
+		"m.CallTracker.SetReturns(params...)\n\treturn m.CallTracker\n",
+	)
+	for _, warning := range []string{
+		"Job has a method AssertDone, which hides the tracker's AssertDone. Tests can call m.CallTracker.AssertDone to reach the tracker's",
+		"Job has a method Summary, which hides the tracker's Summary.",
+	} {
+		if !strings.Contains(w.String(), warning) {
+			t.Errorf("Expected warning %q. Have %q", warning, w.String())
+		}
+	}
+}
+
+func TestTrackerMethods(t *testing.T) {
+	typ := reflect.TypeOf((*ut.CallTracker)(nil)).Elem()
+	methods := make(map[string]bool, typ.NumMethod())
+	for i := 0; i < typ.NumMethod(); i++ {
+		methods[typ.Method(i).Name] = true
+	}
+
+	listed := make(map[string]bool, len(trackerMethods))
+	for _, name := range trackerMethods {
+		if listed[name] {
+			t.Errorf("trackerMethods lists %s twice", name)
+		}
+		listed[name] = true
+		if !methods[name] {
+			t.Errorf("trackerMethods lists %s, which isn't a method of ut.CallTracker", name)
+		}
+	}
+	for name := range methods {
+		if !listed[name] {
+			t.Errorf("trackerMethods is missing %s, a method of ut.CallTracker", name)
+		}
+	}
+}
+
+func TestDirectionalChannelParams(t *testing.T) {
+	code := generateWithOptions(t, &options{strict: true}, `
+package blah
+
+import "example.com/jobs"
+
+type Worker interface {
+	Pipe(out chan<- jobs.Result, in <-chan *jobs.Job)
+	Fan(outs ...chan<- jobs.Result) error
+}
+`, "Worker")
+
+	assertContains(t, code,
+		`"example.com/jobs"`,
+		"func (i *MockWorker) Pipe(out chan<- jobs.Result, in <-chan *jobs.Job) {",
+		`i.TrackCall("Pipe", out, in)`,
+		"func (i *MockWorker) Fan(outs ...chan<- jobs.Result) error {",
+		"ut__params := make([]interface{}, 0+len(outs))",
+		"for j, p := range outs {",
+		"ut__params[0+j] = p",
+	)
+}
+
+func TestListInterfaces(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genmock")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir. %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"a.go": `package blah
+
+type Writer interface {
+	Write(p []byte) (int, error)
+}
+
+type thing struct{}
+`,
+		"b.go": `package blah
+
+type Closer interface {
+	Close() error
+}
+
+type reader interface {
+	Read(p []byte) (int, error)
+}
+`,
+		"b_test.go": `package blah_test
+
+type Tester interface {
+	Test()
+}
+`,
+	}
+	for name, src := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0666); err != nil {
+			t.Fatalf("Failed to write %s. %v", name, err)
+		}
+	}
+
+	var w bytes.Buffer
+	listOutput = &w
+	defer func() { listOutput = os.Stdout }()
+
+	listInterfaces(&options{packagePath: dir, list: true})
+	if w.String() != "Closer\nWriter\nreader\n" {
+		t.Fatalf("Interfaces not as expected. Have %q", w.String())
+	}
+
+	w.Reset()
+	o := &options{packagePath: filepath.Join(dir, "b.go"), list: true}
+	if !o.validate() {
+		t.Fatalf("Options should be valid without an interface or mock package")
+	}
+	listInterfaces(o)
+	if w.String() != "Closer\nreader\n" {
+		t.Fatalf("Interfaces not as expected. Have %q", w.String())
+	}
+}
+
+func TestParseDirSkipsBrokenFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genmock")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir. %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"a.go": `package blah
+
+type Writer interface {
+	Write(p []byte) (int, error)
+}
+`,
+		"broken.go": `package blah
+
+func oops( {
+`,
+	}
+	for name, src := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0666); err != nil {
+			t.Fatalf("Failed to write %s. %v", name, err)
+		}
+	}
+
+	var w bytes.Buffer
+	warnOutput = &w
+	defer func() { warnOutput = os.Stderr }()
+
+	nodes := parseSource(&options{packagePath: dir})
+	if len(nodes) != 1 {
+		t.Fatalf("Expected 1 package, have %d", len(nodes))
+	}
+	v := &InterfaceVisitor{name: "Writer"}
+	ast.Walk(v, nodes[0])
+	if v.interfaceType == nil {
+		t.Fatalf("Writer not found")
+	}
+	if !strings.Contains(w.String(), "Skipping broken.go as it doesn't parse") {
+		t.Fatalf("Expected a warning about broken.go. Have %q", w.String())
+	}
+}
+
+func TestBOMAndCRLF(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genmock")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir. %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := "\ufeffpackage blah\r\n\r\n// Getter gets\r\ntype Getter interface {\r\n\tGet(key string) (string, error)\r\n}\r\n"
+	file := filepath.Join(dir, "getter.go")
+	if err := ioutil.WriteFile(file, []byte(src), 0666); err != nil {
+		t.Fatalf("Failed to write source. %v", err)
+	}
+
+	for _, path := range []string{file, dir} {
+		nodes := parseSource(&options{packagePath: path})
+		if len(nodes) != 1 {
+			t.Fatalf("Expected 1 node for %s, have %d", path, len(nodes))
+		}
+		v := &InterfaceVisitor{name: "Getter"}
+		ast.Walk(v, nodes[0])
+		if v.interfaceType == nil {
+			t.Fatalf("Getter not found in %s", path)
+		}
+		if v.pkgName != "blah" {
+			t.Fatalf("Package name not as expected. Have %q", v.pkgName)
+		}
+
+		o := &options{ifName: "Getter", mockName: "MockGetter", targetPackage: "blah", srcPackage: v.pkgName}
+		code, err := buildMockForInterface(o, v.interfaceType, v.imports, v.localTypes)
+		if err != nil {
+			t.Fatalf("Failed to build mock. %v", err)
+		}
+		if strings.ContainsAny(code, "\r\ufeff") {
+			t.Fatalf("Mock should have LF line endings and no BOM. Have %q", code)
+		}
+		assertContains(t, code, "func (i *MockGetter) Get(key string) (string, error) {")
+	}
+}
+
+func TestGenericInterface(t *testing.T) {
+	pkg := &build.Package{Name: "blah", Dir: "/nowhere", ImportPath: "example.com/blah"}
+	code := generateWithOptions(t, &options{ifName: "Mapper", pkg: pkg, rpcStyle: true, declarative: true, stringer: true}, `
+package blah
+
+type Item struct{}
+
+type Mapper[T any, K comparable] interface {
+	Fn() func(T) T
+	Key(item T) (K, error)
+	Items(keys ...K) map[K]Item
+}
+`, "Mapper")
+
+	assertContains(t, code,
+		"type MockMapper[T any, K comparable] struct {",
+		"func NewMockMapper[T any, K comparable](t testing.TB) *MockMapper[T, K] {",
+		`return &MockMapper[T, K]{ut.NewCallRecords(t).SetErrorResults(map[string]ut.ErrorResult{"Key": {Index: 1, Results: 2}})}`,
+		"func (m *MockMapper[T, K]) AddCall(name string, params ...interface{}) ut.CallTracker {",
+		"func (m *MockMapper[T, K]) String() string {",
+		"func (m *MockMapper[T, K]) Expect(calls []MockMapperCall) *MockMapper[T, K] {",
+		"func (i *MockMapper[T, K]) Fn() func(T) T {",
+		"r_0 = r[0].(func(T) T)",
+		"func (m *MockMapper[T, K]) FnReturns(r0 func(T) T) *MockMapper[T, K] {",
+		"func (i *MockMapper[T, K]) Key(item T) (K, error) {",
+		"type MockMapperKeyCall[T any, K comparable] struct { m *MockMapper[T, K] }",
+		"func (m *MockMapper[T, K]) ExpectKey(req T) *MockMapperKeyCall[T, K] {",
+		"func (c *MockMapperKeyCall[T, K]) Return(resp K, err error) *MockMapper[T, K] {",
+		"func (i *MockMapper[T, K]) Items(keys ...K) map[K]utmocklocal.Item {",
+	)
+	if strings.Contains(code, "var _ ") {
+		t.Fatalf("A generic interface can't be asserted without type arguments\n%s", code)
+	}
+
+	code = generateFromSource(t, `
+package blah
+
+type Getter[T any] interface {
+	Get() T
+}
+`, "Getter")
+	assertContains(t, code,
+		"type MockGetter[T any] struct {",
+		"func (i *MockGetter[T]) Get() T {",
+		"func (m *MockGetter[T]) GetReturns(r0 T) *MockGetter[T] {",
+	)
+}
+
+func TestGenericUnnamedParams(t *testing.T) {
+	code := generateWithOptions(t, &options{ifName: "Store", rpcStyle: true}, `
+package blah
+
+type Store[K comparable, V any] interface {
+	Get(K) (V, error)
+	Put(K, V) error
+}
+`, "Store")
+
+	assertContains(t, code,
+		"type MockStore[K comparable, V any] struct {",
+		"func NewMockStore[K comparable, V any](t testing.TB) *MockStore[K, V] {",
+		"func (i *MockStore[K, V]) Get(p0 K) (V, error) {",
+		`r := i.TrackCall("Get", p0)`,
+		"func (m *MockStore[K, V]) ExpectGet(req K) *MockStoreGetCall[K, V] {",
+		"func (i *MockStore[K, V]) Put(p0 K, p1 V) error {",
+		`r := i.TrackCall("Put", p0, p1)`,
+	)
+}
+
+func TestUnnamedParams(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		exp  []string
+	}{
+		{
+			name: "unnamed",
+			src:  "Put(string, int) error",
+			exp: []string{
+				"func (i *MockStore) Put(p0 string, p1 int) error {",
+				`r := i.TrackCall("Put", p0, p1)`,
+			},
+		},
+		{
+			name: "blank",
+			src:  "Put(key string, _ int, _ bool) error",
+			exp: []string{
+				"func (i *MockStore) Put(key string, p1 int, p2 bool) error {",
+				`r := i.TrackCall("Put", key, p1, p2)`,
+			},
+		},
+		{
+			name: "clash",
+			src:  "Put(p1 string, _ int) error",
+			exp: []string{
+				"func (i *MockStore) Put(p1 string, p1_ int) error {",
+				`r := i.TrackCall("Put", p1, p1_)`,
+			},
+		},
+		{
+			name: "variadic",
+			src:  "Put(string, ...int) error",
+			exp: []string{
+				"func (i *MockStore) Put(p0 string, p1 ...int) error {",
+				"ut__params[0] = p0",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code := generateFromSource(t, `
+package blah
+
+type Store interface {
+	`+test.src+`
+}
+`, "Store")
+			assertContains(t, code, test.exp...)
+		})
+	}
+}
+
+func TestGenericCompositeParams(t *testing.T) {
+	code := generateFromSource(t, `
+package blah
+
+type Cache[K comparable, V any] interface {
+	MSet(items map[K]V)
+	MGet(keys []K) (map[K]V, error)
+	Each(fn func(K, V) bool, keys ...K) []V
+}
+`, "Cache")
+
+	assertContains(t, code,
+		"func (i *MockCache[K, V]) MSet(items map[K]V) {",
+		`i.TrackCall("MSet", items)`,
+		"func (i *MockCache[K, V]) MGet(keys []K) (map[K]V, error) {",
+		"r_0 = r[0].(map[K]V)",
+		"func (m *MockCache[K, V]) MGetReturns(r0 map[K]V, r1 error) *MockCache[K, V] {",
+		"func (i *MockCache[K, V]) Each(fn func(K, V) bool, keys ...K) []V {",
+		"ut__params := make([]interface{}, 1+len(keys))",
+		"ut__params[1+j] = p",
+		"r_0 = r[0].([]V)",
+	)
+}
+
+func TestGenericPointerToLocalType(t *testing.T) {
+	pkg := &build.Package{ImportPath: "github.com/philpearl/blah"}
+	code := generateWithOptions(t, &options{pkg: pkg}, `
+package blah
+
+type Box[T any] struct {
+	v T
+}
+
+type Pair[K comparable, V any] struct{}
+
+type Maker[T any] interface {
+	Make() *Box[T]
+	Both(b *Box[T]) (*Pair[string, *Box[T]], error)
+}
+`, "Maker")
+
+	assertContains(t, code,
+		`utmocklocal "github.com/philpearl/blah"`,
+		"func (i *MockMaker[T]) Make() *utmocklocal.Box[T] {",
+		"r_0 = r[0].(*utmocklocal.Box[T])",
+		"func (m *MockMaker[T]) MakeReturns(r0 *utmocklocal.Box[T]) *MockMaker[T] {",
+		"func (i *MockMaker[T]) Both(b *utmocklocal.Box[T]) (*utmocklocal.Pair[string, *utmocklocal.Box[T]], error) {",
+		"r_0 = r[0].(*utmocklocal.Pair[string, *utmocklocal.Box[T]])",
+	)
+	if strings.Contains(code, "utmocklocal.T") {
+		t.Fatalf("The type parameter must not be qualified\n%s", code)
+	}
+}
+
+func TestSamePackageNameElsewhere(t *testing.T) {
+	// The mock is in a package called client too, but not this one
+	pkg := &build.Package{Name: "client", Dir: "/nowhere/client", ImportPath: "example.com/client"}
+	code := generateWithOptions(t, &options{ifName: "Client", pkg: pkg, targetPackage: "client", strict: true}, `
+package client
+
+type Request struct{}
+
+type Client interface {
+	Do(req *Request) (*Request, error)
+}
+`, "Client")
+
+	assertContains(t, code,
+		"package client",
+		`utmocklocal "example.com/client"`,
+		"var _ utmocklocal.Client = (*MockClient)(nil)",
+		"func (i *MockClient) Do(req *utmocklocal.Request) (*utmocklocal.Request, error) {",
+	)
+
+	// The name we make up for the package mustn't clash with a real import
+	code = generateWithOptions(t, &options{ifName: "Client", pkg: pkg, targetPackage: "client", strict: true}, `
+package client
+
+import utmocklocal "example.com/other"
+
+type Request struct{}
+
+type Client interface {
+	Do(req *Request) (*utmocklocal.Response, error)
+}
+`, "Client")
+
+	assertContains(t, code,
+		`utmocklocal "example.com/other"`,
+		`utmocklocal2 "example.com/client"`,
+		"var _ utmocklocal2.Client = (*MockClient)(nil)",
+		"func (i *MockClient) Do(req *utmocklocal2.Request) (*utmocklocal.Response, error) {",
+	)
+}
+
+func TestLocalTypeAlias(t *testing.T) {
+	src := `
+package blah
+
+import "time"
+
+type Bytes = []byte
+
+type Stamp = time.Time
+
+type Store interface {
+	Load(key string) (Bytes, error)
+	When() Stamp
+	Save(b Bytes) []Bytes
+}
+`
+	code := generateFromSource(t, src, "Store")
+	assertContains(t, code,
+		"func (i *MockStore) Load(key string) (Bytes, error) {",
+		"r_0 = r[0].(Bytes)",
+	)
+
+	pkg := &build.Package{ImportPath: "github.com/philpearl/blah"}
+	code = generateWithOptions(t, &options{pkg: pkg, strict: true}, src, "Store")
+	assertContains(t, code,
+		`utmocklocal "github.com/philpearl/blah"`,
+		"func (i *MockStore) Load(key string) (utmocklocal.Bytes, error) {",
+		"r_0 = r[0].(utmocklocal.Bytes)",
+		"func (m *MockStore) LoadReturns(r0 utmocklocal.Bytes, r1 error) *MockStore {",
+		"func (i *MockStore) When() utmocklocal.Stamp {",
+		"func (i *MockStore) Save(b utmocklocal.Bytes) []utmocklocal.Bytes {",
+	)
+	if strings.Contains(code, `"time"`) {
+		t.Fatalf("The alias is qualified, so time is not needed\n%s", code)
+	}
+}
+
+func TestSliceOfSelf(t *testing.T) {
+	pkg := &build.Package{ImportPath: "github.com/philpearl/blah"}
+	code := generateWithOptions(t, &options{ifName: "Node", pkg: pkg, strict: true}, `
+package blah
+
+type Node interface {
+	Parent() Node
+	Children() []Node
+	Siblings() [2]Node
+	Named() map[string][]Node
+	Walk(fn func(Node) []Node) ([]*Node, error)
+}
+`, "Node")
+
+	assertContains(t, code,
+		`utmocklocal "github.com/philpearl/blah"`,
+		"var _ utmocklocal.Node = (*MockNode)(nil)",
+		"func (i *MockNode) Children() []utmocklocal.Node {",
+		"r_0 = r[0].([]utmocklocal.Node)",
+		"func (m *MockNode) ChildrenReturns(r0 []utmocklocal.Node) *MockNode {",
+		"func (i *MockNode) Siblings() [2]utmocklocal.Node {",
+		"func (i *MockNode) Named() map[string][]utmocklocal.Node {",
+		"func (i *MockNode) Walk(fn func(utmocklocal.Node) []utmocklocal.Node) ([]*utmocklocal.Node, error) {",
+	)
+}
+
+func TestConstrainedPointerParams(t *testing.T) {
+	pkg := &build.Package{ImportPath: "github.com/philpearl/blah"}
+	code := generateWithOptions(t, &options{pkg: pkg}, `
+package blah
+
+import "example.com/model"
+
+type Keyed interface {
+	Key() string
+}
+
+type Repo[T model.Entity, K Keyed] interface {
+	Store(e *T) error
+	Load(key K) (*T, error)
+}
+`, "Repo")
+
+	assertContains(t, code,
+		`"example.com/model"`,
+		`utmocklocal "github.com/philpearl/blah"`,
+		"type MockRepo[T model.Entity, K utmocklocal.Keyed] struct {",
+		"func NewMockRepo[T model.Entity, K utmocklocal.Keyed](t testing.TB) *MockRepo[T, K] {",
+		"func (i *MockRepo[T, K]) Store(e *T) error {",
+		"func (i *MockRepo[T, K]) Load(key K) (*T, error) {",
+		"r_0 = r[0].(*T)",
+	)
+}
+
+func TestInterfaceParams(t *testing.T) {
+	code := generateWithOptions(t, &options{strict: true}, `
+package blah
+
+import (
+	"net/http"
+	"io"
+)
+
+type Router interface {
+	Handle(pattern string, h http.Handler)
+	Copy(dsts ...io.Writer) (io.ReadCloser, error)
+}
+`, "Router")
+
+	assertContains(t, code,
+		`"net/http"`,
+		`"io"`,
+		"func (i *MockRouter) Handle(pattern string, h http.Handler) {",
+		`i.TrackCall("Handle", pattern, h)`,
+		"func (i *MockRouter) Copy(dsts ...io.Writer) (io.ReadCloser, error) {",
+		"ut__params[0+j] = p",
+		"r_0 = r[0].(io.ReadCloser)",
+	)
+}
+
+func TestPredeclaredMethodNames(t *testing.T) {
+	code := generateWithOptions(t, &options{ifName: "Range", matcherHelpers: true}, `
+package blah
+
+type Range interface {
+	Min() int
+	Max() int
+	Any(v any) bool
+	Append(min, max int) error
+}
+`, "Range")
+
+	assertContains(t, code,
+		"func (i *MockRange) Min() int {",
+		`r := i.TrackCall("Min")`,
+		"func (i *MockRange) Max() int {",
+		`r := i.TrackCall("Max")`,
+		"func (i *MockRange) Any(v any) bool {",
+		`r := i.TrackCall("Any", v)`,
+		// Parameters that shadow predeclared names are renamed, but methods
+		// keep their names
+		"func (i *MockRange) Append(min_, max_ int) error {",
+		`r := i.TrackCall("Append", min_, max_)`,
+		"func (m *MockRange) ExpectMin(matchers ...ut.Matcher) *MockRange {",
+		"func (m *MockRange) AppendReturns(r0 error) *MockRange {",
+	)
+}
+
+func TestAllInterfaces(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genmock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := `
+package blah
+
+import (
+	"io"
+	"time"
+)
+
+type Clock interface {
+	Now() time.Time
+}
+
+type Opener interface {
+	Open(name string) (io.ReadCloser, error)
+}
+
+type item struct{}
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "source.go"), []byte(src), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	o := &options{packagePath: "source.go", all: true, targetPackage: "blah", format: "gofmt"}
+	if !o.validate() {
+		t.Fatalf("Expected options to be valid")
+	}
+	generateMock(o)
+
+	tests := []struct {
+		file   string
+		exp    []string
+		notExp string
+	}{
+		{
+			file:   "mockclock.go",
+			exp:    []string{`"time"`, "func (i *MockClock) Now() time.Time {"},
+			notExp: `"io"`,
+		},
+		{
+			file:   "mockopener.go",
+			exp:    []string{`"io"`, "func (i *MockOpener) Open(name string) (io.ReadCloser, error) {"},
+			notExp: `"time"`,
+		},
+	}
+	for _, test := range tests {
+		data, err := ioutil.ReadFile(test.file)
+		if err != nil {
+			t.Fatalf("Expected mock %s. %v", test.file, err)
+		}
+		code := string(data)
+		assertContains(t, code, test.exp...)
+		if strings.Contains(code, test.notExp) {
+			t.Errorf("%s should not import %s\n%s", test.file, test.notExp, code)
+		}
+	}
+}
+
+func TestAllInterfacesOptions(t *testing.T) {
+	var w strings.Builder
+	errOutput = &w
+	defer func() { errOutput = os.Stderr }()
+
+	for _, o := range []*options{
+		{packagePath: "source.go", all: true, ifName: "Clock", targetPackage: "blah", format: "gofmt"},
+		{packagePath: "source.go", all: true, ifPattern: "^C", targetPackage: "blah", format: "gofmt"},
+		{packagePath: "source.go", all: true, outfile: "mocks.go", targetPackage: "blah", format: "gofmt"},
+	} {
+		if o.validate() {
+			t.Errorf("Expected options %+v to be rejected", o)
+		}
+	}
+	if exp := "You cannot specify an interface, interface pattern, outfile or mock name with -all"; !strings.Contains(w.String(), exp) {
+		t.Fatalf("Error not as expected. Have %q", w.String())
+	}
+}
+
+func TestReturnedFuncTypes(t *testing.T) {
+	code := generateWithOptions(t, &options{strict: true}, `
+package blah
+
+import "context"
+
+type Router interface {
+	Handler() func(context.Context) error
+	Fallback() func(any) error
+}
+`, "Router")
+
+	assertContains(t, code,
+		`"context"`,
+		"func (i *MockRouter) Handler() func(context.Context) error {",
+		"var r_0 func(context.Context) error",
+		"r_0 = r[0].(func(context.Context) error)",
+		"func (m *MockRouter) HandlerReturns(r0 func(context.Context) error) *MockRouter {",
+		"func (i *MockRouter) Fallback() func(any) error {",
+		"r_0 = r[0].(func(any) error)",
+	)
+}
+
+func TestHelperNameClashes(t *testing.T) {
+	var w bytes.Buffer
+	warnOutput = &w
+	defer func() { warnOutput = os.Stderr }()
+
+	// Close's typed returns helper has the name of one of the interface's
+	// methods, and Expect's typed returns helper has the name of Returns'
+	// matcher helper
+	src := `
+package blah
+
+type Closer interface {
+	Close() error
+	CloseReturns() int
+	Expect() int
+	Returns()
+}
+`
+	code := generateWithOptions(t, &options{ifName: "Closer", targetPackage: "blah", matcherHelpers: true}, src, "Closer")
+	for _, name := range []string{"CloseReturns", "ExpectReturns"} {
+		if n := strings.Count(code, ") "+name+"("); n != 1 {
+			t.Errorf("Expected one %s method, have %d\n%s", name, n, code)
+		}
+	}
+	for _, exp := range []string{
+		"Closer has a method CloseReturns, so no typed returns helper is generated for Close",
+		"MockCloser has a method ExpectReturns, so no matcher helper is generated for Returns",
+	} {
+		if !strings.Contains(w.String(), exp) {
+			t.Errorf("Expected warning %q. Have %q", exp, w.String())
+		}
+	}
+	assertCompiles(t, "example.com/blah", map[string]string{
+		"example.com/blah/source.go": src,
+		"example.com/blah/mock.go":   code,
+	})
+}
+
+func TestReturnsHelperClashesWithTracker(t *testing.T) {
+	var w bytes.Buffer
+	warnOutput = &w
+	defer func() { warnOutput = os.Stderr }()
+
+	// Set's typed returns helper would have the name of the tracker's
+	// SetReturns, which the mock promotes
+	src := `
+package blah
+
+type Setter interface {
+	Set(x int) error
+}
+`
+	code := generateWithOptions(t, &options{ifName: "Setter", targetPackage: "blah"}, src, "Setter")
+	if n := strings.Count(code, ") SetReturns("); n != 1 {
+		t.Errorf("Expected only the mock's own SetReturns, have %d\n%s", n, code)
+	}
+	exp := "ut.CallTracker has a method SetReturns, so no typed returns helper is generated for Set"
+	if !strings.Contains(w.String(), exp) {
+		t.Errorf("Expected warning %q. Have %q", exp, w.String())
+	}
+	assertCompiles(t, "example.com/blah", map[string]string{
+		"example.com/blah/source.go": src,
+		"example.com/blah/mock.go":   code,
+	})
+}
+
+func TestLastMethod(t *testing.T) {
+	var w bytes.Buffer
+	warnOutput = &w
+	defer func() { warnOutput = os.Stderr }()
+
+	// Last's typed returns helper would hide the tracker's LastReturns with a
+	// method of a different signature
+	src := `
+package blah
+
+type Stack[T any] interface {
+	Push(v T)
+	Last() T
+}
+`
+	code := generateWithOptions(t, &options{ifName: "Stack", targetPackage: "blah"}, src, "Stack")
+	if strings.Contains(code, ") LastReturns(") {
+		t.Errorf("Expected no LastReturns helper\n%s", code)
+	}
+	exp := "ut.CallTracker has a method LastReturns, so no typed returns helper is generated for Last"
+	if !strings.Contains(w.String(), exp) {
+		t.Errorf("Expected warning %q. Have %q", exp, w.String())
+	}
+	assertCompiles(t, "example.com/blah", map[string]string{
+		"example.com/blah/source.go": src,
+		"example.com/blah/mock.go":   code,
+	})
+}
+
+func TestRPCHelperNameClashes(t *testing.T) {
+	var w bytes.Buffer
+	warnOutput = &w
+	defer func() { warnOutput = os.Stderr }()
+
+	// The -rpc-style helper for Returns has the name of Expect's typed
+	// returns helper
+	src := `
+package blah
+
+type Service interface {
+	Expect(req int) (int, error)
+	Returns(req string) (string, error)
+}
+`
+	code := generateWithOptions(t, &options{ifName: "Service", targetPackage: "blah", rpcStyle: true}, src, "Service")
+	if n := strings.Count(code, ") ExpectReturns("); n != 1 {
+		t.Errorf("Expected one ExpectReturns method, have %d\n%s", n, code)
+	}
+	if !strings.Contains(code, ") ExpectReturns(req string) *MockServiceReturnsCall {") {
+		t.Errorf("Expected the -rpc-style helper for Returns\n%s", code)
+	}
+	exp := "MockService has a method ExpectReturns, so no typed returns helper is generated for Expect"
+	if !strings.Contains(w.String(), exp) {
+		t.Errorf("Expected warning %q. Have %q", exp, w.String())
+	}
+	assertCompiles(t, "example.com/blah", map[string]string{
+		"example.com/blah/source.go": src,
+		"example.com/blah/mock.go":   code,
+	})
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+)
+
+// buildMatcherHelper builds a helper for expecting a call to a method with
+// parameters checked by matchers, so a test can find the helper for each
+// method by completion rather than naming the method in a string. For a
+// method Get we build
+//
+//	func (m *MockFoo) ExpectGet(matchers ...ut.Matcher) *MockFoo {
+//		params := make([]interface{}, len(matchers))
+//		for i, matcher := range matchers {
+//			params[i] = matcher
+//		}
+//		m.CallTracker.AddCall("Get", params...)
+//		return m
+//	}
+//
+// The returns can then be set with the typed GetReturns helper.
+func buildMatcherHelper(o *options, methodName string) ([]ast.Decl, error) {
+	mockType := o.mockType()
+	code := fmt.Sprintf(`
+func (m *%s) Expect%s(matchers ...ut.Matcher) *%s {
+	params := make([]interface{}, len(matchers))
+	for i, matcher := range matchers {
+		params[i] = matcher
+	}
+	m.CallTracker.AddCall(%q, params...)
+	return m
+}
+`,
+		mockType, methodName, mockType,
+		methodName,
+	)
+
+	return parseDecls(code)
+}
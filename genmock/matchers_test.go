@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMatcherHelpers(t *testing.T) {
+	var w bytes.Buffer
+	warnOutput = &w
+	defer func() { warnOutput = os.Stderr }()
+
+	code := generateWithOptions(t, &options{ifName: "Store", matcherHelpers: true}, `
+package blah
+
+type Store interface {
+	Get(key string) (string, error)
+	Put(key, value string)
+	Delete(key string)
+	ExpectDelete()
+}
+`, "Store")
+
+	assertContains(t, code,
+		"func (m *MockStore) ExpectGet(matchers ...ut.Matcher) *MockStore {",
+		`m.CallTracker.AddCall("Get", params...)`,
+		"func (m *MockStore) GetReturns(r0 string, r1 error) *MockStore {",
+		"func (m *MockStore) ExpectPut(matchers ...ut.Matcher) *MockStore {",
+		`m.CallTracker.AddCall("Put", params...)`,
+		"func (i *MockStore) ExpectDelete() {",
+	)
+	if strings.Contains(code, "func (m *MockStore) ExpectDelete(") {
+		t.Errorf("No helper should be built for Delete, as it clashes with a method\n%s", code)
+	}
+	if exp := "Store has a method ExpectDelete, so no matcher helper is generated for Delete"; !strings.Contains(w.String(), exp) {
+		t.Errorf("Expected warning %q. Have %q", exp, w.String())
+	}
+}
+
+func TestMatcherHelpersGeneric(t *testing.T) {
+	code := generateWithOptions(t, &options{matcherHelpers: true}, `
+package blah
+
+type Cache[K comparable, V any] interface {
+	Get(key K) V
+}
+`, "Cache")
+
+	assertContains(t, code,
+		"func (m *MockCache[K, V]) ExpectGet(matchers ...ut.Matcher) *MockCache[K, V] {",
+	)
+}
+
+func TestMatcherHelpersWithRPCStyle(t *testing.T) {
+	var w bytes.Buffer
+	errOutput = &w
+	defer func() { errOutput = os.Stderr }()
+
+	o := &options{
+		packagePath:    "source.go",
+		ifName:         "Store",
+		targetPackage:  "blah",
+		format:         "gofmt",
+		rpcStyle:       true,
+		matcherHelpers: true,
+	}
+	if o.validate() {
+		t.Fatalf("Expected -rpc-style with -matcher-helpers to be rejected")
+	}
+}
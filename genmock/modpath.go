@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// go/build only resolves a relative package path like ./internal/foo to an
+// import path within GOPATH. In a module it leaves the import path as it was
+// given, which can't be imported from the mock, so we work out the import
+// path from the module's go.mod.
+
+// moduleImportPath returns the import path of the package in dir, from the
+// path of the module containing it
+func moduleImportPath(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for modDir := dir; ; {
+		data, err := ioutil.ReadFile(filepath.Join(modDir, "go.mod"))
+		if err == nil {
+			modPath := modulePath(data)
+			if modPath == "" {
+				return "", fmt.Errorf("no module path in %s", filepath.Join(modDir, "go.mod"))
+			}
+			rel, err := filepath.Rel(modDir, dir)
+			if err != nil {
+				return "", err
+			}
+			if rel == "." {
+				return modPath, nil
+			}
+			return modPath + "/" + filepath.ToSlash(rel), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+
+		parent := filepath.Dir(modDir)
+		if parent == modDir {
+			return "", fmt.Errorf("%s is not in a module", dir)
+		}
+		modDir = parent
+	}
+}
+
+// modulePath returns the module path from the contents of a go.mod file, or
+// "" if there isn't one
+func modulePath(gomod []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(gomod))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[0] != "module" {
+			continue
+		}
+		path := fields[1]
+		if unquoted, err := strconv.Unquote(path); err == nil {
+			path = unquoted
+		}
+		return path
+	}
+	return ""
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestModulePath(t *testing.T) {
+	tests := []struct {
+		gomod string
+		exp   string
+	}{
+		{gomod: "module example.com/thing\n\ngo 1.18\n", exp: "example.com/thing"},
+		{gomod: "// The thing\nmodule example.com/thing // comment\n", exp: "example.com/thing"},
+		{gomod: "module \"example.com/quoted\"\n", exp: "example.com/quoted"},
+		{gomod: "go 1.18\n", exp: ""},
+		{gomod: "modules example.com/thing\n", exp: ""},
+	}
+
+	for i, test := range tests {
+		if path := modulePath([]byte(test.gomod)); path != test.exp {
+			t.Errorf("Test %d, module path not as expected. Have %q", i, path)
+		}
+	}
+}
+
+func TestRelativePackageInModule(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genmock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"go.mod":              "module example.com/thing\n\ngo 1.18\n",
+		"internal/foo/foo.go": "package foo\n\ntype Item struct{}\n\ntype Foo interface {\n\tGet() Item\n}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	o := &options{packagePath: "./internal/foo"}
+	if !o.resolvePackage() {
+		t.Fatalf("Failed to resolve the package")
+	}
+	if o.pkg.ImportPath != "example.com/thing/internal/foo" {
+		t.Fatalf("Import path not as expected. Have %q", o.pkg.ImportPath)
+	}
+
+	if path, err := moduleImportPath("."); err != nil || path != "example.com/thing" {
+		t.Fatalf("Import path of the module root not as expected. Have %q, %v", path, err)
+	}
+}
+
+func TestRelativePackageOutsideModule(t *testing.T) {
+	f, err := parser.ParseFile(token.NewFileSet(), "foo.go", "package foo\n\ntype Item struct{}\n\ntype Foo interface {\n\tGet() Item\n}\n", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &InterfaceVisitor{name: "Foo"}
+	ast.Walk(v, f)
+
+	o := &options{
+		ifName:        "Foo",
+		mockName:      "MockFoo",
+		targetPackage: "mocks",
+		srcPackage:    "foo",
+		pkg:           &build.Package{Name: "foo", Dir: "/nowhere/foo", ImportPath: "./foo"},
+	}
+	_, err = buildMockForInterface(o, v.interfaceType, v.imports, v.localTypes)
+	if err == nil || err.Error() != "can't find the import path for ./foo, so the mock must be built in the same package. Run genmock within a module or GOPATH" {
+		t.Fatalf("Error not as expected. Have %v", err)
+	}
+}
@@ -4,26 +4,73 @@ import (
 	"go/ast"
 	"go/parser"
 	"go/token"
+	"reflect"
 )
 
-// parseCodeBlock() parses a block of code.
+// clearPositions removes all position information from the AST in place.
 //
-// It works by embedding the code in a dummy go file with a function, then
-// extracting the AST for the code block we're interested in
-func parseCodeBlock(code string) ([]ast.Stmt, error) {
-	// Embed the code in a function and add a package
-	code = "package dummy\nfunc dummy() {\n" + code + "\n}\n"
+// The mock is built from pieces of AST from different files: the interface
+// source, the code blocks we parse and the basic mock file. Positions from one
+// file make no sense in another, and confuse the printer into adding odd line
+// breaks. Without positions the printer lays code out in the standard way.
+func clearPositions(n ast.Node) {
+	posType := reflect.TypeOf(token.NoPos)
+	ast.Inspect(n, func(n ast.Node) bool {
+		if n == nil {
+			return false
+		}
+
+		// A valid Ellipsis position is how a call indicates it has a ...
+		// argument, so we need to keep one
+		call, ok := n.(*ast.CallExpr)
+		ellipsis := ok && call.Ellipsis.IsValid()
+
+		v := reflect.ValueOf(n).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Field(i); f.Type() == posType {
+				f.Set(reflect.ValueOf(token.NoPos))
+			}
+		}
+
+		if ellipsis {
+			call.Ellipsis = 1
+		}
+		return true
+	})
+
+	// The printer only keeps an empty interface{} or struct{} on one line if
+	// its braces have positions on the same line
+	ast.Inspect(n, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.InterfaceType:
+			keepEmptyBracesTogether(n.Methods)
+		case *ast.StructType:
+			keepEmptyBracesTogether(n.Fields)
+		}
+		return true
+	})
+}
+
+func keepEmptyBracesTogether(fl *ast.FieldList) {
+	if fl != nil && len(fl.List) == 0 {
+		fl.Opening = 1
+		fl.Closing = 1
+	}
+}
+
+// parseDecls parses a block of top-level declarations, returning them with
+// positions cleared so they can be added to the mock.
+func parseDecls(code string) ([]ast.Decl, error) {
+	code = "package dummy\n" + code
 
-	// Parse the code
 	fset := token.NewFileSet()
 	af, err := parser.ParseFile(fset, "dummy.go", code, 0)
 	if err != nil {
 		return nil, err
 	}
 
-	// Extract the statements we need
-	v := &blockVisitor{}
-	ast.Walk(v, af)
-
-	return v.stmts, nil
+	for _, d := range af.Decls {
+		clearPositions(d)
+	}
+	return af.Decls, nil
 }
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// buildReturnsHelper builds a typed helper for setting the return values of a
+// method, so the compiler checks the types of the values a test primes. For a
+// method
+//
+//	Get() (int, error)
+//
+// we build
+//
+//	func (m *MockFoo) GetReturns(r0 int, r1 error) *MockFoo {
+//		m.CallTracker.SetReturns(r0, r1)
+//		return m
+//	}
+func buildReturnsHelper(mock ast.Expr, methodName string, results *ast.FieldList) *ast.FuncDecl {
+	params := &ast.FieldList{}
+	args := []ast.Expr{}
+	for i, f := range results.List {
+		name := fmt.Sprintf("r%d", i)
+		params.List = append(params.List, &ast.Field{
+			Names: []*ast.Ident{ast.NewIdent(name)},
+			Type:  f.Type,
+		})
+		args = append(args, ast.NewIdent(name))
+	}
+
+	mockType := &ast.StarExpr{X: mock}
+	return &ast.FuncDecl{
+		Recv: &ast.FieldList{
+			List: []*ast.Field{
+				{
+					Names: []*ast.Ident{ast.NewIdent("m")},
+					Type:  mockType,
+				},
+			},
+		},
+		Name: ast.NewIdent(methodName + "Returns"),
+		Type: &ast.FuncType{
+			Params: params,
+			Results: &ast.FieldList{
+				List: []*ast.Field{{Type: mockType}},
+			},
+		},
+		Body: &ast.BlockStmt{
+			List: []ast.Stmt{
+				// m.CallTracker.SetReturns(r0, r1)
+				&ast.ExprStmt{
+					X: &ast.CallExpr{
+						Fun: &ast.SelectorExpr{
+							X: &ast.SelectorExpr{
+								X:   ast.NewIdent("m"),
+								Sel: ast.NewIdent("CallTracker"),
+							},
+							Sel: ast.NewIdent("SetReturns"),
+						},
+						Args: args,
+					},
+				},
+				// return m
+				&ast.ReturnStmt{
+					Results: []ast.Expr{ast.NewIdent("m")},
+				},
+			},
+		},
+	}
+}
+
+// errorResult notes where a method returns its error
+type errorResult struct {
+	method  string
+	index   int
+	results int
+}
+
+// findErrorResults finds where each method of the interface returns an
+// error. The error is found by type rather than position, as it isn't always
+// the last result. Methods without an error result are left out.
+func findErrorResults(t *ast.InterfaceType) []errorResult {
+	var found []errorResult
+	for _, m := range t.Methods.List {
+		ft, ok := m.Type.(*ast.FuncType)
+		if !ok || ft.Results == nil {
+			continue
+		}
+		index := -1
+		results := 0
+		for _, f := range ft.Results.List {
+			if id, ok := f.Type.(*ast.Ident); ok && id.Name == "error" && index < 0 {
+				index = results
+			}
+			if len(f.Names) == 0 {
+				results++
+			} else {
+				results += len(f.Names)
+			}
+		}
+		if index < 0 {
+			continue
+		}
+		for _, n := range m.Names {
+			found = append(found, errorResult{method: n.Name, index: index, results: results})
+		}
+	}
+	return found
+}
+
+// errorResultsLiteral builds the descriptor that tells the tracker where each
+// method returns its error, for ReturnsError. The constructor passes it
+// straight to SetErrorResults, so tests can't change it for other tests.
+//
+//	map[string]ut.ErrorResult{"Get": {Index: 1, Results: 2}}
+func errorResultsLiteral(found []errorResult) string {
+	var b strings.Builder
+	b.WriteString("map[string]ut.ErrorResult{")
+	for i, er := range found {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%q: {Index: %d, Results: %d}", er.method, er.index, er.results)
+	}
+	b.WriteString("}")
+	return b.String()
+}
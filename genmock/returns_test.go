@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReturnsHelper(t *testing.T) {
+	var w bytes.Buffer
+	warnOutput = &w
+	defer func() { warnOutput = os.Stderr }()
+
+	code := generateWithOptions(t, &options{ifName: "Getter"}, `
+package blah
+
+import "io"
+
+type Getter interface {
+	Get() (int, error)
+	Open(name string) (r io.Reader)
+	Close()
+	Put(v int) bool
+	PutReturns() error
+}
+`, "Getter")
+
+	assertContains(t, code,
+		"func (m *MockGetter) GetReturns(r0 int, r1 error) *MockGetter {",
+		"m.CallTracker.SetReturns(r0, r1)",
+		"return m",
+		"func (m *MockGetter) OpenReturns(r0 io.Reader) *MockGetter {",
+		"func (m *MockGetter) PutReturnsReturns(r0 error) *MockGetter {",
+	)
+	for _, name := range []string{"CloseReturns", "func (m *MockGetter) PutReturns("} {
+		if strings.Contains(code, name) {
+			t.Errorf("%s should not be generated\n%s", name, code)
+		}
+	}
+	exp := "genmock: warning: Getter has a method PutReturns, so no typed returns helper is generated for Put\n"
+	if w.String() != exp {
+		t.Fatalf("Warning not as expected. Have %q", w.String())
+	}
+}
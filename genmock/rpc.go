@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+)
+
+// isRPCMethod indicates whether a method has the RPC shape of a single
+// request parameter and a response plus error result.
+func isRPCMethod(t *ast.FuncType) bool {
+	if t.Params.NumFields() != 1 || t.Results.NumFields() != 2 {
+		return false
+	}
+	if _, ok := t.Params.List[0].Type.(*ast.Ellipsis); ok {
+		return false
+	}
+	last := t.Results.List[len(t.Results.List)-1]
+	id, ok := last.Type.(*ast.Ident)
+	return ok && id.Name == "error"
+}
+
+// buildRPCHelpers builds typed helpers for priming an RPC-style method, so
+// that type mistakes in a test are caught by the compiler. For a method
+//
+//	Get(req GetRequest) (GetResponse, error)
+//
+// we build
+//
+//	type MockFooGetCall struct {
+//		m *MockFoo
+//	}
+//
+//	func (m *MockFoo) ExpectGet(req GetRequest) *MockFooGetCall {
+//		m.CallTracker.AddCall("Get", req)
+//		return &MockFooGetCall{m}
+//	}
+//
+//	func (c *MockFooGetCall) Return(resp GetResponse, err error) *MockFoo {
+//		c.m.CallTracker.SetReturns(resp, err)
+//		return c.m
+//	}
+func buildRPCHelpers(o *options, methodName string, t *ast.FuncType) ([]ast.Decl, error) {
+	// For a generic interface the call type is generic too
+	callName := o.mockName + methodName + "Call"
+	callType := callName + strings.TrimPrefix(o.mockType(), o.mockName)
+	mockType := o.mockType()
+	code := fmt.Sprintf(`
+type %s%s struct {
+	m *%s
+}
+
+func (m *%s) Expect%s(req %s) *%s {
+	m.CallTracker.AddCall(%q, req)
+	return &%s{m}
+}
+
+func (c *%s) Return(resp %s, err error) *%s {
+	c.m.CallTracker.SetReturns(resp, err)
+	return c.m
+}
+`,
+		callName, o.typeParamsDecl(), mockType,
+		mockType, methodName, types.ExprString(t.Params.List[0].Type), callType,
+		methodName,
+		callType,
+		callType, types.ExprString(t.Results.List[0].Type), mockType,
+	)
+
+	return parseDecls(code)
+}
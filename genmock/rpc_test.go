@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRPCStyle(t *testing.T) {
+	src := `
+package blah
+
+type GetRequest struct{}
+type GetResponse struct{}
+
+type Service interface {
+	Get(req GetRequest) (*GetResponse, error)
+	Put(ctx string, req GetRequest) error
+	List() ([]GetResponse, error)
+}
+`
+	code := generateWithOptions(t, &options{rpcStyle: true}, src, "Service")
+	assertContains(t, code,
+		"type MockServiceGetCall struct { m *MockService }",
+		"func (m *MockService) ExpectGet(req GetRequest) *MockServiceGetCall {",
+		`m.CallTracker.AddCall("Get", req)`,
+		"func (c *MockServiceGetCall) Return(resp *GetResponse, err error) *MockService {",
+		"c.m.CallTracker.SetReturns(resp, err)",
+	)
+	for _, name := range []string{"ExpectPut", "ExpectList"} {
+		if strings.Contains(code, name) {
+			t.Errorf("%s should not be generated\n%s", name, code)
+		}
+	}
+
+	code = generateFromSource(t, src, "Service")
+	if strings.Contains(code, "ExpectGet") {
+		t.Fatalf("Helpers should not be generated by default\n%s", code)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+)
+
+// testifyMethods are the methods buildTestifyHelpers adds to the mock
+var testifyMethods = []string{"On", "Return", "AssertExpectations"}
+
+// buildTestifyHelpers builds methods named like those of testify's mock.Mock,
+// to ease moving tests over from testify.
+//
+//	m.On("Get", 1).Return("a", nil)  // m.AddCall("Get", 1).SetReturns("a", nil)
+//	m.AssertExpectations(t)          // m.AssertDone()
+func buildTestifyHelpers(o *options) ([]ast.Decl, error) {
+	mockType := o.mockType()
+	code := fmt.Sprintf(`
+func (m *%s) On(method string, args ...interface{}) *%s {
+	m.CallTracker.AddCall(method, args...)
+	return m
+}
+
+func (m *%s) Return(returns ...interface{}) *%s {
+	m.CallTracker.SetReturns(returns...)
+	return m
+}
+
+func (m *%s) AssertExpectations(t testing.TB) bool {
+	return m.CallTracker.AssertDoneWith(t)
+}
+`,
+		mockType, mockType,
+		mockType, mockType,
+		mockType,
+	)
+
+	return parseDecls(code)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTestifyCompat(t *testing.T) {
+	src := `
+package blah
+
+type Store interface {
+	Get(id int) (string, error)
+}
+`
+	code := generateWithOptions(t, &options{testifyCompat: true}, src, "Store")
+	assertContains(t, code,
+		"func (m *MockStore) On(method string, args ...interface{}) *MockStore {",
+		"m.CallTracker.AddCall(method, args...)",
+		"func (m *MockStore) Return(returns ...interface{}) *MockStore {",
+		"m.CallTracker.SetReturns(returns...)",
+		"func (m *MockStore) AssertExpectations(t testing.TB) bool {",
+		"return m.CallTracker.AssertDoneWith(t)",
+	)
+
+	code = generateFromSource(t, src, "Store")
+	if strings.Contains(code, "AssertExpectations") {
+		t.Fatalf("Testify methods should not be generated by default\n%s", code)
+	}
+}
+
+func TestTestifyCompatClash(t *testing.T) {
+	var w bytes.Buffer
+	warnOutput = &w
+	defer func() { warnOutput = os.Stderr }()
+
+	code := generateWithOptions(t, &options{ifName: "Switch", testifyCompat: true}, `
+package blah
+
+type Switch interface {
+	On() error
+}
+`, "Switch")
+
+	if strings.Contains(code, "AssertExpectations") {
+		t.Fatalf("Testify methods should not be generated\n%s", code)
+	}
+	if w.String() != "genmock: warning: Switch already has a method On, so -testify-compat is ignored\n" {
+		t.Fatalf("Warning not as expected. Have %q", w.String())
+	}
+}
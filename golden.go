@@ -0,0 +1,261 @@
+package ut
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// Golden files hold the calls made to a mock, so a test can be primed with
+// the interactions from an earlier run rather than setting up each
+// expectation by hand. SaveGolden writes the calls a tracker has seen, and
+// LoadGolden adds them as expectations on a mock.
+//
+//	// Record, with a mock that forwards to a real implementation
+//	m := NewMockStore(t)
+//	m.SetDefaultFunc("Get", func(params ...interface{}) []interface{} {
+//		v, err := real.Get(params[0].(string))
+//		return []interface{}{v, err}
+//	})
+//	UnderTest(m)
+//	ut.SaveGolden(t, m, "testdata/store.json")
+//
+//	// Replay
+//	m := NewMockStore(t)
+//	ut.LoadGolden(t, m, "testdata/store.json")
+//	UnderTest(m)
+//	m.AssertDone()
+//
+// The file has the call log's layout, one JSON object per line giving the
+// test, index, method, args and returns. Unlike the call log, parameters and
+// returns are written as JSON values so they can be read back. Errors are
+// written as their message, and read back as errors with the same message.
+//
+// Values of interface types can't always be read back as they were written.
+// Args of type interface{} match any value written as the same JSON, so an
+// int matches even though the number would be read back as a float64. Error
+// args match any error with the same message, and args of other interface
+// types, such as context.Context, are only checked to be nil or not. Returns
+// of type interface{} come back as encoding/json reads them, so numbers are
+// float64s, and returns of other interface types can only be read back if nil.
+
+// goldenCall is a call as written to a golden file
+type goldenCall struct {
+	Test    string            `json:"test"`
+	Index   int               `json:"index"`
+	Method  string            `json:"method"`
+	Args    []json.RawMessage `json:"args"`
+	Returns []json.RawMessage `json:"returns"`
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// SaveGolden writes the calls tracked so far to a golden file at path,
+// replacing the file if it exists. It fails the test if a parameter or return
+// can't be written as JSON, such as a function.
+func SaveGolden(t testing.TB, ct CallTracker, path string) {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, c := range ct.Log() {
+		line := goldenCall{
+			Test:   t.Name(),
+			Index:  c.Index,
+			Method: c.Method,
+		}
+		var err error
+		if line.Args, err = marshalGoldenValues(c.Args); err != nil {
+			t.Fatalf("Failed to write the args of call %d to %s to golden file %s. %v", c.Index, c.Method, path, err)
+		}
+		if line.Returns, err = marshalGoldenValues(c.Returns); err != nil {
+			t.Fatalf("Failed to write the returns of call %d to %s to golden file %s. %v", c.Index, c.Method, path, err)
+		}
+		data, err := json.Marshal(line)
+		if err != nil {
+			t.Fatalf("Failed to write call %d to %s to golden file %s. %v", c.Index, c.Method, path, err)
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0666); err != nil {
+		t.Fatalf("Failed to write golden file. %v", err)
+	}
+}
+
+func marshalGoldenValues(vals []interface{}) ([]json.RawMessage, error) {
+	raw := make([]json.RawMessage, len(vals))
+	for i, v := range vals {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		raw[i] = data
+	}
+	return raw, nil
+}
+
+// LoadGolden reads the calls from the golden file at path and adds them to
+// the mock as expected calls, with their returns. The types to read the
+// parameters and returns into come from the mock's methods, so the methods
+// must be exported. It fails the test if the file can't be read or doesn't
+// match the mock.
+func LoadGolden(t testing.TB, mock CallTracker, path string) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open golden file. %v", err)
+	}
+	defer f.Close()
+
+	mv := reflect.ValueOf(mock)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<24)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var c goldenCall
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			t.Fatalf("Failed to read line %d of golden file %s. %v", line, path, err)
+		}
+		method := mv.MethodByName(c.Method)
+		if !method.IsValid() {
+			t.Fatalf("Line %d of golden file %s is a call to %s, but %T has no exported method %s", line, path, c.Method, mock, c.Method)
+		}
+		mt := method.Type()
+
+		args := make([]interface{}, len(c.Args))
+		for i, raw := range c.Args {
+			var typ reflect.Type
+			switch {
+			case mt.IsVariadic() && i >= mt.NumIn()-1:
+				typ = mt.In(mt.NumIn() - 1).Elem()
+			case i < mt.NumIn():
+				typ = mt.In(i)
+			default:
+				t.Fatalf("Line %d of golden file %s has %d args, but %s has %d parameters", line, path, len(c.Args), c.Method, mt.NumIn())
+			}
+			if args[i], err = unmarshalGoldenArg(raw, typ); err != nil {
+				t.Fatalf("Failed to read arg %d on line %d of golden file %s. %v", i, line, path, err)
+			}
+		}
+		mock.AddCall(c.Method, args...)
+
+		if len(c.Returns) == 0 {
+			continue
+		}
+		if len(c.Returns) != mt.NumOut() {
+			t.Fatalf("Line %d of golden file %s has %d returns, but %s has %d results", line, path, len(c.Returns), c.Method, mt.NumOut())
+		}
+		returns := make([]interface{}, len(c.Returns))
+		for i, raw := range c.Returns {
+			if returns[i], err = unmarshalGoldenValue(raw, mt.Out(i)); err != nil {
+				t.Fatalf("Failed to read return %d on line %d of golden file %s. %v", i, line, path, err)
+			}
+		}
+		mock.SetReturns(returns...)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("Failed to read golden file %s. %v", path, err)
+	}
+}
+
+// unmarshalGoldenArg reads an arg written by SaveGolden for a parameter of
+// type typ. Args of interface types become Matchers, as we can't know what
+// type of value they held
+func unmarshalGoldenArg(raw json.RawMessage, typ reflect.Type) (interface{}, error) {
+	if typ.Kind() != reflect.Interface || string(raw) == "null" {
+		return unmarshalGoldenValue(raw, typ)
+	}
+	switch {
+	case typ == errorType:
+		var msg string
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			return nil, fmt.Errorf("errors should be written as their message. %v", err)
+		}
+		return goldenErrorMatcher{msg: msg}, nil
+	case typ.NumMethod() == 0:
+		return goldenJSONMatcher{raw: raw}, nil
+	}
+	return goldenTypeMatcher{typ: typ}, nil
+}
+
+// goldenErrorMatcher matches errors with the message written to a golden file
+type goldenErrorMatcher struct {
+	msg string
+}
+
+func (g goldenErrorMatcher) Match(actual interface{}) bool {
+	err, ok := actual.(error)
+	return ok && err.Error() == g.msg
+}
+
+func (g goldenErrorMatcher) String() string {
+	return fmt.Sprintf("error %q", g.msg)
+}
+
+// goldenJSONMatcher matches values that are written as the JSON in a golden
+// file
+type goldenJSONMatcher struct {
+	raw json.RawMessage
+}
+
+func (g goldenJSONMatcher) Match(actual interface{}) bool {
+	data, err := json.Marshal(actual)
+	if err != nil {
+		return false
+	}
+	var a, e interface{}
+	if json.Unmarshal(data, &a) != nil || json.Unmarshal(g.raw, &e) != nil {
+		return false
+	}
+	return reflect.DeepEqual(a, e)
+}
+
+func (g goldenJSONMatcher) String() string {
+	return "JSON " + string(g.raw)
+}
+
+// goldenTypeMatcher matches any non-nil value of an interface type
+type goldenTypeMatcher struct {
+	typ reflect.Type
+}
+
+func (g goldenTypeMatcher) Match(actual interface{}) bool {
+	return actual != nil && reflect.TypeOf(actual).Implements(g.typ)
+}
+
+func (g goldenTypeMatcher) String() string {
+	return "any " + g.typ.String()
+}
+
+// unmarshalGoldenValue reads a value written by SaveGolden into the type typ
+func unmarshalGoldenValue(raw json.RawMessage, typ reflect.Type) (interface{}, error) {
+	if typ == errorType {
+		var msg *string
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			return nil, fmt.Errorf("errors should be written as their message. %v", err)
+		}
+		if msg == nil {
+			return nil, nil
+		}
+		return errors.New(*msg), nil
+	}
+	if typ.Kind() == reflect.Interface && typ.NumMethod() != 0 && string(raw) != "null" {
+		return nil, fmt.Errorf("values of interface type %s can't be read back unless they are null", typ)
+	}
+
+	v := reflect.New(typ)
+	if err := json.Unmarshal(raw, v.Interface()); err != nil {
+		return nil, err
+	}
+	return v.Elem().Interface(), nil
+}
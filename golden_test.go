@@ -0,0 +1,365 @@
+package ut
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// MockKV is laid out as genmock would
+type MockKV struct {
+	CallTracker
+}
+
+func (m *MockKV) Get(key string) (string, error) {
+	r := m.TrackCall("Get", key)
+	r = FillReturns(m.CallTracker, "Get", r, 2)
+	var r_0 string
+	if r[0] != nil {
+		r_0 = r[0].(string)
+	}
+	var r_1 error
+	if r[1] != nil {
+		r_1 = r[1].(error)
+	}
+	return r_0, r_1
+}
+
+func (m *MockKV) Put(key string, val []byte, tags ...string) error {
+	params := make([]interface{}, 2+len(tags))
+	params[0] = key
+	params[1] = val
+	for i, tag := range tags {
+		params[2+i] = tag
+	}
+	r := m.TrackCall("Put", params...)
+	r = FillReturns(m.CallTracker, "Put", r, 1)
+	var r_0 error
+	if r[0] != nil {
+		r_0 = r[0].(error)
+	}
+	return r_0
+}
+
+// copyKey copies a value from one key to another
+func copyKey(kv *MockKV, from, to string) error {
+	v, err := kv.Get(from)
+	if err != nil {
+		return err
+	}
+	if err := kv.Put(to, []byte(v), "copied", "from-"+from); err != nil {
+		return err
+	}
+	_, err = kv.Get("missing")
+	return err
+}
+
+func TestGoldenRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ut")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "kv.json")
+
+	// Record
+	m := &MockKV{NewCallRecords(t)}
+	m.AddCall("Get", "a").SetReturns("apple", nil)
+	m.AddCall("Put", "b", []byte("apple"), "copied", "from-a").SetReturns(nil)
+	m.AddCall("Get", "missing").SetReturns("", errors.New("not found"))
+	if err := copyKey(m, "a", "b"); err == nil || err.Error() != "not found" {
+		t.Fatalf("Expected not found, have %v", err)
+	}
+	m.AssertDone()
+	SaveGolden(t, m, path)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 || lines[2] != `{"test":"TestGoldenRoundTrip","index":2,"method":"Get","args":["missing"],"returns":["","not found"]}` {
+		t.Fatalf("Golden file not as expected.\n%s", data)
+	}
+
+	// Replay
+	m = &MockKV{NewCallRecords(t)}
+	LoadGolden(t, m, path)
+	if err := copyKey(m, "a", "b"); err == nil || err.Error() != "not found" {
+		t.Fatalf("Expected not found, have %v", err)
+	}
+	m.AssertDone()
+
+	// A change in behaviour is caught
+	f := &failRecorder{TB: t}
+	m = &MockKV{NewCallRecords(f)}
+	LoadGolden(f, m, path)
+	m.Get("b")
+	if !f.failed {
+		t.Fatalf("Expected a call that differs from the golden file to fail")
+	}
+}
+
+func TestSaveGoldenUnwritable(t *testing.T) {
+	m := &MockTenantStore{NewCallRecords(t)}
+	m.RecordCall("Get")
+	m.Get("t1", "key")
+
+	// A function can't be written as JSON
+	m.RecordCall("Put")
+	m.TrackCall("Put", func() {})
+
+	f := &stopRecorder{TB: t}
+	f.run(func() { SaveGolden(f, m, filepath.Join(os.TempDir(), "ut-unwritable.json")) })
+	if !strings.HasPrefix(f.fatal, "Failed to write the args of call 1 to Put to golden file") {
+		t.Fatalf("Failure not as expected. Have %q", f.fatal)
+	}
+}
+
+func TestLoadGoldenMismatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ut")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		golden string
+		msg    string
+	}{
+		{
+			golden: `{"method":"Delete","args":["a"]}`,
+			msg:    "Line 1 of golden file %s is a call to Delete, but *ut.MockKV has no exported method Delete",
+		},
+		{
+			golden: `{"method":"Get","args":["a", "b"]}`,
+			msg:    "Line 1 of golden file %s has 2 args, but Get has 1 parameters",
+		},
+		{
+			golden: "\n" + `{"method":"Get","args":["a"],"returns":["apple"]}`,
+			msg:    "Line 2 of golden file %s has 1 returns, but Get has 2 results",
+		},
+		{
+			golden: `{"method":"Get","args":[37]}`,
+			msg:    "Failed to read arg 0 on line 1 of golden file %s. json: cannot unmarshal number into Go value of type string",
+		},
+	}
+
+	for i, test := range tests {
+		path := filepath.Join(dir, "kv.json")
+		if err := ioutil.WriteFile(path, []byte(test.golden), 0666); err != nil {
+			t.Fatal(err)
+		}
+		f := &stopRecorder{TB: t}
+		m := &MockKV{NewCallRecords(f)}
+		f.run(func() { LoadGolden(f, m, path) })
+		if exp := strings.Replace(test.msg, "%s", path, 1); f.fatal != exp {
+			t.Errorf("Test %d, failure not as expected. Have %q, want %q", i, f.fatal, exp)
+		}
+	}
+}
+
+// mapKV is a real implementation of MockKV's Get
+type mapKV map[string]string
+
+func (kv mapKV) Get(key string) (string, error) {
+	v, ok := kv[key]
+	if !ok {
+		return "", errors.New("not found")
+	}
+	return v, nil
+}
+
+func TestGoldenRecordFromReal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ut")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "kv.json")
+
+	// Record, as in the package docs
+	real := mapKV{"a": "apple"}
+	m := &MockKV{NewCallRecords(t)}
+	m.SetDefaultFunc("Get", func(params ...interface{}) []interface{} {
+		v, err := real.Get(params[0].(string))
+		return []interface{}{v, err}
+	})
+	m.Get("a")
+	m.Get("b")
+	SaveGolden(t, m, path)
+
+	// Replay
+	m = &MockKV{NewCallRecords(t)}
+	LoadGolden(t, m, path)
+	if v, err := m.Get("a"); v != "apple" || err != nil {
+		t.Fatalf("Get(a) returned %q, %v", v, err)
+	}
+	if v, err := m.Get("b"); v != "" || err == nil || err.Error() != "not found" {
+		t.Fatalf("Get(b) returned %q, %v", v, err)
+	}
+	m.AssertDone()
+}
+
+// MockFetcher has parameters and results of interface types, laid out as
+// genmock would
+type MockFetcher struct {
+	CallTracker
+}
+
+func (m *MockFetcher) Fetch(ctx context.Context, key interface{}) (interface{}, error) {
+	r := m.TrackCall("Fetch", ctx, key)
+	r = FillReturns(m.CallTracker, "Fetch", r, 2)
+	var r_1 error
+	if r[1] != nil {
+		r_1 = r[1].(error)
+	}
+	return r[0], r_1
+}
+
+func (m *MockFetcher) Report(err error) {
+	m.TrackCall("Report", err)
+}
+
+func (m *MockFetcher) Open(name string) (io.Reader, error) {
+	r := m.TrackCall("Open", name)
+	r = FillReturns(m.CallTracker, "Open", r, 2)
+	var r_0 io.Reader
+	if r[0] != nil {
+		r_0 = r[0].(io.Reader)
+	}
+	var r_1 error
+	if r[1] != nil {
+		r_1 = r[1].(error)
+	}
+	return r_0, r_1
+}
+
+// timeoutError has the same message as another error, but a different type
+type timeoutError struct{}
+
+func (timeoutError) Error() string { return "timed out" }
+
+func TestGoldenInterfaceArgs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ut")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "fetcher.json")
+
+	// Record
+	m := &MockFetcher{NewCallRecords(t)}
+	m.AddCall("Fetch", context.Background(), 37).SetReturns(42, nil)
+	m.AddCall("Report", errors.New("timed out"))
+	m.AddCall("Report", nil)
+	m.AddCall("Fetch", nil, "b").SetReturns(nil, errors.New("not found"))
+	m.Fetch(context.Background(), 37)
+	m.Report(errors.New("timed out"))
+	m.Report(nil)
+	m.Fetch(nil, "b")
+	m.AssertDone()
+	SaveGolden(t, m, path)
+
+	// Replay. The context differs, the int key is read back as a float64 but
+	// still matches, and the error only has to have the same message
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m = &MockFetcher{NewCallRecords(t)}
+	LoadGolden(t, m, path)
+	v, err := m.Fetch(ctx, 37)
+	if err != nil {
+		t.Fatalf("Fetch returned error %v", err)
+	}
+	// Numbers returned as interface{} come back as float64s
+	if v != float64(42) {
+		t.Errorf("Fetch returned %#v", v)
+	}
+	m.Report(timeoutError{})
+	m.Report(nil)
+	if _, err := m.Fetch(nil, "b"); err == nil || err.Error() != "not found" {
+		t.Errorf("Fetch returned error %v", err)
+	}
+	m.AssertDone()
+
+	// Different values of interface types are still caught
+	for i, call := range []func(m *MockFetcher){
+		func(m *MockFetcher) { m.Fetch(ctx, 38) },
+		func(m *MockFetcher) { m.Fetch(nil, 37) },
+		func(m *MockFetcher) { m.Fetch(ctx, "37") },
+	} {
+		f := &failRecorder{TB: &logRecorder{TB: t}}
+		m = &MockFetcher{NewCallRecords(f)}
+		LoadGolden(f, m, path)
+		call(m)
+		if !f.failed {
+			t.Errorf("Call %d, expected a call that differs from the golden file to fail", i)
+		}
+	}
+}
+
+func TestGoldenInterfaceReturns(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ut")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "fetcher.json")
+
+	// A nil return of an interface type can be read back
+	m := &MockFetcher{NewCallRecords(t)}
+	m.AddCall("Open", "missing").SetReturns(nil, errors.New("not found"))
+	m.Open("missing")
+	SaveGolden(t, m, path)
+
+	m = &MockFetcher{NewCallRecords(t)}
+	LoadGolden(t, m, path)
+	if r, err := m.Open("missing"); r != nil || err == nil {
+		t.Fatalf("Open returned %v, %v", r, err)
+	}
+	m.AssertDone()
+
+	// Other values can't be
+	m = &MockFetcher{NewCallRecords(t)}
+	m.AddCall("Open", "a").SetReturns(strings.NewReader("apple"), nil)
+	m.Open("a")
+	SaveGolden(t, m, path)
+
+	f := &stopRecorder{TB: t}
+	m = &MockFetcher{NewCallRecords(f)}
+	f.run(func() { LoadGolden(f, m, path) })
+	if exp := "Failed to read return 0 on line 1 of golden file " + path + ". values of interface type io.Reader can't be read back unless they are null"; f.fatal != exp {
+		t.Fatalf("Failure not as expected. Have %q", f.fatal)
+	}
+}
+
+// stopRecorder is a testing.TB that records Fatalf, and stops the function
+// passed to run as Fatalf would stop the test
+type stopRecorder struct {
+	testing.TB
+	fatal string
+}
+
+type stopRecorderStop struct{}
+
+func (f *stopRecorder) Fatalf(format string, args ...interface{}) {
+	f.fatal = fmt.Sprintf(format, args...)
+	panic(stopRecorderStop{})
+}
+
+func (f *stopRecorder) run(fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(stopRecorderStop); !ok {
+				panic(r)
+			}
+		}
+	}()
+	fn()
+}
@@ -0,0 +1,48 @@
+package ut
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+)
+
+// GoroutineID returns the ID of the calling goroutine, as shown in stack
+// traces. Go deliberately doesn't expose goroutine IDs, so we parse them from
+// the stack. This is too slow for anything but tests. Use it with
+// CallGoroutines to check which goroutine called a mock.
+//
+//	m.SetTrackGoroutines(true)
+//	UnderTest(m)
+//	for _, id := range m.CallGoroutines("Get") {
+//		if id != ut.GoroutineID() { ... }
+//	}
+func GoroutineID() uint64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	// The stack starts "goroutine 37 [running]:"
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
+
+func (cr *callRecords) SetTrackGoroutines(track bool) CallTracker {
+	cr.Lock()
+	defer cr.Unlock()
+	cr.trackGoroutines = track
+	return cr
+}
+
+func (cr *callRecords) CallGoroutines(name string) []uint64 {
+	cr.Lock()
+	defer cr.Unlock()
+	var ids []uint64
+	for _, c := range cr.log {
+		if c.Method == name && c.Goroutine != 0 {
+			ids = append(ids, c.Goroutine)
+		}
+	}
+	return ids
+}
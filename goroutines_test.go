@@ -0,0 +1,57 @@
+package ut
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGoroutineID(t *testing.T) {
+	id := GoroutineID()
+	if id == 0 {
+		t.Fatalf("Expected a goroutine ID")
+	}
+	if again := GoroutineID(); again != id {
+		t.Fatalf("Goroutine ID changed from %d to %d", id, again)
+	}
+
+	other := make(chan uint64)
+	go func() { other <- GoroutineID() }()
+	if o := <-other; o == 0 || o == id {
+		t.Fatalf("Expected a different goroutine ID to %d, have %d", id, o)
+	}
+}
+
+func TestCallGoroutines(t *testing.T) {
+	m := &MockGetter{NewCallRecords(t)}
+	m.Unordered()
+	m.AddCall("Get", "a").SetReturns("apple")
+	m.AddCall("Get", "b").SetReturns("banana")
+	m.AddCall("Get", "c").SetReturns("cherry")
+
+	// Calls aren't tracked until asked
+	m.Get("a")
+	if ids := m.CallGoroutines("Get"); ids != nil {
+		t.Fatalf("Expected no goroutines, have %v", ids)
+	}
+
+	m.SetTrackGoroutines(true)
+	m.Get("b")
+	other := make(chan uint64)
+	go func() {
+		m.Get("c")
+		other <- GoroutineID()
+	}()
+	otherID := <-other
+	m.AssertDone()
+
+	exp := []uint64{GoroutineID(), otherID}
+	if ids := m.CallGoroutines("Get"); !reflect.DeepEqual(ids, exp) {
+		t.Fatalf("Goroutines not as expected. Have %v, want %v", ids, exp)
+	}
+	if ids := m.CallGoroutines("Put"); ids != nil {
+		t.Fatalf("Expected no goroutines for Put, have %v", ids)
+	}
+	if log := m.Log(); log[0].Goroutine != 0 || log[2].Goroutine != otherID {
+		t.Fatalf("Log goroutines not as expected. %#v", log)
+	}
+}
@@ -0,0 +1,250 @@
+package ut
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"unicode/utf8"
+)
+
+// JSONSchema returns a Matcher that marshals the actual parameter to JSON and
+// checks it against a JSON schema. It panics if schema isn't valid JSON, uses
+// a keyword that isn't supported or has a pattern that doesn't compile, so a
+// mistake in the schema isn't mistaken for a bad argument.
+//
+//	m.AddCall("Publish", ut.JSONSchema([]byte(`{
+//		"type": "object",
+//		"required": ["id"],
+//		"properties": {"id": {"type": "string"}}
+//	}`)))
+//
+// A json.RawMessage parameter is checked as it is rather than being marshaled
+// again.
+//
+// Only the validation keywords most used for describing payloads are
+// supported: type, enum, const, properties, required, additionalProperties,
+// items, minItems, maxItems, minLength, maxLength, pattern, minimum and
+// maximum. The annotations $schema, $id, $comment, title, description,
+// default and examples are allowed but ignored. Other keywords, such as $ref,
+// allOf, anyOf and oneOf, aren't supported.
+func JSONSchema(schema []byte) Matcher {
+	var s interface{}
+	if err := json.Unmarshal(schema, &s); err != nil {
+		panic(fmt.Sprintf("JSONSchema could not parse the schema. %v", err))
+	}
+	if err := compileJSONSchema(s, "#"); err != nil {
+		panic(fmt.Sprintf("JSONSchema could not use the schema. %v", err))
+	}
+	var compact bytes.Buffer
+	json.Compact(&compact, schema)
+	return jsonSchemaMatcher{schema: s, text: compact.String()}
+}
+
+type jsonSchemaMatcher struct {
+	schema interface{}
+	text   string
+}
+
+func (j jsonSchemaMatcher) Match(actual interface{}) bool {
+	data, ok := actual.(json.RawMessage)
+	if !ok {
+		var err error
+		if data, err = json.Marshal(actual); err != nil {
+			return false
+		}
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return false
+	}
+	return validateJSON(j.schema, v)
+}
+
+func (j jsonSchemaMatcher) String() string {
+	return fmt.Sprintf("JSONSchema(%s)", j.text)
+}
+
+// compileJSONSchema checks the decoded schema only uses the keywords we
+// support, and replaces its patterns with the compiled regular expressions.
+// path locates the schema within the whole schema, for error messages.
+func compileJSONSchema(schema interface{}, path string) error {
+	s, ok := schema.(map[string]interface{})
+	if !ok {
+		if _, ok := schema.(bool); ok {
+			return nil
+		}
+		return fmt.Errorf("the schema at %s should be an object or a boolean", path)
+	}
+
+	keys := make([]string, 0, len(s))
+	for key := range s {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		switch key {
+		case "$schema", "$id", "$comment", "title", "description", "default", "examples",
+			"type", "enum", "const", "required", "minItems", "maxItems",
+			"minLength", "maxLength", "minimum", "maximum":
+		case "pattern":
+			pattern, ok := s[key].(string)
+			if !ok {
+				return fmt.Errorf("the pattern at %s should be a string", path)
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("the pattern at %s does not compile. %v", path, err)
+			}
+			s[key] = re
+		case "properties":
+			props, ok := s[key].(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("the properties at %s should be an object", path)
+			}
+			for name, ps := range props {
+				if err := compileJSONSchema(ps, path+"/properties/"+name); err != nil {
+					return err
+				}
+			}
+		case "additionalProperties", "items":
+			if err := compileJSONSchema(s[key], path+"/"+key); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("the keyword %s at %s is not supported", key, path)
+		}
+	}
+	return nil
+}
+
+// validateJSON checks the value v, as decoded by encoding/json, against the
+// decoded schema
+func validateJSON(schema, v interface{}) bool {
+	switch s := schema.(type) {
+	case bool:
+		// true accepts anything, false nothing
+		return s
+	case map[string]interface{}:
+		return validateJSONObject(s, v)
+	}
+	return false
+}
+
+func validateJSONObject(s map[string]interface{}, v interface{}) bool {
+	if t, ok := s["type"]; ok && !jsonTypeMatches(t, v) {
+		return false
+	}
+	if c, ok := s["const"]; ok && !reflect.DeepEqual(c, v) {
+		return false
+	}
+	if enum, ok := s["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if reflect.DeepEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return validateJSONProperties(s, v)
+	case []interface{}:
+		if !jsonWithin(s, "minItems", "maxItems", float64(len(v))) {
+			return false
+		}
+		if items, ok := s["items"]; ok {
+			for _, item := range v {
+				if !validateJSON(items, item) {
+					return false
+				}
+			}
+		}
+	case string:
+		if !jsonWithin(s, "minLength", "maxLength", float64(utf8.RuneCountInString(v))) {
+			return false
+		}
+		if re, ok := s["pattern"].(*regexp.Regexp); ok && !re.MatchString(v) {
+			return false
+		}
+	case float64:
+		return jsonWithin(s, "minimum", "maximum", v)
+	}
+	return true
+}
+
+func validateJSONProperties(s map[string]interface{}, v map[string]interface{}) bool {
+	if required, ok := s["required"].([]interface{}); ok {
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, ok := v[name]; !ok {
+				return false
+			}
+		}
+	}
+
+	props, _ := s["properties"].(map[string]interface{})
+	for name, val := range v {
+		if ps, ok := props[name]; ok {
+			if !validateJSON(ps, val) {
+				return false
+			}
+		} else if ap, ok := s["additionalProperties"]; ok && !validateJSON(ap, val) {
+			return false
+		}
+	}
+	return true
+}
+
+// jsonWithin checks val against the optional lower and upper limits named
+func jsonWithin(s map[string]interface{}, min, max string, val float64) bool {
+	if l, ok := s[min].(float64); ok && val < l {
+		return false
+	}
+	if l, ok := s[max].(float64); ok && val > l {
+		return false
+	}
+	return true
+}
+
+// jsonTypeMatches checks v against the schema's type, which is either a type
+// name or a list of them
+func jsonTypeMatches(t interface{}, v interface{}) bool {
+	switch t := t.(type) {
+	case string:
+		return jsonIsType(t, v)
+	case []interface{}:
+		for _, tt := range t {
+			if name, ok := tt.(string); ok && jsonIsType(name, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func jsonIsType(name string, v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return name == "null"
+	case bool:
+		return name == "boolean"
+	case string:
+		return name == "string"
+	case float64:
+		return name == "number" || (name == "integer" && v == math.Trunc(v))
+	case []interface{}:
+		return name == "array"
+	case map[string]interface{}:
+		return name == "object"
+	}
+	return false
+}
@@ -0,0 +1,184 @@
+package ut
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const orderSchema = `{
+	"type": "object",
+	"required": ["id", "items"],
+	"additionalProperties": false,
+	"properties": {
+		"id": {"type": "string", "pattern": "^ord-[0-9]+$"},
+		"status": {"enum": ["new", "paid"]},
+		"total": {"type": "number", "minimum": 0},
+		"items": {
+			"type": "array",
+			"minItems": 1,
+			"items": {
+				"type": "object",
+				"required": ["sku"],
+				"properties": {
+					"sku": {"type": "string", "minLength": 1},
+					"qty": {"type": "integer", "minimum": 1, "maximum": 99}
+				}
+			}
+		}
+	}
+}`
+
+type orderItem struct {
+	SKU string `json:"sku"`
+	Qty int    `json:"qty,omitempty"`
+}
+
+type order struct {
+	ID     string      `json:"id"`
+	Status string      `json:"status,omitempty"`
+	Total  float64     `json:"total"`
+	Items  []orderItem `json:"items"`
+}
+
+func TestJSONSchema(t *testing.T) {
+	tests := []struct {
+		actual interface{}
+		exp    bool
+	}{
+		{actual: order{ID: "ord-1", Total: 3.5, Items: []orderItem{{SKU: "a", Qty: 2}}}, exp: true},
+		{actual: &order{ID: "ord-1", Status: "paid", Items: []orderItem{{SKU: "a"}}}, exp: true},
+		{actual: map[string]interface{}{"id": "ord-2", "items": []map[string]string{{"sku": "b"}}}, exp: true},
+		{actual: json.RawMessage(`{"id": "ord-3", "items": [{"sku": "c"}]}`), exp: true},
+		{actual: order{ID: "order-1", Items: []orderItem{{SKU: "a"}}}, exp: false},
+		{actual: order{ID: "ord-1", Status: "lost", Items: []orderItem{{SKU: "a"}}}, exp: false},
+		{actual: order{ID: "ord-1", Total: -1, Items: []orderItem{{SKU: "a"}}}, exp: false},
+		{actual: order{ID: "ord-1", Items: []orderItem{}}, exp: false},
+		{actual: order{ID: "ord-1", Items: []orderItem{{SKU: ""}}}, exp: false},
+		{actual: order{ID: "ord-1", Items: []orderItem{{SKU: "a", Qty: 100}}}, exp: false},
+		{actual: map[string]interface{}{"id": "ord-2"}, exp: false},
+		{actual: map[string]interface{}{"id": "ord-2", "items": []map[string]string{{"sku": "b"}}, "extra": 1}, exp: false},
+		{actual: map[string]interface{}{"id": "ord-2", "items": []map[string]interface{}{{"sku": "b", "qty": 1.5}}}, exp: false},
+		{actual: "ord-1", exp: false},
+		{actual: nil, exp: false},
+		{actual: make(chan int), exp: false},
+	}
+
+	m := JSONSchema([]byte(orderSchema))
+	for i, test := range tests {
+		if m.Match(test.actual) != test.exp {
+			t.Errorf("Test %d, match of %#v not as expected", i, test.actual)
+		}
+	}
+}
+
+func TestJSONSchemaTypes(t *testing.T) {
+	tests := []struct {
+		schema string
+		actual interface{}
+		exp    bool
+	}{
+		{schema: `true`, actual: 1, exp: true},
+		{schema: `false`, actual: 1, exp: false},
+		{schema: `{}`, actual: nil, exp: true},
+		{schema: `{"type": "null"}`, actual: nil, exp: true},
+		{schema: `{"type": "boolean"}`, actual: true, exp: true},
+		{schema: `{"type": "integer"}`, actual: 3, exp: true},
+		{schema: `{"type": "integer"}`, actual: 3.5, exp: false},
+		{schema: `{"type": "number"}`, actual: 3.5, exp: true},
+		{schema: `{"type": ["string", "null"]}`, actual: nil, exp: true},
+		{schema: `{"type": ["string", "null"]}`, actual: 1, exp: false},
+		{schema: `{"const": "fred"}`, actual: "fred", exp: true},
+		{schema: `{"const": "fred"}`, actual: "barney", exp: false},
+		{schema: `{"maxLength": 3}`, actual: "héllo", exp: false},
+		{schema: `{"maxItems": 1}`, actual: []int{1, 2}, exp: false},
+	}
+
+	for i, test := range tests {
+		if JSONSchema([]byte(test.schema)).Match(test.actual) != test.exp {
+			t.Errorf("Test %d, match of %#v against %s not as expected", i, test.actual, test.schema)
+		}
+	}
+}
+
+func TestJSONSchemaString(t *testing.T) {
+	m := JSONSchema([]byte(`{ "type": "string" }`))
+	if s := m.String(); s != `JSONSchema({"type":"string"})` {
+		t.Fatalf("String not as expected. Have %s", s)
+	}
+}
+
+func TestJSONSchemaBadSchema(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected a panic")
+		}
+	}()
+	JSONSchema([]byte(`{"type": `))
+}
+
+func TestJSONSchemaUnusable(t *testing.T) {
+	tests := []struct {
+		schema string
+		msg    string
+	}{
+		{
+			schema: `{"properties": {"id": {"pattern": "^ord-[0-9+$"}}}`,
+			msg:    "JSONSchema could not use the schema. the pattern at #/properties/id does not compile. error parsing regexp: missing closing ]: `[0-9+$`",
+		},
+		{
+			schema: `{"$ref": "#/definitions/order"}`,
+			msg:    "JSONSchema could not use the schema. the keyword $ref at # is not supported",
+		},
+		{
+			schema: `{"items": {"oneOf": [{"type": "string"}, {"type": "number"}]}}`,
+			msg:    "JSONSchema could not use the schema. the keyword oneOf at #/items is not supported",
+		},
+		{
+			schema: `{"items": [{"type": "string"}]}`,
+			msg:    "JSONSchema could not use the schema. the schema at #/items should be an object or a boolean",
+		},
+	}
+
+	for i, test := range tests {
+		func() {
+			defer func() {
+				if r := recover(); r != test.msg {
+					t.Errorf("Test %d, panic not as expected. Have %v", i, r)
+				}
+			}()
+			JSONSchema([]byte(test.schema))
+		}()
+	}
+
+	// Annotations are fine
+	m := JSONSchema([]byte(`{"$schema": "http://json-schema.org/draft-07/schema#", "title": "ID", "type": "string"}`))
+	if !m.Match("ord-1") {
+		t.Fatalf("Expected a match")
+	}
+}
+
+// MockPublisher publishes order payloads
+type MockPublisher struct {
+	CallTracker
+}
+
+func (m *MockPublisher) Publish(topic string, payload interface{}) {
+	m.TrackCall("Publish", topic, payload)
+}
+
+func TestJSONSchemaInCall(t *testing.T) {
+	m := &MockPublisher{NewCallRecords(t)}
+	m.AddCall("Publish", "orders", JSONSchema([]byte(orderSchema)))
+
+	m.Publish("orders", order{ID: "ord-1", Items: []orderItem{{SKU: "a", Qty: 1}}})
+	m.AssertDone()
+
+	f := &failRecorder{TB: t}
+	m = &MockPublisher{NewCallRecords(f)}
+	m.AddCall("Publish", "orders", JSONSchema([]byte(orderSchema)))
+
+	m.Publish("orders", order{ID: "ord-1"})
+	if !f.failed {
+		t.Fatalf("Expected a payload without items to fail")
+	}
+}
@@ -0,0 +1,157 @@
+package ut
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sync"
+)
+
+// Matcher can be passed to AddCall in place of an expected parameter value to
+// check the actual parameter some other way than by testing for equality.
+type Matcher interface {
+	// Match returns true if the actual parameter is acceptable
+	Match(actual interface{}) bool
+	// String describes what the Matcher expects, for failure messages
+	String() string
+}
+
+// CaptureAll returns a Matcher that accepts any parameter and appends it to
+// the slice pointed to by ptr. Use the same matcher for each expected call to
+// build up the full sequence of arguments, then check the slice once the code
+// under test has run.
+//
+//	var keys []string
+//	capture := ut.CaptureAll(&keys)
+//	m.AddCall("Get", capture).SetReturns("a")
+//	m.AddCall("Get", capture).SetReturns("b")
+func CaptureAll(ptr interface{}) Matcher {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		panic(fmt.Sprintf("CaptureAll needs a pointer to a slice, not %T", ptr))
+	}
+	return &captureMatcher{s: v.Elem()}
+}
+
+type captureMatcher struct {
+	// The matcher may be shared between calls made from different goroutines
+	sync.Mutex
+	s reflect.Value
+}
+
+func (c *captureMatcher) Match(actual interface{}) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	elemType := c.s.Type().Elem()
+	av := reflect.Zero(elemType)
+	if actual != nil {
+		av = reflect.ValueOf(actual)
+		if !av.Type().AssignableTo(elemType) {
+			panic(fmt.Sprintf("CaptureAll cannot store %T in %s", actual, c.s.Type()))
+		}
+	}
+	c.s.Set(reflect.Append(c.s, av))
+	return true
+}
+
+func (c *captureMatcher) String() string {
+	return fmt.Sprintf("CaptureAll(*%s)", c.s.Type())
+}
+
+// ContextWithValue returns a Matcher that checks the actual parameter is a
+// context.Context carrying val for key.
+//
+//	m.AddCall("Handle", ut.ContextWithValue(requestIDKey, "abc123"), req)
+func ContextWithValue(key, val interface{}) Matcher {
+	return contextValueMatcher{key: key, val: val}
+}
+
+type contextValueMatcher struct {
+	key, val interface{}
+}
+
+func (c contextValueMatcher) Match(actual interface{}) bool {
+	ctx, ok := actual.(context.Context)
+	if !ok {
+		return false
+	}
+	return reflect.DeepEqual(ctx.Value(c.key), c.val)
+}
+
+func (c contextValueMatcher) String() string {
+	return fmt.Sprintf("ContextWithValue(%#v, %#v)", c.key, c.val)
+}
+
+// ContextWithDeadline returns a Matcher that checks the actual parameter is a
+// context.Context with a deadline set.
+func ContextWithDeadline() Matcher {
+	return contextDeadlineMatcher{}
+}
+
+type contextDeadlineMatcher struct{}
+
+func (contextDeadlineMatcher) Match(actual interface{}) bool {
+	ctx, ok := actual.(context.Context)
+	if !ok {
+		return false
+	}
+	_, ok = ctx.Deadline()
+	return ok
+}
+
+func (contextDeadlineMatcher) String() string {
+	return "ContextWithDeadline()"
+}
+
+// MatchRegexp returns a Matcher that checks the actual parameter is a string
+// matching the regular expression pattern. It panics if pattern doesn't
+// compile.
+//
+//	m.AddCall("Log", ut.MatchRegexp("^user [0-9]+ logged in$"))
+func MatchRegexp(pattern string) Matcher {
+	return regexpMatcher{re: regexp.MustCompile(pattern)}
+}
+
+type regexpMatcher struct {
+	re *regexp.Regexp
+}
+
+func (r regexpMatcher) Match(actual interface{}) bool {
+	s, ok := actual.(string)
+	return ok && r.re.MatchString(s)
+}
+
+func (r regexpMatcher) String() string {
+	return fmt.Sprintf("MatchRegexp(%q)", r.re.String())
+}
+
+// Ref returns a Matcher that checks the actual parameter equals the value ptr
+// points to at the time of the call, rather than when the expectation is
+// added. Use it when a parameter is only known once an earlier call has been
+// made, such as an ID generated by the code under test that is passed to
+// Create and should then be passed to Update.
+//
+//	var id string
+//	m.AddCall("Create", func(actual interface{}) { id = actual.(string) }, "fred")
+//	m.AddCall("Update", ut.Ref(&id), "barney")
+func Ref(ptr interface{}) Matcher {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr {
+		panic(fmt.Sprintf("Ref needs a pointer, not %T", ptr))
+	}
+	return refMatcher{v: v}
+}
+
+type refMatcher struct {
+	v reflect.Value
+}
+
+func (r refMatcher) Match(actual interface{}) bool {
+	return reflect.DeepEqual(actual, r.v.Elem().Interface())
+}
+
+func (r refMatcher) String() string {
+	return fmt.Sprintf("Ref(%#v)", r.v.Elem().Interface())
+}
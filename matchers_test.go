@@ -0,0 +1,269 @@
+package ut
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCaptureAll(t *testing.T) {
+	m := NewMockReader(t)
+
+	var bufs [][]byte
+	capture := CaptureAll(&bufs)
+	m.AddCall("Read", capture).SetReturns(1, nil)
+	m.AddCall("Read", capture).SetReturns(2, nil)
+	m.AddCall("Read", capture).SetReturns(3, nil)
+
+	for _, s := range []string{"a", "bb", "ccc"} {
+		m.Read([]byte(s))
+	}
+	m.AssertDone()
+
+	exp := [][]byte{[]byte("a"), []byte("bb"), []byte("ccc")}
+	if !reflect.DeepEqual(bufs, exp) {
+		t.Fatalf("captured %q, expected %q", bufs, exp)
+	}
+}
+
+func TestCaptureAllUnordered(t *testing.T) {
+	m := NewMockReader(t)
+	m.Unordered()
+
+	// Searching the expected calls for a match mustn't capture anything
+	var bufs [][]byte
+	m.AddCall("Read", []byte("a")).SetReturns(1, nil)
+	m.AddCall("Read", []byte("b")).SetReturns(1, nil)
+	m.AddCall("Read", CaptureAll(&bufs)).SetReturns(2, nil)
+
+	for _, s := range []string{"cc", "b", "a"} {
+		m.Read([]byte(s))
+	}
+	m.AssertDone()
+
+	exp := [][]byte{[]byte("cc")}
+	if !reflect.DeepEqual(bufs, exp) {
+		t.Fatalf("captured %q, expected %q", bufs, exp)
+	}
+}
+
+func TestCaptureAllString(t *testing.T) {
+	var keys []string
+	if s := CaptureAll(&keys).String(); s != "CaptureAll(*[]string)" {
+		t.Fatalf("String not as expected. Have %s", s)
+	}
+}
+
+func TestCaptureAllConcurrent(t *testing.T) {
+	var vals []interface{}
+	capture := CaptureAll(&vals)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			capture.Match(i)
+		}(i)
+	}
+	wg.Wait()
+
+	if len(vals) != 20 {
+		t.Fatalf("captured %d values, expected 20", len(vals))
+	}
+}
+
+func TestCaptureAllNeedsSlicePointer(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected a panic")
+		}
+	}()
+	var s []int
+	CaptureAll(s)
+}
+
+type requestIDKey struct{}
+
+// MockHandler has a method taking a context
+type MockHandler struct {
+	CallTracker
+}
+
+func (m *MockHandler) Handle(ctx context.Context, req string) {
+	m.TrackCall("Handle", ctx, req)
+}
+
+func TestContextMatchers(t *testing.T) {
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "abc123")
+	dctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	tests := []struct {
+		ctx     context.Context
+		matcher Matcher
+		exp     bool
+	}{
+		{ctx: ctx, matcher: ContextWithValue(requestIDKey{}, "abc123"), exp: true},
+		{ctx: ctx, matcher: ContextWithValue(requestIDKey{}, "def456"), exp: false},
+		{ctx: context.Background(), matcher: ContextWithValue(requestIDKey{}, "abc123"), exp: false},
+		{ctx: dctx, matcher: ContextWithValue(requestIDKey{}, "abc123"), exp: true},
+		{ctx: ctx, matcher: ContextWithDeadline(), exp: false},
+		{ctx: dctx, matcher: ContextWithDeadline(), exp: true},
+	}
+
+	for i, test := range tests {
+		if test.matcher.Match(test.ctx) != test.exp {
+			t.Errorf("Test %d, %s match of %v not as expected", i, test.matcher, test.ctx)
+		}
+	}
+
+	if ContextWithDeadline().Match("not a context") {
+		t.Errorf("ContextWithDeadline should not match a string")
+	}
+}
+
+func TestContextMatcherInCall(t *testing.T) {
+	m := &MockHandler{NewCallRecords(t)}
+	m.AddCall("Handle", ContextWithValue(requestIDKey{}, "abc123"), "get")
+
+	m.Handle(context.WithValue(context.Background(), requestIDKey{}, "abc123"), "get")
+	m.AssertDone()
+
+	l := &logRecorder{TB: &failRecorder{TB: t}}
+	m = &MockHandler{NewCallRecords(l)}
+	m.AddCall("Handle", ContextWithValue(requestIDKey{}, "abc123"), "get")
+
+	m.Handle(context.Background(), "get")
+	if !l.TB.(*failRecorder).failed {
+		t.Fatalf("Expected the call to fail")
+	}
+	if len(l.logs) < 2 || l.logs[1] != `  expected ContextWithValue(ut.requestIDKey{}, "abc123")` {
+		t.Fatalf("Logs not as expected. %q", l.logs)
+	}
+}
+
+// failRecorder is a testing.TB that notes whether the test failed
+type failRecorder struct {
+	testing.TB
+	failed bool
+}
+
+func (f *failRecorder) Fail() {
+	f.failed = true
+}
+
+func TestMatchRegexp(t *testing.T) {
+	tests := []struct {
+		actual interface{}
+		exp    bool
+	}{
+		{actual: "user 37 logged in", exp: true},
+		{actual: "user fred logged in", exp: false},
+		{actual: "user 37 logged in twice", exp: false},
+		{actual: 37, exp: false},
+		{actual: nil, exp: false},
+	}
+
+	m := MatchRegexp("^user [0-9]+ logged in$")
+	for i, test := range tests {
+		if m.Match(test.actual) != test.exp {
+			t.Errorf("Test %d, match of %#v not as expected", i, test.actual)
+		}
+	}
+
+	if s := m.String(); s != `MatchRegexp("^user [0-9]+ logged in$")` {
+		t.Errorf("String not as expected. Have %s", s)
+	}
+}
+
+func TestMatchRegexpInCall(t *testing.T) {
+	m := &MockGetter{NewCallRecords(t)}
+	m.Unordered()
+	m.AddCall("Get", MatchRegexp("^b")).SetReturns("b-word")
+	m.AddCall("Get", MatchRegexp("^a")).SetReturns("a-word")
+
+	if v := m.Get("apple"); v != "a-word" {
+		t.Fatalf("Get(apple) returned %s", v)
+	}
+	if v := m.Get("banana"); v != "b-word" {
+		t.Fatalf("Get(banana) returned %s", v)
+	}
+	m.AssertDone()
+}
+
+// MockLogger has a method with the name of the tracker's Log, which it hides,
+// laid out as genmock would
+type MockLogger struct {
+	CallTracker
+}
+
+func (m *MockLogger) Log(msg string) {
+	m.TrackCall("Log", msg)
+}
+
+func TestMatchRegexpTimestamp(t *testing.T) {
+	const pattern = `^[0-9]{4}-[0-9]{2}-[0-9]{2}T[0-9]{2}:[0-9]{2}:[0-9]{2}Z user 37 logged in$`
+	m := &MockLogger{NewCallRecords(t)}
+	m.AddCall("Log", MatchRegexp(pattern))
+	m.Log(time.Now().UTC().Format("2006-01-02T15:04:05Z") + " user 37 logged in")
+	m.AssertDone()
+
+	l := &logRecorder{TB: &failRecorder{TB: t}}
+	m = &MockLogger{NewCallRecords(l)}
+	m.AddCall("Log", MatchRegexp(pattern))
+
+	m.Log("user 37 logged in")
+	if !l.TB.(*failRecorder).failed {
+		t.Fatalf("Expected the call without a timestamp to fail")
+	}
+	if exp := "  expected MatchRegexp(\"" + pattern + "\")"; len(l.logs) < 2 || l.logs[1] != exp {
+		t.Fatalf("Logs not as expected. %q", l.logs)
+	}
+}
+
+// MockStore has a create-then-update flow
+type MockStore struct {
+	CallTracker
+}
+
+func (m *MockStore) Create(id, name string) {
+	m.TrackCall("Create", id, name)
+}
+
+func (m *MockStore) Update(id, name string) {
+	m.TrackCall("Update", id, name)
+}
+
+func TestRef(t *testing.T) {
+	m := &MockStore{NewCallRecords(t)}
+
+	var id string
+	m.AddCall("Create", func(actual interface{}) { id = actual.(string) }, "fred")
+	m.AddCall("Update", Ref(&id), "barney")
+
+	m.Create("id-37", "fred")
+	m.Update("id-37", "barney")
+	m.AssertDone()
+
+	if s := Ref(&id).String(); s != `Ref("id-37")` {
+		t.Fatalf("String not as expected. Have %s", s)
+	}
+}
+
+func TestRefMismatch(t *testing.T) {
+	f := &failRecorder{TB: t}
+	m := &MockStore{NewCallRecords(f)}
+
+	var id string
+	m.AddCall("Create", func(actual interface{}) { id = actual.(string) }, "fred")
+	m.AddCall("Update", Ref(&id), "barney")
+
+	m.Create("id-37", "fred")
+	m.Update("id-38", "barney")
+	if !f.failed {
+		t.Fatalf("Expected Update with the wrong ID to fail")
+	}
+}
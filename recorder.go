@@ -0,0 +1,112 @@
+package ut
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Recorder wraps a CallTracker and records every call tracked, by TrackCall or
+// MustTrackCall, along with the values returned. GenerateExpectations turns the recording into the Go code
+// needed to set up the same expectations, so you can record the interactions
+// from a run against a hand-built or lenient tracker and then replay them as
+// strict expectations.
+//
+//	rec := ut.NewRecorder(ut.NewCallRecords(t))
+//	m := &MockReader{rec}
+//	rec.RecordCall("Read", 10, nil)
+//	UnderTest(m)
+//	fmt.Println(rec.GenerateExpectations("m"))
+type Recorder struct {
+	CallTracker
+
+	lock  sync.Mutex
+	calls []callRecord
+}
+
+// NewRecorder creates a Recorder wrapping ct
+func NewRecorder(ct CallTracker) *Recorder {
+	return &Recorder{CallTracker: ct}
+}
+
+// TrackCall tracks the call with the wrapped CallTracker and records it.
+func (r *Recorder) TrackCall(name string, params ...interface{}) []interface{} {
+	returns := r.CallTracker.TrackCall(name, params...)
+	r.record(name, params, returns)
+	return returns
+}
+
+// MustTrackCall tracks the call with the wrapped CallTracker and records it.
+// Calls that stop the test aren't recorded.
+func (r *Recorder) MustTrackCall(name string, params ...interface{}) []interface{} {
+	returns := r.CallTracker.MustTrackCall(name, params...)
+	r.record(name, params, returns)
+	return returns
+}
+
+func (r *Recorder) record(name string, params, returns []interface{}) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.calls = append(r.calls, callRecord{name: name, params: params, returns: returns})
+}
+
+// GenerateExpectations returns Go code that adds the recorded calls as
+// expectations on the named mock variable. There's one statement per line.
+//
+// Values are written using %#v, so this works well for basic types, slices,
+// maps and structs. Basic values are converted to their type where an untyped
+// constant would get a different one, such as int64(5) or time.Duration(1000),
+// and the code needs the packages of named types imported. Values held as
+// interface{} within slices, maps or structs lose their type, and values like
+// errors and pointers will need fixing up by hand.
+func (r *Recorder) GenerateExpectations(mockName string) string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	w := &bytes.Buffer{}
+	for _, call := range r.calls {
+		fmt.Fprintf(w, "%s.AddCall(%q", mockName, call.name)
+		for _, p := range call.params {
+			w.WriteString(", ")
+			w.WriteString(goValue(p))
+		}
+		w.WriteString(")")
+
+		if len(call.returns) != 0 {
+			w.WriteString(".SetReturns(")
+			for i, ret := range call.returns {
+				if i != 0 {
+					w.WriteString(", ")
+				}
+				w.WriteString(goValue(ret))
+			}
+			w.WriteString(")")
+		}
+		w.WriteString("\n")
+	}
+	return w.String()
+}
+
+// goValue renders a value as Go code
+func goValue(v interface{}) string {
+	if v == nil {
+		return "nil"
+	}
+	s := fmt.Sprintf("%#v", v)
+
+	t := reflect.TypeOf(v)
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.String:
+		// Untyped constants default to these types
+		if t.PkgPath() == "" {
+			return s
+		}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+	default:
+		return s
+	}
+	return t.String() + "(" + s + ")"
+}
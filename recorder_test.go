@@ -0,0 +1,189 @@
+package ut
+
+import (
+	"fmt"
+	"go/parser"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecorder(t *testing.T) {
+	rec := NewRecorder(NewCallRecords(t))
+	m := &MockReader{rec}
+	rec.RecordCall("Read", 1, nil)
+
+	m.Read([]byte("ab"))
+	m.Read([]byte("cd"))
+
+	code := rec.GenerateExpectations("m")
+	exp := `m.AddCall("Read", []byte{0x61, 0x62}).SetReturns(1, nil)
+m.AddCall("Read", []byte{0x63, 0x64}).SetReturns(1, nil)
+`
+	if code != exp {
+		t.Fatalf("Generated code not as expected. Have %s", code)
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(code), "\n") {
+		if _, err := parser.ParseExpr(line); err != nil {
+			t.Fatalf("Generated code %s does not parse. %v", line, err)
+		}
+	}
+}
+
+type weekday int
+
+func TestGoValue(t *testing.T) {
+	tests := []struct {
+		v   interface{}
+		exp string
+	}{
+		{v: nil, exp: "nil"},
+		{v: 37, exp: "37"},
+		{v: "fred", exp: `"fred"`},
+		{v: true, exp: "true"},
+		{v: int64(37), exp: "int64(37)"},
+		{v: uint8(7), exp: "uint8(0x7)"},
+		{v: float32(1.5), exp: "float32(1.5)"},
+		{v: float64(2), exp: "float64(2)"},
+		{v: time.Second, exp: "time.Duration(1000000000)"},
+		{v: weekday(3), exp: "ut.weekday(3)"},
+		{v: []int64{1, 2}, exp: "[]int64{1, 2}"},
+		{v: struct{ A int }{A: 1}, exp: "struct { A int }{A:1}"},
+	}
+
+	for _, test := range tests {
+		if s := goValue(test.v); s != test.exp {
+			t.Errorf("goValue(%#v) is %s, expected %s", test.v, s, test.exp)
+		}
+	}
+}
+
+// MockScheduler has a method with parameters and results that untyped
+// constants would get wrong, laid out as genmock would with -eager
+type MockScheduler struct {
+	CallTracker
+}
+
+func (m *MockScheduler) Schedule(at int64, every time.Duration, weight float32) (float64, error) {
+	r := m.MustTrackCall("Schedule", at, every, weight)
+	var r_0 float64
+	if r[0] != nil {
+		r_0 = r[0].(float64)
+	}
+	return r_0, NilOrError(r[1])
+}
+
+// replaySource is a test that replays expectations generated from calls to a
+// MockScheduler
+const replaySource = `package replay
+
+import (
+	"testing"
+	"time"
+
+	"github.com/philpearl/ut"
+)
+
+type MockScheduler struct {
+	ut.CallTracker
+}
+
+func (m *MockScheduler) Schedule(at int64, every time.Duration, weight float32) (float64, error) {
+	r := m.MustTrackCall("Schedule", at, every, weight)
+	var r_0 float64
+	if r[0] != nil {
+		r_0 = r[0].(float64)
+	}
+	return r_0, ut.NilOrError(r[1])
+}
+
+func TestReplay(t *testing.T) {
+	m := &MockScheduler{ut.NewCallRecords(t)}
+%s
+	if v, err := m.Schedule(1, time.Second, 1.5); v != 2 || err != nil {
+		t.Fatalf("Schedule returned %%v, %%v", v, err)
+	}
+	if v, err := m.Schedule(2, time.Minute, 0.5); v != 2 || err != nil {
+		t.Fatalf("Schedule returned %%v, %%v", v, err)
+	}
+	m.AssertDone()
+}
+`
+
+func TestRecorderReplay(t *testing.T) {
+	rec := NewRecorder(NewCallRecords(t))
+	m := &MockScheduler{rec}
+	rec.RecordCall("Schedule", float64(2), nil)
+
+	m.Schedule(1, time.Second, 1.5)
+	m.Schedule(2, time.Minute, 0.5)
+
+	code := rec.GenerateExpectations("m")
+	exp := `m.AddCall("Schedule", int64(1), time.Duration(1000000000), float32(1.5)).SetReturns(float64(2), nil)
+m.AddCall("Schedule", int64(2), time.Duration(60000000000), float32(0.5)).SetReturns(float64(2), nil)
+`
+	if code != exp {
+		t.Fatalf("Generated code not as expected. Have %s", code)
+	}
+
+	assertGoTest(t, "example.com/replay", map[string]string{
+		"example.com/replay/replay_test.go": fmt.Sprintf(replaySource, "\t"+strings.Replace(strings.TrimSpace(code), "\n", "\n\t", -1)),
+	})
+}
+
+// assertGoTest writes the files into a temporary GOPATH, alongside this copy
+// of ut, and runs go test on the package at pkgPath. files are keyed by their
+// path within the GOPATH's src directory. It is skipped with -short.
+func assertGoTest(t *testing.T, pkgPath string, files map[string]string) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("Skipping running go test with -short")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("Skipping as the go tool isn't on the path")
+	}
+
+	dir, err := ioutil.TempDir("", "ut")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	utDir, err := filepath.Abs(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "src", "github.com", "philpearl", "ut")
+	if err := os.MkdirAll(filepath.Dir(link), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(utDir, link); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, "src", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := exec.Command(goTool, "test", "./"+pkgPath)
+	cmd.Dir = filepath.Join(dir, "src")
+	cmd.Env = append(os.Environ(), "GOPATH="+dir, "GO111MODULE=off", "GOFLAGS=")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("go test failed. %v\n%s", err, out)
+		for name, content := range files {
+			t.Logf("%s:\n%s", name, content)
+		}
+	}
+}
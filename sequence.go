@@ -0,0 +1,120 @@
+package ut
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// clock orders calls made across all trackers
+var clock uint64
+
+// SequencePoint expresses a happens-before constraint between expected calls,
+// which may be on different mocks. Every call added with Before(p) must be
+// made before any call added with After(p). Calls not tied to a
+// SequencePoint may be made at any time, so several points can describe a
+// partial order that's looser than Unordered() followed by
+// AssertConsumedInOrder().
+//
+//	p := ut.Sequence()
+//	db.AddCall("Open").Before(p)
+//	cache.AddCall("Load").Before(p)
+//	db.AddCall("Query", "x").After(p)
+//
+//	UnderTest(db, cache)
+//	p.AssertOrder(t)
+type SequencePoint struct {
+	sync.Mutex
+	before []sequencedCall
+	after  []sequencedCall
+}
+
+// sequencedCall identifies an expected call on a tracker. We can't hold a
+// pointer to the call as the tracker's slice of calls may be reallocated, and
+// ResetMethod moves calls, so the tracker keeps the index up to date. The
+// index is -1 once ResetMethod has removed the call.
+type sequencedCall struct {
+	cr    *callRecords
+	index *int
+}
+
+// made returns the call, whether it has been made, and when. ok is false if
+// the call has been removed by ResetMethod
+func (s sequencedCall) made() (call callRecord, made bool, at uint64, ok bool) {
+	s.cr.Lock()
+	defer s.cr.Unlock()
+	if *s.index < 0 {
+		return callRecord{}, false, 0, false
+	}
+	call = s.cr.calls[*s.index]
+	return call, call.made, call.madeAt, true
+}
+
+// Sequence creates a SequencePoint
+func Sequence() *SequencePoint {
+	return &SequencePoint{}
+}
+
+func (p *SequencePoint) addBefore(s sequencedCall) {
+	p.Lock()
+	defer p.Unlock()
+	p.before = append(p.before, s)
+}
+
+func (p *SequencePoint) addAfter(s sequencedCall) {
+	p.Lock()
+	defer p.Unlock()
+	p.after = append(p.after, s)
+}
+
+// AssertOrder checks that each call made after the point was made after all
+// the calls before it. Call it once the code under test has run. Calls that
+// haven't been made are left for AssertDone to report, except that a call
+// after the point can't have been made correctly if a call before it is
+// still outstanding. Calls removed by ResetMethod no longer take part.
+func (p *SequencePoint) AssertOrder(t testing.TB) {
+	p.Lock()
+	defer p.Unlock()
+
+	for _, a := range p.after {
+		ac, made, at, ok := a.made()
+		if !ok || !made {
+			continue
+		}
+		for _, b := range p.before {
+			bc, made, bt, ok := b.made()
+			if !ok {
+				continue
+			}
+			if !made {
+				t.Errorf("Call to %s%s should follow call to %s%s, which was not made", ac.name, paramsToString(ac.params), bc.name, paramsToString(bc.params))
+			} else if bt > at {
+				t.Errorf("Call to %s%s should follow call to %s%s, but was made before it", ac.name, paramsToString(ac.params), bc.name, paramsToString(bc.params))
+			}
+		}
+	}
+}
+
+func (cr *callRecords) Before(p *SequencePoint) CallTracker {
+	p.addBefore(cr.sequenceLast())
+	return cr
+}
+
+func (cr *callRecords) After(p *SequencePoint) CallTracker {
+	p.addAfter(cr.sequenceLast())
+	return cr
+}
+
+// sequenceLast identifies the last expected call added, for a SequencePoint
+func (cr *callRecords) sequenceLast() sequencedCall {
+	cr.Lock()
+	defer cr.Unlock()
+	index := len(cr.calls) - 1
+	cr.sequenced = append(cr.sequenced, &index)
+	return sequencedCall{cr: cr, index: &index}
+}
+
+// tick returns the next time on the clock shared by all trackers
+func tick() uint64 {
+	return atomic.AddUint64(&clock, 1)
+}
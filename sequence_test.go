@@ -0,0 +1,124 @@
+package ut
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSequence(t *testing.T) {
+	tests := []struct {
+		calls  []string
+		errors []string
+	}{
+		{
+			calls: []string{"create", "update", "get b", "get a"},
+		},
+		{
+			calls: []string{"get b", "create", "update", "get a"},
+		},
+		{
+			calls: []string{"create", "get a", "update", "get b"},
+			errors: []string{
+				`Call to Get("a") should follow call to Update("id", "barney"), but was made before it`,
+			},
+		},
+		{
+			calls: []string{"update", "get a", "get b"},
+			errors: []string{
+				`Call to Update("id", "barney") should follow call to Create("id", "fred"), which was not made`,
+				`Call to Get("a") should follow call to Create("id", "fred"), which was not made`,
+			},
+		},
+	}
+
+	for i, test := range tests {
+		g := &MockGetter{NewCallRecords(t)}
+		s := &MockStore{NewCallRecords(t)}
+		g.Unordered()
+		s.Unordered()
+
+		created := Sequence()
+		updated := Sequence()
+		s.AddCall("Create", "id", "fred").Before(created)
+		s.AddCall("Update", "id", "barney").After(created).Before(updated)
+		g.AddCall("Get", "a").SetReturns("apple").After(created).After(updated)
+		g.AddCall("Get", "b").SetReturns("banana")
+
+		for _, call := range test.calls {
+			switch call {
+			case "create":
+				s.Create("id", "fred")
+			case "update":
+				s.Update("id", "barney")
+			case "get a":
+				g.Get("a")
+			case "get b":
+				g.Get("b")
+			}
+		}
+
+		e := &errorRecorder{TB: t}
+		created.AssertOrder(e)
+		updated.AssertOrder(e)
+		if !reflect.DeepEqual(e.errors, test.errors) {
+			t.Errorf("Test %d, errors not as expected. %q", i, e.errors)
+		}
+	}
+}
+
+func TestSequenceAfterResetMethod(t *testing.T) {
+	tests := []struct {
+		reset  string
+		calls  []string
+		errors []string
+	}{
+		{
+			// Update's reset moves Get up, which the point must follow
+			reset: "Update",
+			calls: []string{"get", "create"},
+			errors: []string{
+				`Call to Get("a") should follow call to Create("id", "fred"), but was made before it`,
+			},
+		},
+		{
+			reset: "Update",
+			calls: []string{"create", "get"},
+		},
+		{
+			// Reset calls no longer take part
+			reset: "Create",
+			calls: []string{"get", "update"},
+		},
+	}
+
+	for i, test := range tests {
+		s := &MockStore{NewCallRecords(t)}
+		g := &MockGetter{NewCallRecords(t)}
+		s.Unordered()
+
+		p := Sequence()
+		s.AddCall("Update", "id", "barney")
+		s.AddCall("Create", "id", "fred").Before(p)
+		g.AddCall("Get", "a").SetReturns("apple").After(p)
+		s.ResetMethod(test.reset)
+
+		for _, call := range test.calls {
+			switch call {
+			case "create":
+				s.Create("id", "fred")
+			case "update":
+				s.Update("id", "barney")
+			case "get":
+				g.Get("a")
+			}
+		}
+
+		e := &errorRecorder{TB: t}
+		p.AssertOrder(e)
+		if !reflect.DeepEqual(e.errors, test.errors) {
+			t.Errorf("Test %d, errors not as expected. %q", i, e.errors)
+		}
+		s.AssertDone()
+		g.AssertDone()
+	}
+}
@@ -0,0 +1,52 @@
+package ut
+
+import "time"
+
+// CallStats summarises the time taken by calls to a mock method, as recorded
+// by RecordLatency. Mocks generated with genmock -time-calls record the time
+// taken to track each call.
+type CallStats struct {
+	Count int
+	Total time.Duration
+	Min   time.Duration
+	Max   time.Duration
+}
+
+// Mean returns the average time taken by a call, or zero if there were no calls
+func (s CallStats) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+func (s *CallStats) add(d time.Duration) {
+	if s.Count == 0 || d < s.Min {
+		s.Min = d
+	}
+	if d > s.Max {
+		s.Max = d
+	}
+	s.Count++
+	s.Total += d
+}
+
+func (cr *callRecords) RecordLatency(name string, d time.Duration) {
+	cr.Lock()
+	defer cr.Unlock()
+	s, ok := cr.stats[name]
+	if !ok {
+		s = &CallStats{}
+		cr.stats[name] = s
+	}
+	s.add(d)
+}
+
+func (cr *callRecords) Stats(name string) CallStats {
+	cr.Lock()
+	defer cr.Unlock()
+	if s, ok := cr.stats[name]; ok {
+		return *s
+	}
+	return CallStats{}
+}
@@ -0,0 +1,36 @@
+package ut
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	m := &MockReader{NewCallRecords(t)}
+
+	if s := m.Stats("Read"); s != (CallStats{}) {
+		t.Fatalf("Expected empty stats before any calls, have %#v", s)
+	}
+
+	for _, d := range []time.Duration{3, 1, 5, 3} {
+		m.RecordLatency("Read", d*time.Millisecond)
+	}
+	m.RecordLatency("Write", time.Second)
+
+	exp := CallStats{
+		Count: 4,
+		Total: 12 * time.Millisecond,
+		Min:   time.Millisecond,
+		Max:   5 * time.Millisecond,
+	}
+	s := m.Stats("Read")
+	if s != exp {
+		t.Fatalf("Stats not as expected. Have %#v", s)
+	}
+	if mean := s.Mean(); mean != 3*time.Millisecond {
+		t.Fatalf("Mean not as expected. Have %s", mean)
+	}
+	if mean := m.Stats("Close").Mean(); mean != 0 {
+		t.Fatalf("Mean with no calls should be zero. Have %s", mean)
+	}
+}